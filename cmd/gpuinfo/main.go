@@ -0,0 +1,70 @@
+// gpuinfo prints everything the GPUs report about themselves, for attaching
+// to bug reports instead of vulkaninfo output.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	vk "github.com/vulkan-go/vulkan"
+
+	"github.com/perlw/abyssal_drifter/pompeii"
+)
+
+func main() {
+	asJSON := flag.Bool("json", false, "print the reports as JSON")
+	flag.Parse()
+
+	if err := run(*asJSON); err != nil {
+		fmt.Fprintln(os.Stderr, "gpuinfo:", err)
+		os.Exit(1)
+	}
+}
+
+func run(asJSON bool) error {
+	if err := pompeii.SetDefaultGetInstanceProcAddr(); err != nil {
+		return err
+	}
+	if err := pompeii.Init(); err != nil {
+		return err
+	}
+
+	instance, err := pompeii.NewInstance(pompeii.InstanceOptions{
+		AppName:    "gpuinfo",
+		AppVersion: vk.MakeVersion(1, 0, 0),
+		APIVersion: vk.MakeVersion(1, 2, 0),
+		// The report's feature and driver queries need it when the loader
+		// only offers 1.0.
+		OptionalExtensions: []string{"VK_KHR_get_physical_device_properties2"},
+	})
+	if err != nil {
+		return err
+	}
+	defer instance.Destroy()
+
+	gpus, err := instance.EnumerateGPUs()
+	if err != nil {
+		return err
+	}
+	reports := make([]*pompeii.GPUReport, len(gpus))
+	for t := range gpus {
+		if reports[t], err = gpus[t].Report(); err != nil {
+			return err
+		}
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(reports)
+	}
+	for t, report := range reports {
+		if t > 0 {
+			fmt.Println()
+		}
+		fmt.Print(report)
+	}
+	return nil
+}
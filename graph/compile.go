@@ -0,0 +1,635 @@
+package graph
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	writeAccess     = AccessShaderWrite | AccessColorAttachmentWrite | AccessDepthStencilAttachmentWrite | AccessTransferWrite
+	attachmentUsage = ImageUsageColorAttachment | ImageUsageDepthStencilAttachment | ImageUsageInputAttachment
+)
+
+type ImageBarrier struct {
+	Resource             Resource
+	SrcAccess, DstAccess Access
+	OldLayout, NewLayout Layout
+	// Queue families are QueueFamilyIgnored unless ownership moves.
+	SrcQueueFamily, DstQueueFamily uint32
+}
+
+type BufferBarrier struct {
+	Resource                       Resource
+	SrcAccess, DstAccess           Access
+	SrcQueueFamily, DstQueueFamily uint32
+}
+
+// Barrier is recorded as a single pipeline barrier, one without image or
+// buffer barriers is an execution dependency only.
+type Barrier struct {
+	SrcStages, DstStages Stage
+	Images               []ImageBarrier
+	Buffers              []BufferBarrier
+}
+
+func (b *Barrier) Empty() bool {
+	return b.SrcStages == 0 && b.DstStages == 0
+}
+
+func (b *Barrier) add(src, dst Stage) {
+	b.SrcStages |= src
+	b.DstStages |= dst
+}
+
+type ScheduledPass struct {
+	Name  string
+	Queue Queue
+	// Index the pass was added to the graph at.
+	Index int
+	Batch int
+	// Before is recorded ahead of the pass, After behind it and holds
+	// releases to other queues and the final layouts of imported images.
+	Before Barrier
+	After  Barrier
+}
+
+// Wait is a semaphore wait on the end of another batch.
+type Wait struct {
+	Batch  int
+	Stages Stage
+}
+
+// Batch is a run of passes on one queue, submitted together.
+type Batch struct {
+	Queue  Queue
+	Passes []int
+	Waits  []Wait
+	// Signal is set when a later batch waits on this one.
+	Signal bool
+}
+
+// PhysicalImage is a transient image after aliasing, shared by Resources
+// whose lifetimes don't overlap.
+type PhysicalImage struct {
+	Info      ImageInfo
+	Usage     ImageUsage
+	Resources []Resource
+}
+
+// Plan is a compiled graph, passes in execution order.
+type Plan struct {
+	Passes  []ScheduledPass
+	Batches []Batch
+	// Culled names the passes nothing depended on.
+	Culled []string
+	Images []PhysicalImage
+
+	graph    *Graph
+	physical []int
+}
+
+type mergedAccess struct {
+	resource Resource
+	usageInfo
+}
+
+// merge folds all uses of a resource within a pass into one.
+func (g *Graph) merge(p *Pass) ([]mergedAccess, error) {
+	merged := []mergedAccess{}
+	index := map[Resource]int{}
+	for _, a := range p.accesses {
+		info := usages[a.usage]
+		t, ok := index[a.resource]
+		if !ok {
+			index[a.resource] = len(merged)
+			merged = append(merged, mergedAccess{
+				resource:  a.resource,
+				usageInfo: info,
+			})
+			continue
+		}
+		m := &merged[t]
+		if m.layout != info.layout {
+			return nil, errors.Errorf("graph: pass %s uses %s in both %s and %s", p.Name, g.resources[a.resource].name, m.layout, info.layout)
+		}
+		m.name += "|" + info.name
+		m.stages |= info.stages
+		m.access |= info.access
+		m.write = m.write || info.write
+		m.imageUsage |= info.imageUsage
+	}
+	return merged, nil
+}
+
+func (g *Graph) Compile(families QueueFamilies) (*Plan, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+
+	merged := make([][]mergedAccess, len(g.passes))
+	for t, p := range g.passes {
+		var err error
+		if merged[t], err = g.merge(p); err != nil {
+			return nil, err
+		}
+	}
+
+	kept := g.cull(merged)
+	plan := Plan{
+		graph: g,
+	}
+	for t, p := range g.passes {
+		if !kept[t] {
+			plan.Culled = append(plan.Culled, p.Name)
+		}
+	}
+	order := g.schedule(merged, kept)
+	plan.alias(merged, order)
+	plan.barriers(merged, order, families)
+
+	return &plan, nil
+}
+
+// cull walks the passes backwards from the outputs, keeping the ones that
+// write something a kept pass reads.
+func (g *Graph) cull(merged [][]mergedAccess) []bool {
+	needed := make([]bool, len(g.resources))
+	for t, r := range g.resources {
+		needed[t] = r.output
+	}
+
+	kept := make([]bool, len(g.passes))
+	for t := len(g.passes) - 1; t >= 0; t-- {
+		keep := g.passes[t].sideEffects
+		for _, a := range merged[t] {
+			keep = keep || (a.write && needed[a.resource])
+		}
+		if !keep {
+			continue
+		}
+		kept[t] = true
+		// Writes that also read, like blending, need the earlier contents.
+		for _, a := range merged[t] {
+			if !a.write || a.access&^writeAccess != 0 {
+				needed[a.resource] = true
+			}
+		}
+	}
+	return kept
+}
+
+// schedule orders the kept passes so every pass comes after the ones it
+// depends on, staying on the same queue as long as possible to keep the
+// number of batches down and otherwise in the order they were added.
+func (g *Graph) schedule(merged [][]mergedAccess, kept []bool) []int {
+	dependents := make([][]int, len(g.passes))
+	pending := make([]int, len(g.passes))
+	lastWrite := map[Resource]int{}
+	readers := map[Resource][]int{}
+	depend := func(pass, on int) {
+		dependents[on] = append(dependents[on], pass)
+		pending[pass]++
+	}
+	for t := range g.passes {
+		if !kept[t] {
+			continue
+		}
+		for _, a := range merged[t] {
+			if w, ok := lastWrite[a.resource]; ok {
+				depend(t, w)
+			}
+			if a.write {
+				for _, r := range readers[a.resource] {
+					depend(t, r)
+				}
+				lastWrite[a.resource] = t
+				readers[a.resource] = nil
+			} else {
+				readers[a.resource] = append(readers[a.resource], t)
+			}
+		}
+	}
+
+	ready := []int{}
+	for t := range g.passes {
+		if kept[t] && pending[t] == 0 {
+			ready = append(ready, t)
+		}
+	}
+	order := []int{}
+	for len(ready) > 0 {
+		pick := 0
+		for t, pass := range ready {
+			sameQueue := len(order) > 0 && g.passes[pass].Queue == g.passes[order[len(order)-1]].Queue
+			pickSameQueue := len(order) > 0 && g.passes[ready[pick]].Queue == g.passes[order[len(order)-1]].Queue
+			if (sameQueue && !pickSameQueue) || (sameQueue == pickSameQueue && pass < ready[pick]) {
+				pick = t
+			}
+		}
+		pass := ready[pick]
+		ready = append(ready[:pick], ready[pick+1:]...)
+		order = append(order, pass)
+		for _, dependent := range dependents[pass] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	return order
+}
+
+// alias hands out physical images to transient ones, reusing an image once
+// everything using it before has run. Only images with identical
+// descriptions share.
+func (p *Plan) alias(merged [][]mergedAccess, order []int) {
+	g := p.graph
+	p.physical = make([]int, len(g.resources))
+	for t := range p.physical {
+		p.physical[t] = -1
+	}
+
+	first := map[Resource]int{}
+	last := map[Resource]int{}
+	usage := map[Resource]ImageUsage{}
+	transient := []Resource{}
+	for position, t := range order {
+		for _, a := range merged[t] {
+			r := g.resources[a.resource]
+			if r.imported || !r.image {
+				continue
+			}
+			if _, ok := first[a.resource]; !ok {
+				first[a.resource] = position
+				transient = append(transient, a.resource)
+			}
+			last[a.resource] = position
+			usage[a.resource] |= a.imageUsage
+		}
+	}
+
+	free := []int{}
+	for _, r := range transient {
+		slot := -1
+		for s := range p.Images {
+			if p.Images[s].Info == g.resources[r].info && free[s] < first[r] {
+				slot = s
+				break
+			}
+		}
+		if slot == -1 {
+			p.Images = append(p.Images, PhysicalImage{
+				Info: g.resources[r].info,
+			})
+			free = append(free, 0)
+			slot = len(p.Images) - 1
+		}
+		p.Images[slot].Usage |= usage[r]
+		p.Images[slot].Resources = append(p.Images[slot].Resources, r)
+		free[slot] = last[r]
+		p.physical[r] = slot
+	}
+	for s := range p.Images {
+		if p.Images[s].Usage&^attachmentUsage == 0 {
+			p.Images[s].Usage |= ImageUsageTransientAttachment
+		}
+	}
+}
+
+// resourceState tracks what happened to an imported resource or physical
+// image so far.
+type resourceState struct {
+	occupant Resource
+	layout   Layout
+	queue    Queue
+	// written is false while the contents are undefined.
+	written bool
+	// Schedule positions of the last write, the reads since and the last
+	// access of any kind, -1 for none.
+	writer  int
+	readers []int
+	last    int
+
+	initialStages Stage
+	writeStages   Stage
+	writeAccess   Access
+	readStages    Stage
+	// visible holds what already saw the last write.
+	visibleStages Stage
+	visibleAccess Access
+}
+
+func (p *Plan) wait(batch, on int, stages Stage) {
+	if batch == on {
+		return
+	}
+	b := &p.Batches[batch]
+	p.Batches[on].Signal = true
+	for t := range b.Waits {
+		if b.Waits[t].Batch == on {
+			b.Waits[t].Stages |= stages
+			return
+		}
+	}
+	b.Waits = append(b.Waits, Wait{
+		Batch:  on,
+		Stages: stages,
+	})
+}
+
+func (p *Plan) barriers(merged [][]mergedAccess, order []int, families QueueFamilies) {
+	g := p.graph
+
+	p.Passes = make([]ScheduledPass, len(order))
+	for position, t := range order {
+		pass := g.passes[t]
+		if position == 0 || pass.Queue != g.passes[order[position-1]].Queue {
+			p.Batches = append(p.Batches, Batch{
+				Queue: pass.Queue,
+			})
+		}
+		batch := len(p.Batches) - 1
+		p.Batches[batch].Passes = append(p.Batches[batch].Passes, position)
+		p.Passes[position] = ScheduledPass{
+			Name:  pass.Name,
+			Queue: pass.Queue,
+			Index: t,
+			Batch: batch,
+		}
+	}
+
+	states := map[int]*resourceState{}
+	stateOf := func(r Resource) *resourceState {
+		key := int(r)
+		if p.physical[r] >= 0 {
+			key = len(g.resources) + p.physical[r]
+		}
+		st, ok := states[key]
+		if !ok {
+			st = &resourceState{
+				occupant:      r,
+				writer:        -1,
+				last:          -1,
+				initialStages: StageTopOfPipe,
+			}
+			if res := g.resources[r]; res.imported {
+				st.layout = res.external.Layout
+				st.queue = res.external.Queue
+				// Undefined images have no contents worth keeping.
+				st.written = !res.image || res.external.Layout != LayoutUndefined
+				st.initialStages = res.external.Stages
+			} else {
+				// Transient memory is reused by the next frame, whose first
+				// access has to come after all of this frame's.
+				st.writeStages = StageAllCommands
+				st.writeAccess = writeAccess
+			}
+			states[key] = st
+		}
+		return st
+	}
+
+	for position, t := range order {
+		sp := &p.Passes[position]
+		for _, a := range merged[t] {
+			res := g.resources[a.resource]
+			st := stateOf(a.resource)
+
+			// An aliased image starts over with its new occupant.
+			if st.occupant != a.resource {
+				st.occupant = a.resource
+				st.written = false
+			}
+			discard := !st.written
+			transition := res.image && st.layout != a.layout
+			oldLayout := st.layout
+			if discard {
+				oldLayout = LayoutUndefined
+			}
+
+			// Other queues are waited on through semaphores, which cover
+			// execution and memory alike.
+			prior := []int{}
+			if st.writer >= 0 {
+				prior = append(prior, st.writer)
+			}
+			if a.write || transition {
+				prior = append(prior, st.readers...)
+			}
+			for _, q := range prior {
+				if p.Passes[q].Queue != sp.Queue {
+					p.wait(sp.Batch, p.Passes[q].Batch, a.stages)
+				}
+			}
+			crossQueue := st.queue != sp.Queue
+			srcFamily, dstFamily := families.family(st.queue), families.family(sp.Queue)
+			transfer := crossQueue && srcFamily != dstFamily && !res.external.Concurrent && !discard
+
+			needed := false
+			var src Stage
+			var srcAccess Access
+			switch {
+			case crossQueue:
+				// Acquires and transitions have to chain with the wait.
+				needed = transition || transfer
+				src = a.stages
+			case a.write || transition:
+				src = st.writeStages | st.readStages
+				srcAccess = st.writeAccess
+				needed = src != 0 || transition
+			default:
+				src = st.writeStages
+				srcAccess = st.writeAccess
+				needed = src != 0 && (a.stages&^st.visibleStages != 0 || a.access&^st.visibleAccess != 0)
+			}
+
+			if needed {
+				if src == 0 {
+					src = st.initialStages
+				}
+				sp.Before.add(src, a.stages)
+
+				newLayout := a.layout
+				if !res.image {
+					newLayout = LayoutUndefined
+				}
+				queueFamilies := [2]uint32{QueueFamilyIgnored, QueueFamilyIgnored}
+				if transfer {
+					queueFamilies = [2]uint32{srcFamily, dstFamily}
+					srcAccess = 0
+					if releaseStages := st.writeStages | st.readStages; st.last >= 0 && releaseStages != 0 {
+						release := &p.Passes[st.last].After
+						release.add(releaseStages, StageBottomOfPipe)
+						if res.image {
+							release.Images = append(release.Images, ImageBarrier{
+								Resource:       a.resource,
+								SrcAccess:      st.writeAccess,
+								OldLayout:      oldLayout,
+								NewLayout:      newLayout,
+								SrcQueueFamily: srcFamily,
+								DstQueueFamily: dstFamily,
+							})
+						} else {
+							release.Buffers = append(release.Buffers, BufferBarrier{
+								Resource:       a.resource,
+								SrcAccess:      st.writeAccess,
+								SrcQueueFamily: srcFamily,
+								DstQueueFamily: dstFamily,
+							})
+						}
+					}
+				}
+
+				// Write after read without a transition only needs the
+				// execution dependency.
+				if transition || transfer || srcAccess != 0 || !a.write {
+					if res.image {
+						sp.Before.Images = append(sp.Before.Images, ImageBarrier{
+							Resource:       a.resource,
+							SrcAccess:      srcAccess,
+							DstAccess:      a.access,
+							OldLayout:      oldLayout,
+							NewLayout:      newLayout,
+							SrcQueueFamily: queueFamilies[0],
+							DstQueueFamily: queueFamilies[1],
+						})
+					} else {
+						sp.Before.Buffers = append(sp.Before.Buffers, BufferBarrier{
+							Resource:       a.resource,
+							SrcAccess:      srcAccess,
+							DstAccess:      a.access,
+							SrcQueueFamily: queueFamilies[0],
+							DstQueueFamily: queueFamilies[1],
+						})
+					}
+				}
+			}
+
+			if res.image {
+				st.layout = a.layout
+			}
+			st.queue = sp.Queue
+			st.last = position
+			switch {
+			case a.write:
+				st.written = true
+				st.writer = position
+				st.readers = nil
+				st.writeStages = a.stages
+				st.writeAccess = a.access & writeAccess
+				st.readStages = 0
+				st.visibleStages = a.stages
+				st.visibleAccess = a.access
+			case transition || crossQueue:
+				// Later accesses have to come after the transition or the
+				// semaphore wait, like after a write.
+				st.readers = append(st.readers, position)
+				st.writeStages = a.stages
+				st.writeAccess = 0
+				st.readStages = a.stages
+				st.visibleStages = a.stages
+				st.visibleAccess = a.access
+			default:
+				st.readers = append(st.readers, position)
+				st.readStages |= a.stages
+				if needed {
+					st.visibleStages |= a.stages
+					st.visibleAccess |= a.access
+				}
+			}
+		}
+	}
+
+	// Imported images end up in their final layout after their last use,
+	// images no kept pass touched are left alone.
+	for t, res := range g.resources {
+		st, ok := states[t]
+		if !ok || !res.imported || !res.image || st.last < 0 {
+			continue
+		}
+		final := res.external.FinalLayout
+		if final == LayoutUndefined || final == st.layout {
+			continue
+		}
+		after := &p.Passes[st.last].After
+		after.add(st.writeStages|st.readStages, StageBottomOfPipe)
+		after.Images = append(after.Images, ImageBarrier{
+			Resource:       Resource(t),
+			SrcAccess:      st.writeAccess,
+			OldLayout:      st.layout,
+			NewLayout:      final,
+			SrcQueueFamily: QueueFamilyIgnored,
+			DstQueueFamily: QueueFamilyIgnored,
+		})
+	}
+}
+
+func (p *Plan) Graph() *Graph {
+	return p.graph
+}
+
+// Physical returns the index into Images backing a transient image, false
+// for imported resources.
+func (p *Plan) Physical(r Resource) (int, bool) {
+	if r < 0 || int(r) >= len(p.physical) || p.physical[r] < 0 {
+		return 0, false
+	}
+	return p.physical[r], true
+}
+
+func (p *Plan) writeBarrier(buffer *bytes.Buffer, label string, b Barrier) {
+	if b.Empty() {
+		return
+	}
+	buffer.WriteString(fmt.Sprintf("    %s %s -> %s\n", label, b.SrcStages, b.DstStages))
+	family := func(src, dst uint32) string {
+		if src == QueueFamilyIgnored && dst == QueueFamilyIgnored {
+			return ""
+		}
+		return fmt.Sprintf(" family %d -> %d", src, dst)
+	}
+	for _, image := range b.Images {
+		buffer.WriteString(fmt.Sprintf("      image %s %s -> %s, %s -> %s%s\n",
+			p.graph.Name(image.Resource), image.OldLayout, image.NewLayout, image.SrcAccess, image.DstAccess,
+			family(image.SrcQueueFamily, image.DstQueueFamily)))
+	}
+	for _, buf := range b.Buffers {
+		buffer.WriteString(fmt.Sprintf("      buffer %s %s -> %s%s\n",
+			p.graph.Name(buf.Resource), buf.SrcAccess, buf.DstAccess,
+			family(buf.SrcQueueFamily, buf.DstQueueFamily)))
+	}
+}
+
+// String lists batches, passes and their barriers.
+func (p *Plan) String() string {
+	buffer := bytes.Buffer{}
+	for t, batch := range p.Batches {
+		buffer.WriteString(fmt.Sprintf("batch %d on %s", t, batch.Queue))
+		for _, wait := range batch.Waits {
+			buffer.WriteString(fmt.Sprintf(", waits on %d at %s", wait.Batch, wait.Stages))
+		}
+		if batch.Signal {
+			buffer.WriteString(", signals")
+		}
+		buffer.WriteString("\n")
+		for _, position := range batch.Passes {
+			pass := p.Passes[position]
+			buffer.WriteString(fmt.Sprintf("  pass %s\n", pass.Name))
+			p.writeBarrier(&buffer, "before", pass.Before)
+			p.writeBarrier(&buffer, "after", pass.After)
+		}
+	}
+	for t, image := range p.Images {
+		names := []string{}
+		for _, r := range image.Resources {
+			names = append(names, p.graph.Name(r))
+		}
+		buffer.WriteString(fmt.Sprintf("image %d %dx%d format %d: %v\n", t, image.Info.Width, image.Info.Height, image.Info.Format, names))
+	}
+	if len(p.Culled) > 0 {
+		buffer.WriteString(fmt.Sprintf("culled %v\n", p.Culled))
+	}
+	return buffer.String()
+}
@@ -0,0 +1,400 @@
+package graph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var (
+	colorInfo = ImageInfo{Format: 44, Width: 640, Height: 480, Samples: 1}
+	depthInfo = ImageInfo{Format: 126, Width: 640, Height: 480, Samples: 1}
+
+	separateFamilies = QueueFamilies{Graphics: 0, Compute: 1, Transfer: 2}
+	sharedFamilies   = QueueFamilies{}
+)
+
+// importSwapchain imports an image acquired with a semaphore waited on at
+// the color output stage, like a swapchain image, and presents it.
+func importSwapchain(g *Graph) Resource {
+	swapchain := g.ImportImage("swapchain", colorInfo, External{
+		Layout: LayoutUndefined,
+		Stages: StageColorAttachmentOutput,
+	})
+	g.Present(swapchain)
+	return swapchain
+}
+
+func mustCompile(t *testing.T, g *Graph, families QueueFamilies) *Plan {
+	t.Helper()
+	plan, err := g.Compile(families)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+func checkBarrier(t *testing.T, label string, got, want Barrier) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s barrier\n%+v\nwant\n%+v", label, got, want)
+	}
+}
+
+func TestCompileSwapchain(t *testing.T) {
+	g := New()
+	swapchain := importSwapchain(g)
+	g.AddPass("draw", QueueGraphics).Write(swapchain, ColorAttachment)
+
+	plan := mustCompile(t, g, sharedFamilies)
+	if len(plan.Passes) != 1 || len(plan.Batches) != 1 {
+		t.Fatalf("%d passes in %d batches, want 1 in 1", len(plan.Passes), len(plan.Batches))
+	}
+	draw := plan.Passes[0]
+	checkBarrier(t, "before draw", draw.Before, Barrier{
+		SrcStages: StageColorAttachmentOutput,
+		DstStages: StageColorAttachmentOutput,
+		Images: []ImageBarrier{
+			{
+				Resource:       swapchain,
+				DstAccess:      AccessColorAttachmentRead | AccessColorAttachmentWrite,
+				OldLayout:      LayoutUndefined,
+				NewLayout:      LayoutColorAttachmentOptimal,
+				SrcQueueFamily: QueueFamilyIgnored,
+				DstQueueFamily: QueueFamilyIgnored,
+			},
+		},
+	})
+	checkBarrier(t, "after draw", draw.After, Barrier{
+		SrcStages: StageColorAttachmentOutput,
+		DstStages: StageBottomOfPipe,
+		Images: []ImageBarrier{
+			{
+				Resource:       swapchain,
+				SrcAccess:      AccessColorAttachmentWrite,
+				OldLayout:      LayoutColorAttachmentOptimal,
+				NewLayout:      LayoutPresentSrc,
+				SrcQueueFamily: QueueFamilyIgnored,
+				DstQueueFamily: QueueFamilyIgnored,
+			},
+		},
+	})
+}
+
+func TestCompileCulling(t *testing.T) {
+	g := New()
+	swapchain := importSwapchain(g)
+	unused := g.CreateImage("unused", colorInfo)
+	counters := g.ImportBuffer("counters", 64, External{})
+
+	g.AddPass("dead", QueueGraphics).Write(unused, ColorAttachment)
+	g.AddPass("stats", QueueCompute).Write(counters, StorageBufferWriteCompute).SideEffects()
+	g.AddPass("draw", QueueGraphics).Write(swapchain, ColorAttachment)
+
+	plan := mustCompile(t, g, sharedFamilies)
+	if !reflect.DeepEqual(plan.Culled, []string{"dead"}) {
+		t.Errorf("culled %v, want [dead]", plan.Culled)
+	}
+	names := []string{}
+	for _, pass := range plan.Passes {
+		names = append(names, pass.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"stats", "draw"}) {
+		t.Errorf("scheduled %v, want [stats draw]", names)
+	}
+	if len(plan.Images) != 0 {
+		t.Errorf("%d physical images for culled passes only", len(plan.Images))
+	}
+}
+
+func TestCompileTransientReuse(t *testing.T) {
+	g := New()
+	swapchain := importSwapchain(g)
+	scene := g.CreateImage("scene", colorInfo)
+	g.AddPass("scene", QueueGraphics).Write(scene, ColorAttachment)
+	g.AddPass("post", QueueGraphics).Read(scene, SampledFragment).Write(swapchain, ColorAttachment)
+
+	// The previous frame in flight may still write the same memory.
+	plan := mustCompile(t, g, sharedFamilies)
+	checkBarrier(t, "before scene", plan.Passes[0].Before, Barrier{
+		SrcStages: StageAllCommands,
+		DstStages: StageColorAttachmentOutput,
+		Images: []ImageBarrier{
+			{
+				Resource:       scene,
+				SrcAccess:      writeAccess,
+				DstAccess:      AccessColorAttachmentRead | AccessColorAttachmentWrite,
+				OldLayout:      LayoutUndefined,
+				NewLayout:      LayoutColorAttachmentOptimal,
+				SrcQueueFamily: QueueFamilyIgnored,
+				DstQueueFamily: QueueFamilyIgnored,
+			},
+		},
+	})
+}
+
+func TestCompileReadAfterWrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		write      Usage
+		read       Usage
+		srcStages  Stage
+		srcAccess  Access
+		dstStages  Stage
+		dstAccess  Access
+		readLayout Layout
+	}{
+		{
+			name:       "color attachment sampled",
+			write:      ColorAttachment,
+			read:       SampledFragment,
+			srcStages:  StageColorAttachmentOutput,
+			srcAccess:  AccessColorAttachmentWrite,
+			dstStages:  StageFragmentShader,
+			dstAccess:  AccessShaderRead,
+			readLayout: LayoutShaderReadOnlyOptimal,
+		},
+		{
+			name:       "fragment storage write sampled",
+			write:      StorageImageWriteFragment,
+			read:       SampledFragment,
+			srcStages:  StageFragmentShader,
+			srcAccess:  AccessShaderWrite,
+			dstStages:  StageFragmentShader,
+			dstAccess:  AccessShaderRead,
+			readLayout: LayoutShaderReadOnlyOptimal,
+		},
+		{
+			name:       "fragment storage write read in compute",
+			write:      StorageImageWriteFragment,
+			read:       StorageImageReadCompute,
+			srcStages:  StageFragmentShader,
+			srcAccess:  AccessShaderWrite,
+			dstStages:  StageComputeShader,
+			dstAccess:  AccessShaderRead,
+			readLayout: LayoutGeneral,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := New()
+			swapchain := importSwapchain(g)
+			scene := g.CreateImage("scene", colorInfo)
+			g.AddPass("scene", QueueGraphics).Write(scene, test.write)
+			g.AddPass("post", QueueGraphics).Read(scene, test.read).Write(swapchain, ColorAttachment)
+
+			plan := mustCompile(t, g, sharedFamilies)
+			if len(plan.Passes) != 2 || len(plan.Batches) != 1 {
+				t.Fatalf("%d passes in %d batches, want 2 in 1", len(plan.Passes), len(plan.Batches))
+			}
+			before := plan.Passes[1].Before
+			if before.SrcStages&test.srcStages == 0 || before.DstStages&test.dstStages == 0 {
+				t.Errorf("post waits on %s at %s, want %s at %s", before.SrcStages, before.DstStages, test.srcStages, test.dstStages)
+			}
+			want := ImageBarrier{
+				Resource:       scene,
+				SrcAccess:      test.srcAccess,
+				DstAccess:      test.dstAccess,
+				OldLayout:      usages[test.write].layout,
+				NewLayout:      test.readLayout,
+				SrcQueueFamily: QueueFamilyIgnored,
+				DstQueueFamily: QueueFamilyIgnored,
+			}
+			if len(before.Images) == 0 || !reflect.DeepEqual(before.Images[0], want) {
+				t.Errorf("post barriers %+v, want %+v first", before.Images, want)
+			}
+			if stages := plan.Passes[0].Before.SrcStages | plan.Passes[0].Before.DstStages; test.write != ColorAttachment && stages&StageComputeShader != 0 {
+				t.Errorf("fragment write synchronized with %s", stages)
+			}
+		})
+	}
+}
+
+func TestCompileQueueOwnership(t *testing.T) {
+	build := func() (*Graph, Resource) {
+		g := New()
+		swapchain := importSwapchain(g)
+		particles := g.ImportBuffer("particles", 1024, External{
+			Queue: QueueCompute,
+		})
+		g.AddPass("simulate", QueueCompute).Write(particles, StorageBufferWriteCompute)
+		g.AddPass("draw", QueueGraphics).Read(particles, VertexBuffer).Write(swapchain, ColorAttachment)
+		return g, particles
+	}
+
+	t.Run("separate families", func(t *testing.T) {
+		g, particles := build()
+		plan := mustCompile(t, g, separateFamilies)
+		if len(plan.Batches) != 2 {
+			t.Fatalf("%d batches, want 2", len(plan.Batches))
+		}
+		if !plan.Batches[0].Signal || !reflect.DeepEqual(plan.Batches[1].Waits, []Wait{{Batch: 0, Stages: StageVertexInput}}) {
+			t.Errorf("batches %+v, want graphics waiting on compute at vertex input", plan.Batches)
+		}
+
+		simulate, draw := plan.Passes[0], plan.Passes[1]
+		checkBarrier(t, "before simulate", simulate.Before, Barrier{})
+		checkBarrier(t, "release after simulate", simulate.After, Barrier{
+			SrcStages: StageComputeShader,
+			DstStages: StageBottomOfPipe,
+			Buffers: []BufferBarrier{
+				{
+					Resource:       particles,
+					SrcAccess:      AccessShaderWrite,
+					SrcQueueFamily: separateFamilies.Compute,
+					DstQueueFamily: separateFamilies.Graphics,
+				},
+			},
+		})
+		if len(draw.Before.Buffers) != 1 || draw.Before.DstStages&StageVertexInput == 0 {
+			t.Fatalf("draw barrier %+v, want an acquire at vertex input", draw.Before)
+		}
+		if acquire := draw.Before.Buffers[0]; !reflect.DeepEqual(acquire, BufferBarrier{
+			Resource:       particles,
+			DstAccess:      AccessVertexAttributeRead,
+			SrcQueueFamily: separateFamilies.Compute,
+			DstQueueFamily: separateFamilies.Graphics,
+		}) {
+			t.Errorf("acquire %+v", acquire)
+		}
+	})
+
+	t.Run("shared family", func(t *testing.T) {
+		g, _ := build()
+		plan := mustCompile(t, g, sharedFamilies)
+		if len(plan.Batches) != 2 || len(plan.Batches[1].Waits) != 1 {
+			t.Fatalf("batches %+v, want graphics waiting on compute", plan.Batches)
+		}
+		for _, pass := range plan.Passes {
+			if len(pass.Before.Buffers) != 0 || len(pass.After.Buffers) != 0 {
+				t.Errorf("pass %s transfers ownership within one family", pass.Name)
+			}
+		}
+	})
+}
+
+func TestCompileAliasing(t *testing.T) {
+	g := New()
+	swapchain := importSwapchain(g)
+	first := g.CreateImage("first", colorInfo)
+	second := g.CreateImage("second", colorInfo)
+	depth := g.CreateImage("depth", depthInfo)
+
+	g.AddPass("first", QueueGraphics).Write(first, ColorAttachment).Write(depth, DepthAttachment)
+	g.AddPass("compose first", QueueGraphics).Read(first, SampledFragment).Write(swapchain, ColorAttachment)
+	g.AddPass("second", QueueGraphics).Write(second, ColorAttachment)
+	g.AddPass("compose second", QueueGraphics).Read(second, SampledFragment).Write(swapchain, ColorAttachment)
+
+	plan := mustCompile(t, g, sharedFamilies)
+	want := []PhysicalImage{
+		{
+			Info:      colorInfo,
+			Usage:     ImageUsageColorAttachment | ImageUsageSampled,
+			Resources: []Resource{first, second},
+		},
+		{
+			Info:      depthInfo,
+			Usage:     ImageUsageDepthStencilAttachment | ImageUsageTransientAttachment,
+			Resources: []Resource{depth},
+		},
+	}
+	if !reflect.DeepEqual(plan.Images, want) {
+		t.Errorf("images\n%+v\nwant\n%+v", plan.Images, want)
+	}
+	for r, physical := range map[Resource]int{first: 0, second: 0, depth: 1} {
+		if got, ok := plan.Physical(r); !ok || got != physical {
+			t.Errorf("%s backed by image %d, want %d", g.Name(r), got, physical)
+		}
+	}
+	if _, ok := plan.Physical(swapchain); ok {
+		t.Error("imported image backed by a physical image")
+	}
+
+	// The second occupant discards the contents, but waits for the reads of
+	// the first one.
+	checkBarrier(t, "before second", plan.Passes[2].Before, Barrier{
+		SrcStages: StageFragmentShader,
+		DstStages: StageColorAttachmentOutput,
+		Images: []ImageBarrier{
+			{
+				Resource:       second,
+				DstAccess:      AccessColorAttachmentRead | AccessColorAttachmentWrite,
+				OldLayout:      LayoutUndefined,
+				NewLayout:      LayoutColorAttachmentOptimal,
+				SrcQueueFamily: QueueFamilyIgnored,
+				DstQueueFamily: QueueFamilyIgnored,
+			},
+		},
+	})
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(g *Graph)
+		err   string
+	}{
+		{
+			name: "fragment uniform on compute queue",
+			build: func(g *Graph) {
+				globals := g.ImportBuffer("globals", 256, External{})
+				g.AddPass("simulate", QueueCompute).Read(globals, UniformFragment).SideEffects()
+			},
+			err: "Compute queue can not run",
+		},
+		{
+			name: "sampling on transfer queue",
+			build: func(g *Graph) {
+				texture := g.CreateImage("texture", colorInfo)
+				g.AddPass("copy", QueueTransfer).Read(texture, SampledCompute).SideEffects()
+			},
+			err: "Transfer queue can not run",
+		},
+		{
+			name: "writing a read usage",
+			build: func(g *Graph) {
+				texture := g.CreateImage("texture", colorInfo)
+				g.AddPass("draw", QueueGraphics).Write(texture, SampledFragment)
+			},
+			err: "only reads",
+		},
+		{
+			name: "buffer as image",
+			build: func(g *Graph) {
+				buffer := g.ImportBuffer("buffer", 16, External{})
+				g.AddPass("draw", QueueGraphics).Write(buffer, ColorAttachment)
+			},
+			err: "wrong resource kind",
+		},
+		{
+			name: "two layouts in one pass",
+			build: func(g *Graph) {
+				swapchain := importSwapchain(g)
+				g.AddPass("draw", QueueGraphics).Write(swapchain, ColorAttachment).Read(swapchain, SampledFragment)
+			},
+			err: "uses swapchain in both",
+		},
+		{
+			name: "presenting a transient image",
+			build: func(g *Graph) {
+				g.Present(g.CreateImage("scene", colorInfo))
+			},
+			err: "only imported images",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := New()
+			test.build(g)
+			_, err := g.Compile(sharedFamilies)
+			if err == nil {
+				t.Fatal("compiled without error")
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error %q, want %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+// Package graph builds a frame out of passes that declare how they use
+// images and buffers, and compiles it into an execution order with the
+// barriers, queue ownership transfers and semaphore waits in between. It
+// doesn't touch Vulkan itself, pompeii records the compiled plan.
+package graph
+
+import (
+	"github.com/pkg/errors"
+)
+
+type Queue int
+
+const (
+	QueueGraphics Queue = iota
+	QueueCompute
+	QueueTransfer
+)
+
+func (q Queue) String() string {
+	switch q {
+	case QueueGraphics:
+		return "Graphics"
+	case QueueCompute:
+		return "Compute"
+	case QueueTransfer:
+		return "Transfer"
+	default:
+		return "Unknown"
+	}
+}
+
+// QueueFamilies maps queues onto the families they were created from,
+// ownership is only transferred between different families.
+type QueueFamilies struct {
+	Graphics uint32
+	Compute  uint32
+	Transfer uint32
+}
+
+func (f QueueFamilies) family(queue Queue) uint32 {
+	switch queue {
+	case QueueCompute:
+		return f.Compute
+	case QueueTransfer:
+		return f.Transfer
+	default:
+		return f.Graphics
+	}
+}
+
+// stages are the pipeline stages a queue can run, graphics queues run them
+// all. Compute queues can also dispatch indirectly.
+func (q Queue) stages() Stage {
+	always := StageTopOfPipe | StageBottomOfPipe | StageAllCommands | StageTransfer
+	switch q {
+	case QueueCompute:
+		return always | StageDrawIndirect | StageComputeShader
+	case QueueTransfer:
+		return always
+	default:
+		return ^Stage(0)
+	}
+}
+
+// Resource is an image or buffer of one graph.
+type Resource int
+
+type ImageInfo struct {
+	// Format as a vk.Format value.
+	Format        uint32
+	Width, Height uint32
+	// Samples defaults to 1.
+	Samples uint32
+}
+
+// External describes the state of an imported resource around the frame.
+type External struct {
+	// Layout the image is in when the frame starts.
+	Layout Layout
+	// Stages that last touched the resource, or the stage a semaphore
+	// guarding it is waited on, such as color output for a swapchain image.
+	// Defaults to top of pipe.
+	Stages Stage
+	// Queue owning the resource when the frame starts. A release on another
+	// family is up to the caller, the graph only acquires.
+	Queue Queue
+	// FinalLayout the image is left in, Undefined keeps whatever the last
+	// pass needed.
+	FinalLayout Layout
+	// Concurrent resources are shared between queue families and never
+	// transferred.
+	Concurrent bool
+}
+
+type resource struct {
+	name     string
+	image    bool
+	imported bool
+	output   bool
+	info     ImageInfo
+	size     uint64
+	external External
+}
+
+type access struct {
+	resource Resource
+	usage    Usage
+}
+
+type Pass struct {
+	Name  string
+	Queue Queue
+
+	graph       *Graph
+	index       int
+	accesses    []access
+	sideEffects bool
+}
+
+// Graph is built once per frame layout and compiled into a Plan. Errors
+// while building are returned by Compile.
+type Graph struct {
+	resources []resource
+	passes    []*Pass
+	err       error
+}
+
+func New() *Graph {
+	return &Graph{}
+}
+
+func (g *Graph) fail(err error) {
+	if g.err == nil {
+		g.err = err
+	}
+}
+
+func (g *Graph) add(r resource) Resource {
+	g.resources = append(g.resources, r)
+	return Resource(len(g.resources) - 1)
+}
+
+// CreateImage adds a transient image that only lives within the frame, it
+// may share its memory with other transient images. Its first access waits
+// for all earlier work on its queue, which covers the previous frame still
+// using the memory.
+func (g *Graph) CreateImage(name string, info ImageInfo) Resource {
+	if info.Samples == 0 {
+		info.Samples = 1
+	}
+	return g.add(resource{
+		name:  name,
+		image: true,
+		info:  info,
+	})
+}
+
+func (g *Graph) ImportImage(name string, info ImageInfo, external External) Resource {
+	if info.Samples == 0 {
+		info.Samples = 1
+	}
+	if external.Stages == 0 {
+		external.Stages = StageTopOfPipe
+	}
+	return g.add(resource{
+		name:     name,
+		image:    true,
+		imported: true,
+		info:     info,
+		external: external,
+	})
+}
+
+func (g *Graph) ImportBuffer(name string, size uint64, external External) Resource {
+	if external.Stages == 0 {
+		external.Stages = StageTopOfPipe
+	}
+	return g.add(resource{
+		name:     name,
+		imported: true,
+		size:     size,
+		external: external,
+	})
+}
+
+func (g *Graph) valid(r Resource) bool {
+	if r < 0 || int(r) >= len(g.resources) {
+		g.fail(errors.Errorf("graph: unknown resource %d", r))
+		return false
+	}
+	return true
+}
+
+// Output keeps the passes producing r from being culled.
+func (g *Graph) Output(r Resource) {
+	if g.valid(r) {
+		g.resources[r].output = true
+	}
+}
+
+// Present outputs an imported image and leaves it ready for presentation.
+func (g *Graph) Present(r Resource) {
+	if !g.valid(r) {
+		return
+	}
+	if !g.resources[r].imported || !g.resources[r].image {
+		g.fail(errors.Errorf("graph: presenting %s, only imported images can be presented", g.resources[r].name))
+		return
+	}
+	g.resources[r].output = true
+	g.resources[r].external.FinalLayout = LayoutPresentSrc
+}
+
+func (g *Graph) Name(r Resource) string {
+	if r < 0 || int(r) >= len(g.resources) {
+		return "unknown"
+	}
+	return g.resources[r].name
+}
+
+// Image returns the description of an image resource.
+func (g *Graph) Image(r Resource) (ImageInfo, bool) {
+	if r < 0 || int(r) >= len(g.resources) || !g.resources[r].image {
+		return ImageInfo{}, false
+	}
+	return g.resources[r].info, true
+}
+
+// AddPass adds a pass, passes are ordered as added unless the graph finds
+// a better order that keeps their dependencies.
+func (g *Graph) AddPass(name string, queue Queue) *Pass {
+	p := Pass{
+		Name:  name,
+		Queue: queue,
+		graph: g,
+		index: len(g.passes),
+	}
+	g.passes = append(g.passes, &p)
+	return &p
+}
+
+func (p *Pass) use(r Resource, usage Usage, write bool) *Pass {
+	g := p.graph
+	if !g.valid(r) {
+		return p
+	}
+	info, ok := usages[usage]
+	switch {
+	case !ok:
+		g.fail(errors.Errorf("graph: pass %s uses %s with unknown usage %d", p.Name, g.resources[r].name, usage))
+	case info.write != write && write:
+		g.fail(errors.Errorf("graph: pass %s writes %s as %s, which only reads", p.Name, g.resources[r].name, usage))
+	case info.write != write:
+		g.fail(errors.Errorf("graph: pass %s reads %s as %s, which writes", p.Name, g.resources[r].name, usage))
+	case info.image != g.resources[r].image:
+		g.fail(errors.Errorf("graph: pass %s uses %s as %s, wrong resource kind", p.Name, g.resources[r].name, usage))
+	case info.stages&^p.Queue.stages() != 0:
+		g.fail(errors.Errorf("graph: pass %s uses %s as %s, which the %s queue can not run", p.Name, g.resources[r].name, usage, p.Queue))
+	default:
+		p.accesses = append(p.accesses, access{
+			resource: r,
+			usage:    usage,
+		})
+	}
+	return p
+}
+
+func (p *Pass) Read(r Resource, usage Usage) *Pass {
+	return p.use(r, usage, false)
+}
+
+func (p *Pass) Write(r Resource, usage Usage) *Pass {
+	return p.use(r, usage, true)
+}
+
+// SideEffects keeps the pass even if nothing reads what it writes.
+func (p *Pass) SideEffects() *Pass {
+	p.sideEffects = true
+	return p
+}
@@ -0,0 +1,375 @@
+package graph
+
+import (
+	"strings"
+)
+
+// Layout values match vk.ImageLayout.
+type Layout uint32
+
+const (
+	LayoutUndefined                     Layout = 0
+	LayoutGeneral                       Layout = 1
+	LayoutColorAttachmentOptimal        Layout = 2
+	LayoutDepthStencilAttachmentOptimal Layout = 3
+	LayoutDepthStencilReadOnlyOptimal   Layout = 4
+	LayoutShaderReadOnlyOptimal         Layout = 5
+	LayoutTransferSrcOptimal            Layout = 6
+	LayoutTransferDstOptimal            Layout = 7
+	LayoutPresentSrc                    Layout = 1000001002
+)
+
+func (l Layout) String() string {
+	switch l {
+	case LayoutUndefined:
+		return "Undefined"
+	case LayoutGeneral:
+		return "General"
+	case LayoutColorAttachmentOptimal:
+		return "ColorAttachmentOptimal"
+	case LayoutDepthStencilAttachmentOptimal:
+		return "DepthStencilAttachmentOptimal"
+	case LayoutDepthStencilReadOnlyOptimal:
+		return "DepthStencilReadOnlyOptimal"
+	case LayoutShaderReadOnlyOptimal:
+		return "ShaderReadOnlyOptimal"
+	case LayoutTransferSrcOptimal:
+		return "TransferSrcOptimal"
+	case LayoutTransferDstOptimal:
+		return "TransferDstOptimal"
+	case LayoutPresentSrc:
+		return "PresentSrc"
+	default:
+		return "Unknown"
+	}
+}
+
+// Stage values match vk.PipelineStageFlagBits.
+type Stage uint32
+
+const (
+	StageTopOfPipe             Stage = 0x1
+	StageDrawIndirect          Stage = 0x2
+	StageVertexInput           Stage = 0x4
+	StageVertexShader          Stage = 0x8
+	StageFragmentShader        Stage = 0x80
+	StageEarlyFragmentTests    Stage = 0x100
+	StageLateFragmentTests     Stage = 0x200
+	StageColorAttachmentOutput Stage = 0x400
+	StageComputeShader         Stage = 0x800
+	StageTransfer              Stage = 0x1000
+	StageBottomOfPipe          Stage = 0x2000
+	StageAllCommands           Stage = 0x10000
+)
+
+// Access values match vk.AccessFlagBits.
+type Access uint32
+
+const (
+	AccessIndirectCommandRead         Access = 0x1
+	AccessIndexRead                   Access = 0x2
+	AccessVertexAttributeRead         Access = 0x4
+	AccessUniformRead                 Access = 0x8
+	AccessInputAttachmentRead         Access = 0x10
+	AccessShaderRead                  Access = 0x20
+	AccessShaderWrite                 Access = 0x40
+	AccessColorAttachmentRead         Access = 0x80
+	AccessColorAttachmentWrite        Access = 0x100
+	AccessDepthStencilAttachmentRead  Access = 0x200
+	AccessDepthStencilAttachmentWrite Access = 0x400
+	AccessTransferRead                Access = 0x800
+	AccessTransferWrite               Access = 0x1000
+)
+
+// ImageUsage values match vk.ImageUsageFlagBits.
+type ImageUsage uint32
+
+const (
+	ImageUsageTransferSrc            ImageUsage = 0x1
+	ImageUsageTransferDst            ImageUsage = 0x2
+	ImageUsageSampled                ImageUsage = 0x4
+	ImageUsageStorage                ImageUsage = 0x8
+	ImageUsageColorAttachment        ImageUsage = 0x10
+	ImageUsageDepthStencilAttachment ImageUsage = 0x20
+	ImageUsageTransientAttachment    ImageUsage = 0x40
+	ImageUsageInputAttachment        ImageUsage = 0x80
+)
+
+// QueueFamilyIgnored matches vk.QueueFamilyIgnored.
+const QueueFamilyIgnored = ^uint32(0)
+
+// Usage is how a pass touches a resource.
+type Usage int
+
+const (
+	ColorAttachment Usage = iota
+	// DepthAttachment tests and writes depth.
+	DepthAttachment
+	// DepthRead tests depth without writing it.
+	DepthRead
+	InputAttachment
+	// Shader usages are split by the stage accessing the resource, a pass
+	// using a resource from several stages declares each of them.
+	SampledFragment
+	SampledCompute
+	StorageImageReadFragment
+	StorageImageReadCompute
+	StorageImageWriteFragment
+	StorageImageWriteCompute
+	TransferSrc
+	TransferDst
+	VertexBuffer
+	IndexBuffer
+	IndirectBuffer
+	UniformVertex
+	UniformFragment
+	UniformCompute
+	StorageBufferReadVertex
+	StorageBufferReadFragment
+	StorageBufferReadCompute
+	StorageBufferWriteFragment
+	StorageBufferWriteCompute
+)
+
+type usageInfo struct {
+	name   string
+	stages Stage
+	access Access
+	write  bool
+	// image usages have a layout and image usage flags, buffer ones have
+	// neither.
+	image      bool
+	layout     Layout
+	imageUsage ImageUsage
+}
+
+var usages = map[Usage]usageInfo{
+	ColorAttachment: {
+		name:       "ColorAttachment",
+		stages:     StageColorAttachmentOutput,
+		access:     AccessColorAttachmentRead | AccessColorAttachmentWrite,
+		write:      true,
+		image:      true,
+		layout:     LayoutColorAttachmentOptimal,
+		imageUsage: ImageUsageColorAttachment,
+	},
+	DepthAttachment: {
+		name:       "DepthAttachment",
+		stages:     StageEarlyFragmentTests | StageLateFragmentTests,
+		access:     AccessDepthStencilAttachmentRead | AccessDepthStencilAttachmentWrite,
+		write:      true,
+		image:      true,
+		layout:     LayoutDepthStencilAttachmentOptimal,
+		imageUsage: ImageUsageDepthStencilAttachment,
+	},
+	DepthRead: {
+		name:       "DepthRead",
+		stages:     StageEarlyFragmentTests | StageLateFragmentTests,
+		access:     AccessDepthStencilAttachmentRead,
+		image:      true,
+		layout:     LayoutDepthStencilReadOnlyOptimal,
+		imageUsage: ImageUsageDepthStencilAttachment,
+	},
+	InputAttachment: {
+		name:       "InputAttachment",
+		stages:     StageFragmentShader,
+		access:     AccessInputAttachmentRead,
+		image:      true,
+		layout:     LayoutShaderReadOnlyOptimal,
+		imageUsage: ImageUsageInputAttachment,
+	},
+	SampledFragment: {
+		name:       "SampledFragment",
+		stages:     StageFragmentShader,
+		access:     AccessShaderRead,
+		image:      true,
+		layout:     LayoutShaderReadOnlyOptimal,
+		imageUsage: ImageUsageSampled,
+	},
+	SampledCompute: {
+		name:       "SampledCompute",
+		stages:     StageComputeShader,
+		access:     AccessShaderRead,
+		image:      true,
+		layout:     LayoutShaderReadOnlyOptimal,
+		imageUsage: ImageUsageSampled,
+	},
+	StorageImageReadFragment: {
+		name:       "StorageImageReadFragment",
+		stages:     StageFragmentShader,
+		access:     AccessShaderRead,
+		image:      true,
+		layout:     LayoutGeneral,
+		imageUsage: ImageUsageStorage,
+	},
+	StorageImageReadCompute: {
+		name:       "StorageImageReadCompute",
+		stages:     StageComputeShader,
+		access:     AccessShaderRead,
+		image:      true,
+		layout:     LayoutGeneral,
+		imageUsage: ImageUsageStorage,
+	},
+	StorageImageWriteFragment: {
+		name:       "StorageImageWriteFragment",
+		stages:     StageFragmentShader,
+		access:     AccessShaderRead | AccessShaderWrite,
+		write:      true,
+		image:      true,
+		layout:     LayoutGeneral,
+		imageUsage: ImageUsageStorage,
+	},
+	StorageImageWriteCompute: {
+		name:       "StorageImageWriteCompute",
+		stages:     StageComputeShader,
+		access:     AccessShaderRead | AccessShaderWrite,
+		write:      true,
+		image:      true,
+		layout:     LayoutGeneral,
+		imageUsage: ImageUsageStorage,
+	},
+	TransferSrc: {
+		name:       "TransferSrc",
+		stages:     StageTransfer,
+		access:     AccessTransferRead,
+		image:      true,
+		layout:     LayoutTransferSrcOptimal,
+		imageUsage: ImageUsageTransferSrc,
+	},
+	TransferDst: {
+		name:       "TransferDst",
+		stages:     StageTransfer,
+		access:     AccessTransferWrite,
+		write:      true,
+		image:      true,
+		layout:     LayoutTransferDstOptimal,
+		imageUsage: ImageUsageTransferDst,
+	},
+	VertexBuffer: {
+		name:   "VertexBuffer",
+		stages: StageVertexInput,
+		access: AccessVertexAttributeRead,
+	},
+	IndexBuffer: {
+		name:   "IndexBuffer",
+		stages: StageVertexInput,
+		access: AccessIndexRead,
+	},
+	IndirectBuffer: {
+		name:   "IndirectBuffer",
+		stages: StageDrawIndirect,
+		access: AccessIndirectCommandRead,
+	},
+	UniformVertex: {
+		name:   "UniformVertex",
+		stages: StageVertexShader,
+		access: AccessUniformRead,
+	},
+	UniformFragment: {
+		name:   "UniformFragment",
+		stages: StageFragmentShader,
+		access: AccessUniformRead,
+	},
+	UniformCompute: {
+		name:   "UniformCompute",
+		stages: StageComputeShader,
+		access: AccessUniformRead,
+	},
+	StorageBufferReadVertex: {
+		name:   "StorageBufferReadVertex",
+		stages: StageVertexShader,
+		access: AccessShaderRead,
+	},
+	StorageBufferReadFragment: {
+		name:   "StorageBufferReadFragment",
+		stages: StageFragmentShader,
+		access: AccessShaderRead,
+	},
+	StorageBufferReadCompute: {
+		name:   "StorageBufferReadCompute",
+		stages: StageComputeShader,
+		access: AccessShaderRead,
+	},
+	StorageBufferWriteFragment: {
+		name:   "StorageBufferWriteFragment",
+		stages: StageFragmentShader,
+		access: AccessShaderRead | AccessShaderWrite,
+		write:  true,
+	},
+	StorageBufferWriteCompute: {
+		name:   "StorageBufferWriteCompute",
+		stages: StageComputeShader,
+		access: AccessShaderRead | AccessShaderWrite,
+		write:  true,
+	},
+}
+
+func (u Usage) String() string {
+	if info, ok := usages[u]; ok {
+		return info.name
+	}
+	return "Unknown"
+}
+
+var stageNames = []struct {
+	stage Stage
+	name  string
+}{
+	{StageTopOfPipe, "TopOfPipe"},
+	{StageDrawIndirect, "DrawIndirect"},
+	{StageVertexInput, "VertexInput"},
+	{StageVertexShader, "VertexShader"},
+	{StageFragmentShader, "FragmentShader"},
+	{StageEarlyFragmentTests, "EarlyFragmentTests"},
+	{StageLateFragmentTests, "LateFragmentTests"},
+	{StageColorAttachmentOutput, "ColorAttachmentOutput"},
+	{StageComputeShader, "ComputeShader"},
+	{StageTransfer, "Transfer"},
+	{StageBottomOfPipe, "BottomOfPipe"},
+	{StageAllCommands, "AllCommands"},
+}
+
+func (s Stage) String() string {
+	if s == 0 {
+		return "None"
+	}
+	names := []string{}
+	for _, stage := range stageNames {
+		if s&stage.stage != 0 {
+			names = append(names, stage.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+var accessNames = []struct {
+	access Access
+	name   string
+}{
+	{AccessIndirectCommandRead, "IndirectCommandRead"},
+	{AccessIndexRead, "IndexRead"},
+	{AccessVertexAttributeRead, "VertexAttributeRead"},
+	{AccessUniformRead, "UniformRead"},
+	{AccessInputAttachmentRead, "InputAttachmentRead"},
+	{AccessShaderRead, "ShaderRead"},
+	{AccessShaderWrite, "ShaderWrite"},
+	{AccessColorAttachmentRead, "ColorAttachmentRead"},
+	{AccessColorAttachmentWrite, "ColorAttachmentWrite"},
+	{AccessDepthStencilAttachmentRead, "DepthStencilAttachmentRead"},
+	{AccessDepthStencilAttachmentWrite, "DepthStencilAttachmentWrite"},
+	{AccessTransferRead, "TransferRead"},
+	{AccessTransferWrite, "TransferWrite"},
+}
+
+func (a Access) String() string {
+	if a == 0 {
+		return "None"
+	}
+	names := []string{}
+	for _, access := range accessNames {
+		if a&access.access != 0 {
+			names = append(names, access.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
@@ -0,0 +1,214 @@
+package loader
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ddsHeaderSize      = 124
+	ddsDX10HeaderSize  = 20
+	ddsPixelFormatBase = 4 + 72
+
+	ddsFlagMipMapCount   = 0x20000
+	ddsPixelFlagFourCC   = 0x4
+	ddsPixelFlagRGB      = 0x40
+	ddsCaps2Cubemap      = 0x200
+	ddsCaps2Volume       = 0x200000
+	ddsCaps2CubemapFaces = 0xfc00
+	ddsDX10MiscCube      = 0x4
+	ddsDX10Texture2D     = 3
+)
+
+func fourCC(code string) uint32 {
+	return uint32(code[0]) | uint32(code[1])<<8 | uint32(code[2])<<16 | uint32(code[3])<<24
+}
+
+// ddsFourCCFormats covers legacy headers, D3DFMT numbers included.
+var ddsFourCCFormats = map[uint32]Format{
+	fourCC("DXT1"): FormatBc1RgbaUnorm,
+	fourCC("DXT2"): FormatBc2Unorm,
+	fourCC("DXT3"): FormatBc2Unorm,
+	fourCC("DXT4"): FormatBc3Unorm,
+	fourCC("DXT5"): FormatBc3Unorm,
+	fourCC("ATI1"): FormatBc4Unorm,
+	fourCC("BC4U"): FormatBc4Unorm,
+	fourCC("BC4S"): FormatBc4Snorm,
+	fourCC("ATI2"): FormatBc5Unorm,
+	fourCC("BC5U"): FormatBc5Unorm,
+	fourCC("BC5S"): FormatBc5Snorm,
+	36:             FormatR16g16b16a16Unorm,
+	111:            FormatR16Sfloat,
+	112:            FormatR16g16Sfloat,
+	113:            FormatR16g16b16a16Sfloat,
+	114:            FormatR32Sfloat,
+	115:            FormatR32g32Sfloat,
+	116:            FormatR32g32b32a32Sfloat,
+}
+
+var dxgiFormats = map[uint32]Format{
+	2:  FormatR32g32b32a32Sfloat,
+	10: FormatR16g16b16a16Sfloat,
+	11: FormatR16g16b16a16Unorm,
+	16: FormatR32g32Sfloat,
+	24: FormatA2b10g10r10Unorm,
+	26: FormatB10g11r11Ufloat,
+	28: FormatR8g8b8a8Unorm,
+	29: FormatR8g8b8a8Srgb,
+	34: FormatR16g16Sfloat,
+	41: FormatR32Sfloat,
+	49: FormatR8g8Unorm,
+	54: FormatR16Sfloat,
+	61: FormatR8Unorm,
+	71: FormatBc1RgbaUnorm,
+	72: FormatBc1RgbaSrgb,
+	74: FormatBc2Unorm,
+	75: FormatBc2Srgb,
+	77: FormatBc3Unorm,
+	78: FormatBc3Srgb,
+	80: FormatBc4Unorm,
+	81: FormatBc4Snorm,
+	83: FormatBc5Unorm,
+	84: FormatBc5Snorm,
+	87: FormatB8g8r8a8Unorm,
+	91: FormatB8g8r8a8Srgb,
+	95: FormatBc6hUfloat,
+	96: FormatBc6hSfloat,
+	98: FormatBc7Unorm,
+	99: FormatBc7Srgb,
+}
+
+// DecodeDDS parses a DDS file, legacy and DX10 headers alike. Volume
+// textures and uncompressed layouts other than 8 bit RGBA/BGRA are not
+// supported, X8 variants are decoded with opaque alpha.
+func DecodeDDS(data []byte) (*Texture, error) {
+	if len(data) < 4+ddsHeaderSize || string(data[:4]) != string(ddsMagic) {
+		return nil, errors.New("dds: not a DDS file")
+	}
+	le := binary.LittleEndian
+	header := func(offset int) uint32 {
+		return le.Uint32(data[4+offset:])
+	}
+	pixelFormat := func(offset int) uint32 {
+		return le.Uint32(data[ddsPixelFormatBase+offset:])
+	}
+
+	if header(0) != ddsHeaderSize {
+		return nil, errors.Errorf("dds: invalid header size %d", header(0))
+	}
+	flags := header(4)
+	height, width := header(8), header(12)
+	caps2 := header(108)
+	if width == 0 || height == 0 {
+		return nil, errors.New("dds: zero size")
+	}
+	if caps2&ddsCaps2Volume != 0 {
+		return nil, errors.New("dds: volume textures not supported")
+	}
+
+	t := Texture{
+		Width:     width,
+		Height:    height,
+		MipLevels: 1,
+		Layers:    1,
+	}
+	if flags&ddsFlagMipMapCount != 0 && header(24) > 1 {
+		t.MipLevels = header(24)
+	}
+	if caps2&ddsCaps2Cubemap != 0 {
+		if caps2&ddsCaps2CubemapFaces != ddsCaps2CubemapFaces {
+			return nil, errors.New("dds: partial cube maps not supported")
+		}
+		t.Cube = true
+	}
+
+	offset := 4 + ddsHeaderSize
+	opaque := false
+	pixelFlags := pixelFormat(4)
+	code := pixelFormat(8)
+	switch {
+	case pixelFlags&ddsPixelFlagFourCC != 0 && code == fourCC("DX10"):
+		if len(data) < offset+ddsDX10HeaderSize {
+			return nil, errors.New("dds: truncated DX10 header")
+		}
+		dxgiFormat := le.Uint32(data[offset:])
+		dimension := le.Uint32(data[offset+4:])
+		miscFlags := le.Uint32(data[offset+8:])
+		arraySize := le.Uint32(data[offset+12:])
+		offset += ddsDX10HeaderSize
+
+		if dimension != ddsDX10Texture2D {
+			return nil, errors.Errorf("dds: resource dimension %d not supported", dimension)
+		}
+		format, ok := dxgiFormats[dxgiFormat]
+		if !ok {
+			return nil, errors.Errorf("dds: DXGI format %d not supported", dxgiFormat)
+		}
+		t.Format = format
+		t.Cube = miscFlags&ddsDX10MiscCube != 0
+		if arraySize > 1 {
+			t.Layers = arraySize
+		}
+
+	case pixelFlags&ddsPixelFlagFourCC != 0:
+		format, ok := ddsFourCCFormats[code]
+		if !ok {
+			return nil, errors.Errorf("dds: four CC 0x%08x not supported", code)
+		}
+		t.Format = format
+
+	case pixelFlags&ddsPixelFlagRGB != 0 && pixelFormat(12) == 32:
+		masks := [4]uint32{pixelFormat(16), pixelFormat(20), pixelFormat(24), pixelFormat(28)}
+		switch masks {
+		case [4]uint32{0xff, 0xff00, 0xff0000, 0xff000000}, [4]uint32{0xff, 0xff00, 0xff0000, 0}:
+			t.Format = FormatR8g8b8a8Unorm
+		case [4]uint32{0xff0000, 0xff00, 0xff, 0xff000000}, [4]uint32{0xff0000, 0xff00, 0xff, 0}:
+			t.Format = FormatB8g8r8a8Unorm
+		default:
+			return nil, errors.Errorf("dds: RGB masks %08x not supported", masks)
+		}
+		// The X byte of X8 formats is undefined and usually 0, which would
+		// make the texture transparent.
+		opaque = masks[3] == 0
+
+	default:
+		return nil, errors.Errorf("dds: pixel format flags 0x%x not supported", pixelFlags)
+	}
+
+	info, _ := t.Format.Info()
+	if t.MipLevels > 32 {
+		return nil, errors.Errorf("dds: %d mip levels", t.MipLevels)
+	}
+
+	// Every layer (and face) carries its full mip chain before the next.
+	for layer := uint32(0); layer < t.Layers; layer++ {
+		for face := uint32(0); face < t.Faces(); face++ {
+			for level := uint32(0); level < t.MipLevels; level++ {
+				w, h := mipSize(width, level), mipSize(height, level)
+				size := info.Size(w, h)
+				if size > uint64(len(data)-offset) {
+					return nil, errors.Errorf("dds: truncated at layer %d face %d level %d", layer, face, level)
+				}
+				texels := data[offset : uint64(offset)+size]
+				if opaque {
+					texels = append([]byte(nil), texels...)
+					for a := 3; a < len(texels); a += 4 {
+						texels[a] = 0xff
+					}
+				}
+				t.Subresources = append(t.Subresources, Subresource{
+					MipLevel: level,
+					Layer:    layer,
+					Face:     face,
+					Width:    w,
+					Height:   h,
+					Data:     texels,
+				})
+				offset += int(size)
+			}
+		}
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,154 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestDecodeDDS(t *testing.T) {
+	tests := []textureTest{
+		{
+			file:   "2d.dds",
+			format: FormatR8g8b8a8Unorm,
+			width:  2, height: 2, levels: 1, layers: 1,
+			subresources: []subresourceWant{
+				{0, 0, 0, 2, 2, 16, 1},
+			},
+		},
+		{
+			file:   "mips.dds",
+			format: FormatBc1RgbaUnorm,
+			width:  8, height: 8, levels: 4, layers: 1,
+			subresources: []subresourceWant{
+				{0, 0, 0, 8, 8, 32, 1},
+				{1, 0, 0, 4, 4, 8, 2},
+				{2, 0, 0, 2, 2, 8, 3},
+				{3, 0, 0, 1, 1, 8, 4},
+			},
+		},
+		{
+			file:   "array.dds",
+			format: FormatR8g8b8a8Unorm,
+			width:  2, height: 2, levels: 1, layers: 2,
+			subresources: []subresourceWant{
+				{0, 0, 0, 2, 2, 16, 1},
+				{0, 1, 0, 2, 2, 16, 2},
+			},
+		},
+		{
+			file:   "cube.dds",
+			format: FormatR8g8b8a8Unorm,
+			width:  1, height: 1, levels: 1, layers: 1, cube: true,
+			subresources: []subresourceWant{
+				{0, 0, 0, 1, 1, 4, 1},
+				{0, 0, 1, 1, 1, 4, 2},
+				{0, 0, 2, 1, 1, 4, 3},
+				{0, 0, 3, 1, 1, 4, 4},
+				{0, 0, 4, 1, 1, 4, 5},
+				{0, 0, 5, 1, 1, 4, 6},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			texture, err := Decode(bytes.NewReader(readFixture(t, test.file)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkTexture(t, test, texture)
+		})
+	}
+}
+
+func TestDecodeDDSOpaque(t *testing.T) {
+	data := readFixture(t, "x8.dds")
+	texture, err := DecodeDDS(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if texture.Format != FormatB8g8r8a8Unorm {
+		t.Errorf("format %d, want %d", texture.Format, FormatB8g8r8a8Unorm)
+	}
+	if len(texture.Subresources) != 1 {
+		t.Fatalf("%d subresources, want 1", len(texture.Subresources))
+	}
+	want := bytes.Repeat([]byte{1, 2, 3, 0xff}, 4)
+	if got := texture.Subresources[0].Data; !bytes.Equal(got, want) {
+		t.Errorf("texels % x, want % x", got, want)
+	}
+	if !bytes.Equal(data[len(data)-16:], bytes.Repeat([]byte{1, 2, 3, 0}, 4)) {
+		t.Error("decoding modified the file data")
+	}
+}
+
+func TestDecodeDDSInvalid(t *testing.T) {
+	le := binary.LittleEndian
+	tests := []struct {
+		name    string
+		file    string
+		corrupt func(data []byte) []byte
+		err     string
+	}{
+		{
+			name:    "truncated header",
+			file:    "2d.dds",
+			corrupt: func(data []byte) []byte { return data[:64] },
+			err:     "not a DDS file",
+		},
+		{
+			name:    "truncated DX10 header",
+			file:    "array.dds",
+			corrupt: func(data []byte) []byte { return data[:4+ddsHeaderSize+8] },
+			err:     "truncated DX10 header",
+		},
+		{
+			name:    "truncated mip chain",
+			file:    "mips.dds",
+			corrupt: func(data []byte) []byte { return data[:len(data)-1] },
+			err:     "truncated at layer 0 face 0 level 3",
+		},
+		{
+			name: "huge array",
+			file: "array.dds",
+			corrupt: func(data []byte) []byte {
+				le.PutUint32(data[4+ddsHeaderSize+12:], 0xffffffff)
+				return data
+			},
+			err: "truncated at layer 2",
+		},
+		{
+			name: "huge size",
+			file: "2d.dds",
+			corrupt: func(data []byte) []byte {
+				le.PutUint32(data[4+8:], 0xffffffff)
+				le.PutUint32(data[4+12:], 0xffffffff)
+				return data
+			},
+			err: "truncated",
+		},
+		{
+			name: "partial cube",
+			file: "cube.dds",
+			corrupt: func(data []byte) []byte {
+				le.PutUint32(data[4+108:], ddsCaps2Cubemap|0x400)
+				return data
+			},
+			err: "partial cube maps",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := DecodeDDS(test.corrupt(readFixture(t, test.file)))
+			if err == nil {
+				t.Fatal("decoded without error")
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error %q, want %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package loader
+
+// Format values are identical to vk.Format, the loader stays free of cgo so
+// it can be used (and tested) without a Vulkan build environment.
+type Format uint32
+
+const (
+	FormatUndefined Format = 0
+
+	FormatR8Unorm            Format = 9
+	FormatR8g8Unorm          Format = 16
+	FormatR8g8b8a8Unorm      Format = 37
+	FormatR8g8b8a8Srgb       Format = 43
+	FormatB8g8r8a8Unorm      Format = 44
+	FormatB8g8r8a8Srgb       Format = 50
+	FormatA2b10g10r10Unorm   Format = 64
+	FormatR16Sfloat          Format = 76
+	FormatR16g16Sfloat       Format = 83
+	FormatR16g16b16a16Unorm  Format = 91
+	FormatR16g16b16a16Sfloat Format = 97
+	FormatR32Sfloat          Format = 100
+	FormatR32g32Sfloat       Format = 103
+	FormatR32g32b32a32Sfloat Format = 109
+	FormatB10g11r11Ufloat    Format = 122
+
+	FormatBc1RgbaUnorm Format = 133
+	FormatBc1RgbaSrgb  Format = 134
+	FormatBc2Unorm     Format = 135
+	FormatBc2Srgb      Format = 136
+	FormatBc3Unorm     Format = 137
+	FormatBc3Srgb      Format = 138
+	FormatBc4Unorm     Format = 139
+	FormatBc4Snorm     Format = 140
+	FormatBc5Unorm     Format = 141
+	FormatBc5Snorm     Format = 142
+	FormatBc6hUfloat   Format = 143
+	FormatBc6hSfloat   Format = 144
+	FormatBc7Unorm     Format = 145
+	FormatBc7Srgb      Format = 146
+)
+
+// FormatInfo describes how texels of a format are laid out in memory,
+// uncompressed formats have 1x1 blocks.
+type FormatInfo struct {
+	BlockWidth  uint32
+	BlockHeight uint32
+	BlockBytes  uint32
+}
+
+var formatInfos = map[Format]FormatInfo{
+	FormatR8Unorm:            {1, 1, 1},
+	FormatR8g8Unorm:          {1, 1, 2},
+	FormatR8g8b8a8Unorm:      {1, 1, 4},
+	FormatR8g8b8a8Srgb:       {1, 1, 4},
+	FormatB8g8r8a8Unorm:      {1, 1, 4},
+	FormatB8g8r8a8Srgb:       {1, 1, 4},
+	FormatA2b10g10r10Unorm:   {1, 1, 4},
+	FormatR16Sfloat:          {1, 1, 2},
+	FormatR16g16Sfloat:       {1, 1, 4},
+	FormatR16g16b16a16Unorm:  {1, 1, 8},
+	FormatR16g16b16a16Sfloat: {1, 1, 8},
+	FormatR32Sfloat:          {1, 1, 4},
+	FormatR32g32Sfloat:       {1, 1, 8},
+	FormatR32g32b32a32Sfloat: {1, 1, 16},
+	FormatB10g11r11Ufloat:    {1, 1, 4},
+
+	FormatBc1RgbaUnorm: {4, 4, 8},
+	FormatBc1RgbaSrgb:  {4, 4, 8},
+	FormatBc2Unorm:     {4, 4, 16},
+	FormatBc2Srgb:      {4, 4, 16},
+	FormatBc3Unorm:     {4, 4, 16},
+	FormatBc3Srgb:      {4, 4, 16},
+	FormatBc4Unorm:     {4, 4, 8},
+	FormatBc4Snorm:     {4, 4, 8},
+	FormatBc5Unorm:     {4, 4, 16},
+	FormatBc5Snorm:     {4, 4, 16},
+	FormatBc6hUfloat:   {4, 4, 16},
+	FormatBc6hSfloat:   {4, 4, 16},
+	FormatBc7Unorm:     {4, 4, 16},
+	FormatBc7Srgb:      {4, 4, 16},
+}
+
+// srgbPairs maps sRGB formats to their linear counterpart.
+var srgbPairs = map[Format]Format{
+	FormatR8g8b8a8Srgb: FormatR8g8b8a8Unorm,
+	FormatB8g8r8a8Srgb: FormatB8g8r8a8Unorm,
+	FormatBc1RgbaSrgb:  FormatBc1RgbaUnorm,
+	FormatBc2Srgb:      FormatBc2Unorm,
+	FormatBc3Srgb:      FormatBc3Unorm,
+	FormatBc7Srgb:      FormatBc7Unorm,
+}
+
+// Info returns the layout of f, false for formats the loader doesn't know.
+func (f Format) Info() (FormatInfo, bool) {
+	info, ok := formatInfos[f]
+	return info, ok
+}
+
+func (f Format) Compressed() bool {
+	info, ok := formatInfos[f]
+	return ok && info.BlockWidth > 1
+}
+
+func (f Format) SRGB() bool {
+	_, ok := srgbPairs[f]
+	return ok
+}
+
+// Linear returns the non-sRGB variant of f, or f itself.
+func (f Format) Linear() Format {
+	if linear, ok := srgbPairs[f]; ok {
+		return linear
+	}
+	return f
+}
+
+// Size returns the byte size of a width by height image.
+func (i FormatInfo) Size(width, height uint32) uint64 {
+	blocksX := (width + i.BlockWidth - 1) / i.BlockWidth
+	blocksY := (height + i.BlockHeight - 1) / i.BlockHeight
+	return uint64(blocksX) * uint64(blocksY) * uint64(i.BlockBytes)
+}
@@ -0,0 +1,106 @@
+package loader
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ktx2HeaderSize     = 80
+	ktx2LevelIndexSize = 24
+)
+
+// DecodeKTX2 parses a KTX2 container. Supercompressed and 3D textures are
+// not supported, the vkFormat is taken as is.
+func DecodeKTX2(data []byte) (*Texture, error) {
+	if len(data) < ktx2HeaderSize || string(data[:len(ktx2Identifier)]) != string(ktx2Identifier) {
+		return nil, errors.New("ktx2: not a KTX2 file")
+	}
+	le := binary.LittleEndian
+	field := func(t int) uint32 {
+		return le.Uint32(data[12+t*4:])
+	}
+
+	format := Format(field(0))
+	width, height, depth := field(2), field(3), field(4)
+	layers, faces, levels := field(5), field(6), field(7)
+	supercompression := field(8)
+
+	switch {
+	case format == FormatUndefined:
+		return nil, errors.New("ktx2: undefined format, basis universal is not supported")
+	case supercompression != 0:
+		return nil, errors.Errorf("ktx2: supercompression scheme %d not supported", supercompression)
+	case depth > 1:
+		return nil, errors.New("ktx2: 3D textures not supported")
+	case width == 0:
+		return nil, errors.New("ktx2: zero width")
+	case faces != 1 && faces != 6:
+		return nil, errors.Errorf("ktx2: invalid face count %d", faces)
+	}
+	if height == 0 {
+		height = 1
+	}
+	if layers == 0 {
+		layers = 1
+	}
+	// Zero levels asks the loader to generate mips, only the base is stored.
+	if levels == 0 {
+		levels = 1
+	}
+
+	indexEnd := uint64(ktx2HeaderSize) + uint64(levels)*ktx2LevelIndexSize
+	if uint64(len(data)) < indexEnd {
+		return nil, errors.New("ktx2: truncated level index")
+	}
+
+	t := Texture{
+		Format:    format,
+		Width:     width,
+		Height:    height,
+		MipLevels: levels,
+		Layers:    layers,
+		Cube:      faces == 6,
+	}
+
+	// Every image takes at least a byte, so checking each level against its
+	// image count also bounds the number of subresources by the file size.
+	images := uint64(layers) * uint64(faces)
+	if images == 0 || images > uint64(len(data)) {
+		return nil, errors.Errorf("ktx2: %d layers of %d faces do not fit the file", layers, faces)
+	}
+	levelData := make([][]byte, levels)
+	for level := uint64(0); level < uint64(levels); level++ {
+		entry := data[ktx2HeaderSize+level*ktx2LevelIndexSize:]
+		offset, length := le.Uint64(entry), le.Uint64(entry[8:])
+		if offset > uint64(len(data)) || length > uint64(len(data))-offset {
+			return nil, errors.Errorf("ktx2: level %d out of bounds", level)
+		}
+		if length < images || length%images != 0 {
+			return nil, errors.Errorf("ktx2: level %d size %d not divisible into %d images", level, length, images)
+		}
+		levelData[level] = data[offset : offset+length]
+	}
+
+	// Levels are stored as layers of faces, no padding between images for
+	// non-supercompressed data.
+	for layer := uint32(0); layer < layers; layer++ {
+		for face := uint32(0); face < faces; face++ {
+			for level := uint32(0); level < levels; level++ {
+				size := uint64(len(levelData[level])) / images
+				start := (uint64(layer)*uint64(faces) + uint64(face)) * size
+				t.Subresources = append(t.Subresources, Subresource{
+					MipLevel: level,
+					Layer:    layer,
+					Face:     face,
+					Width:    mipSize(width, level),
+					Height:   mipSize(height, level),
+					Data:     levelData[level][start : start+size],
+				})
+			}
+		}
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,207 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// subresourceWant describes a subresource of a fixture, whose images are
+// each filled with a single marker byte.
+type subresourceWant struct {
+	level, layer, face uint32
+	width, height      uint32
+	size               int
+	marker             byte
+}
+
+type textureTest struct {
+	file          string
+	format        Format
+	width, height uint32
+	levels        uint32
+	layers        uint32
+	cube          bool
+	subresources  []subresourceWant
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func checkTexture(t *testing.T, test textureTest, texture *Texture) {
+	t.Helper()
+	if texture.Format != test.format {
+		t.Errorf("format %d, want %d", texture.Format, test.format)
+	}
+	if texture.Width != test.width || texture.Height != test.height {
+		t.Errorf("size %dx%d, want %dx%d", texture.Width, texture.Height, test.width, test.height)
+	}
+	if texture.MipLevels != test.levels || texture.Layers != test.layers || texture.Cube != test.cube {
+		t.Errorf("levels %d layers %d cube %v, want %d %d %v", texture.MipLevels, texture.Layers, texture.Cube, test.levels, test.layers, test.cube)
+	}
+	if len(texture.Subresources) != len(test.subresources) {
+		t.Fatalf("%d subresources, want %d", len(texture.Subresources), len(test.subresources))
+	}
+	for n, want := range test.subresources {
+		got := texture.Subresources[n]
+		if got.MipLevel != want.level || got.Layer != want.layer || got.Face != want.face {
+			t.Errorf("subresource %d is level %d layer %d face %d, want %d %d %d", n, got.MipLevel, got.Layer, got.Face, want.level, want.layer, want.face)
+		}
+		if got.Width != want.width || got.Height != want.height {
+			t.Errorf("subresource %d is %dx%d, want %dx%d", n, got.Width, got.Height, want.width, want.height)
+		}
+		if len(got.Data) != want.size {
+			t.Errorf("subresource %d has %d bytes, want %d", n, len(got.Data), want.size)
+			continue
+		}
+		for _, b := range got.Data {
+			if b != want.marker {
+				t.Errorf("subresource %d holds 0x%02x, want 0x%02x", n, b, want.marker)
+				break
+			}
+		}
+	}
+}
+
+func TestDecodeKTX2(t *testing.T) {
+	tests := []textureTest{
+		{
+			file:   "2d.ktx2",
+			format: FormatR8g8b8a8Unorm,
+			width:  2, height: 2, levels: 1, layers: 1,
+			subresources: []subresourceWant{
+				{0, 0, 0, 2, 2, 16, 1},
+			},
+		},
+		{
+			file:   "mips.ktx2",
+			format: FormatR8g8b8a8Unorm,
+			width:  4, height: 2, levels: 3, layers: 1,
+			subresources: []subresourceWant{
+				{0, 0, 0, 4, 2, 32, 1},
+				{1, 0, 0, 2, 1, 8, 2},
+				{2, 0, 0, 1, 1, 4, 3},
+			},
+		},
+		{
+			file:   "array.ktx2",
+			format: FormatR8g8b8a8Unorm,
+			width:  2, height: 2, levels: 1, layers: 3,
+			subresources: []subresourceWant{
+				{0, 0, 0, 2, 2, 16, 1},
+				{0, 1, 0, 2, 2, 16, 2},
+				{0, 2, 0, 2, 2, 16, 3},
+			},
+		},
+		{
+			file:   "cube.ktx2",
+			format: FormatR8g8b8a8Unorm,
+			width:  1, height: 1, levels: 1, layers: 1, cube: true,
+			subresources: []subresourceWant{
+				{0, 0, 0, 1, 1, 4, 1},
+				{0, 0, 1, 1, 1, 4, 2},
+				{0, 0, 2, 1, 1, 4, 3},
+				{0, 0, 3, 1, 1, 4, 4},
+				{0, 0, 4, 1, 1, 4, 5},
+				{0, 0, 5, 1, 1, 4, 6},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			texture, err := Decode(bytes.NewReader(readFixture(t, test.file)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkTexture(t, test, texture)
+		})
+	}
+}
+
+func TestDecodeKTX2Invalid(t *testing.T) {
+	le := binary.LittleEndian
+	tests := []struct {
+		name    string
+		file    string
+		corrupt func(data []byte) []byte
+		err     string
+	}{
+		{
+			name:    "truncated header",
+			file:    "2d.ktx2",
+			corrupt: func(data []byte) []byte { return data[:40] },
+			err:     "not a KTX2 file",
+		},
+		{
+			name:    "truncated level index",
+			file:    "mips.ktx2",
+			corrupt: func(data []byte) []byte { return data[:ktx2HeaderSize+ktx2LevelIndexSize] },
+			err:     "truncated level index",
+		},
+		{
+			name:    "truncated level data",
+			file:    "mips.ktx2",
+			corrupt: func(data []byte) []byte { return data[:len(data)-1] },
+			err:     "out of bounds",
+		},
+		{
+			name: "level length overflow",
+			file: "2d.ktx2",
+			corrupt: func(data []byte) []byte {
+				le.PutUint64(data[ktx2HeaderSize+8:], ^uint64(0))
+				return data
+			},
+			err: "out of bounds",
+		},
+		{
+			name: "layer count overflow",
+			file: "cube.ktx2",
+			corrupt: func(data []byte) []byte {
+				le.PutUint32(data[12+5*4:], 0x80000000)
+				return data
+			},
+			err: "do not fit",
+		},
+		{
+			name: "layers with empty levels",
+			file: "2d.ktx2",
+			corrupt: func(data []byte) []byte {
+				le.PutUint32(data[12+5*4:], 64)
+				le.PutUint64(data[ktx2HeaderSize+8:], 0)
+				return data
+			},
+			err: "not divisible",
+		},
+		{
+			name: "invalid face count",
+			file: "2d.ktx2",
+			corrupt: func(data []byte) []byte {
+				le.PutUint32(data[12+6*4:], 2)
+				return data
+			},
+			err: "invalid face count",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := DecodeKTX2(test.corrupt(readFixture(t, test.file)))
+			if err == nil {
+				t.Fatal("decoded without error")
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error %q, want %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Package loader decodes image files into textures ready for upload. PNG and
+// JPEG go through the standard library, KTX2 and DDS containers are parsed
+// directly and keep their mip chains, array layers and cube faces.
+package loader
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Texture is a decoded image with every subresource's data tightly packed.
+type Texture struct {
+	Format        Format
+	Width, Height uint32
+	MipLevels     uint32
+	// Layers counts array layers, cube faces come on top of that.
+	Layers uint32
+	Cube   bool
+
+	// Subresources are ordered by layer, face, then mip level.
+	Subresources []Subresource
+}
+
+type Subresource struct {
+	MipLevel      uint32
+	Layer         uint32
+	Face          uint32
+	Width, Height uint32
+	Data          []byte
+}
+
+// Faces is 6 for cube maps, 1 otherwise.
+func (t *Texture) Faces() uint32 {
+	if t.Cube {
+		return 6
+	}
+	return 1
+}
+
+// ImageLayers is the number of image layers needed to hold the texture, cube
+// faces included.
+func (t *Texture) ImageLayers() uint32 {
+	return t.Layers * t.Faces()
+}
+
+// ImageLayer maps a subresource onto its image layer.
+func (t *Texture) ImageLayer(s Subresource) uint32 {
+	return s.Layer*t.Faces() + s.Face
+}
+
+// AsLinear reinterprets sRGB data as linear, for normal maps and other data
+// textures.
+func (t *Texture) AsLinear() {
+	t.Format = t.Format.Linear()
+}
+
+// Load decodes the file at path.
+func Load(path string) (*Texture, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "load texture")
+	}
+	defer file.Close()
+
+	texture, err := Decode(file)
+	return texture, errors.Wrapf(err, "load %s", path)
+}
+
+var (
+	ktx2Identifier = []byte{0xab, 'K', 'T', 'X', ' ', '2', '0', 0xbb, '\r', '\n', 0x1a, '\n'}
+	ddsMagic       = []byte("DDS ")
+)
+
+// Decode picks the decoder from the data's magic bytes.
+func Decode(r io.Reader) (*Texture, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "read texture")
+	}
+
+	switch {
+	case bytes.HasPrefix(data, ktx2Identifier):
+		return DecodeKTX2(data)
+	case bytes.HasPrefix(data, ddsMagic):
+		return DecodeDDS(data)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "decode image")
+	}
+	return FromImage(img), nil
+}
+
+// FromImage converts img to a single level sRGB RGBA8 texture. Alpha is kept
+// straight, not premultiplied.
+func FromImage(img image.Image) *Texture {
+	bounds := img.Bounds()
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || nrgba.Stride != bounds.Dx()*4 {
+		nrgba = image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	}
+
+	width, height := uint32(bounds.Dx()), uint32(bounds.Dy())
+	return &Texture{
+		Format:    FormatR8g8b8a8Srgb,
+		Width:     width,
+		Height:    height,
+		MipLevels: 1,
+		Layers:    1,
+		Subresources: []Subresource{
+			{
+				Width:  width,
+				Height: height,
+				Data:   nrgba.Pix[:width*height*4],
+			},
+		},
+	}
+}
+
+func mipSize(size, level uint32) uint32 {
+	size >>= level
+	if size == 0 {
+		return 1
+	}
+	return size
+}
@@ -1,14 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
-	"io/ioutil"
 	"runtime"
-	"unsafe"
 
+	"github.com/pkg/errors"
 	"github.com/vulkan-go/glfw/v3.3/glfw"
 	vk "github.com/vulkan-go/vulkan"
 
+	"github.com/perlw/abyssal_drifter/graph"
 	"github.com/perlw/abyssal_drifter/logger"
 	"github.com/perlw/abyssal_drifter/myr"
 	"github.com/perlw/abyssal_drifter/pompeii"
@@ -18,32 +20,10 @@ func init() {
 	runtime.LockOSThread()
 }
 
-// +Byte slice to uint32 slice
-type sliceHeader struct {
-	Data uintptr
-	Len  int
-	Cap  int
-}
-
-func sliceUint32(data []byte) []uint32 {
-	const m = 0x7fffffff
-	return (*[m / 4]uint32)(unsafe.Pointer((*sliceHeader)(unsafe.Pointer(&data)).Data))[:len(data)/4]
-}
-
-// -Byte slice to uint32 slice
-
-func vkString(str string) string {
-	if len(str) == 0 {
-		return "\x00"
-	} else if str[len(str)-1] != '\x00' {
-		return str + "\x00"
-	}
-	return str
-}
-
 const AppName = "Abyssal Drifter"
 const ResWidth = 640
 const ResHeight = 480
+const FramesInFlight = 2
 
 func main() {
 	log := logger.New(AppName)
@@ -52,7 +32,7 @@ func main() {
 	if procAddr == nil {
 		panic("GetInstanceProcAddress is nil")
 	}
-	vk.SetGetInstanceProcAddr(procAddr)
+	pompeii.SetGetInstanceProcAddr(procAddr)
 
 	framework, err := myr.New(AppName, ResWidth, ResHeight)
 	if err != nil {
@@ -61,544 +41,219 @@ func main() {
 	defer framework.Destroy()
 
 	// NOTE: Only for dev
-	gpuHandle := framework.BackendGPU().Handle()
-	surfaceHandle := framework.BackendSurface().Handle()
 	device := framework.BackendDevice()
-	deviceHandle := framework.BackendDevice().Handle()
 
 	// +Prepare rendering
 	// Get command queue
-	var graphicsQueue vk.Queue
-	var presentQueue vk.Queue
-	vk.GetDeviceQueue(deviceHandle, uint32(device.GraphicsIndex), 0, &graphicsQueue)
-	vk.GetDeviceQueue(deviceHandle, uint32(device.PresentIndex), 0, &presentQueue)
+	graphicsQueue := device.GraphicsQueue
+	presentQueue := device.PresentQueue
 
-	// Semaphores
-	imageAvailableSemaphore, err := pompeii.NewSemaphore(device)
+	// Frames in flight, each with its own semaphores, fence and command buffer
+	frames, err := pompeii.NewFrameContext(device, FramesInFlight, device.GraphicsIndex, 1)
 	if err != nil {
-		log.Err(err, "image")
+		log.Err(err, "create frames")
 		return
 	}
-	renderingFinishedSemaphore, err := pompeii.NewSemaphore(device)
+	defer frames.Destroy()
+
+	// Swap chain
+	swapchain, err := pompeii.NewSwapchain(framework.BackendGPU(), device, framework.BackendSurface(), pompeii.SwapchainOptions{
+		Present: pompeii.PresentVSync,
+	})
 	if err != nil {
-		log.Err(err, "rendering")
+		log.Err(err, "create swapchain")
 		return
 	}
-	defer imageAvailableSemaphore.Destroy()
-	defer renderingFinishedSemaphore.Destroy()
+	defer swapchain.Destroy()
+	log.Log("Swapchain: %s, %s, %d images\n",
+		pompeii.SurfaceFormat{Format: swapchain.Format, ColorSpace: swapchain.ColorSpace},
+		pompeii.PresentModeName(swapchain.PresentMode),
+		len(swapchain.Images),
+	)
 
-	// Swap chain
-	var surfaceCapabilities vk.SurfaceCapabilities
-	if result := vk.GetPhysicalDeviceSurfaceCapabilities(gpuHandle, surfaceHandle, &surfaceCapabilities); result != vk.Success {
-		log.Err(vk.Error(result), "get surface caps")
+	// Vertex buffer, uploaded once through a staging buffer
+	uploadPool, err := pompeii.NewCommandPool(device, device.GraphicsIndex, true, false)
+	if err != nil {
+		log.Err(err, "create upload command pool")
 		return
 	}
-	surfaceCapabilities.Deref()
-	surfaceCapabilities.MinImageExtent.Deref()
-	surfaceCapabilities.MaxImageExtent.Deref()
-
-	log.Log("surface min: %dx%d", surfaceCapabilities.MinImageExtent.Width, surfaceCapabilities.MinImageExtent.Height)
-	log.Log("surface max: %dx%d", surfaceCapabilities.MaxImageExtent.Width, surfaceCapabilities.MaxImageExtent.Height)
-
-	var formatCount uint32
-	vk.GetPhysicalDeviceSurfaceFormats(gpuHandle, surfaceHandle, &formatCount, nil)
-	formats := make([]vk.SurfaceFormat, formatCount)
-	vk.GetPhysicalDeviceSurfaceFormats(gpuHandle, surfaceHandle, &formatCount, formats)
-	format := formats[0]
-	format.Deref()
-
-	var oldSwapchain vk.Swapchain
-	var swapchain vk.Swapchain
-	swapChainCreateInfo := vk.SwapchainCreateInfo{
-		SType:           vk.StructureTypeSwapchainCreateInfo,
-		Surface:         surfaceHandle,
-		MinImageCount:   2,
-		ImageFormat:     format.Format,
-		ImageColorSpace: format.ColorSpace,
-		ImageExtent: vk.Extent2D{
-			Width:  ResWidth,
-			Height: ResHeight,
-		},
-		ImageArrayLayers:      1,
-		ImageUsage:            vk.ImageUsageFlags(vk.ImageUsageColorAttachmentBit | vk.ImageUsageTransferDstBit),
-		ImageSharingMode:      vk.SharingModeExclusive,
-		QueueFamilyIndexCount: 0,
-		PreTransform:          vk.SurfaceTransformIdentityBit,
-		CompositeAlpha:        vk.CompositeAlphaOpaqueBit,
-		PresentMode:           vk.PresentModeFifo,
-		Clipped:               vk.True,
-		OldSwapchain:          oldSwapchain,
+	defer uploadPool.Destroy()
+
+	vertices := []float32{
+		-0.7, 0.7,
+		0.7, 0.7,
+		0.0, -0.7,
 	}
-	if result := vk.CreateSwapchain(deviceHandle, &swapChainCreateInfo, nil, &swapchain); result != vk.Success {
-		log.Err(vk.Error(result), "create swapchain")
+	vertexData := bytes.Buffer{}
+	binary.Write(&vertexData, binary.LittleEndian, vertices)
+	vertexBuffer, err := pompeii.NewDeviceBuffer(framework.BackendAllocator(), uint64(vertexData.Len()), vk.BufferUsageVertexBufferBit)
+	if err != nil {
+		log.Err(err, "create vertex buffer")
 		return
 	}
-	if oldSwapchain != vk.NullSwapchain {
-		vk.DestroySwapchain(deviceHandle, oldSwapchain, nil)
+	defer vertexBuffer.Destroy()
+	if err := vertexBuffer.Upload(uploadPool, graphicsQueue, 0, vertexData.Bytes()); err != nil {
+		log.Err(err, "upload vertices")
+		return
 	}
-	defer vk.DestroySwapchain(deviceHandle, swapchain, nil)
 	// -Prepare rendering
 
 	// +Set up render pass
-	// Creating render pass
-	attachmentDescriptions := []vk.AttachmentDescription{
-		{
-			Format:         format.Format,
-			Samples:        vk.SampleCount1Bit,
-			LoadOp:         vk.AttachmentLoadOpClear,
-			StoreOp:        vk.AttachmentStoreOpStore,
-			StencilLoadOp:  vk.AttachmentLoadOpDontCare,
-			StencilStoreOp: vk.AttachmentStoreOpDontCare,
-			InitialLayout:  vk.ImageLayoutPresentSrc,
-			FinalLayout:    vk.ImageLayoutPresentSrc,
-		},
-	}
-	colorAttachmentReferences := []vk.AttachmentReference{
-		{
-			Layout: vk.ImageLayoutColorAttachmentOptimal,
-		},
-	}
-	subpassDescriptions := []vk.SubpassDescription{
-		{
-			PipelineBindPoint:    vk.PipelineBindPointGraphics,
-			ColorAttachmentCount: 1,
-			PColorAttachments:    colorAttachmentReferences,
-		},
-	}
-
-	renderPassCreateInfo := vk.RenderPassCreateInfo{
-		SType:           vk.StructureTypeRenderPassCreateInfo,
-		AttachmentCount: 1,
-		PAttachments:    attachmentDescriptions,
-		SubpassCount:    1,
-		PSubpasses:      subpassDescriptions,
-	}
-	var renderPass vk.RenderPass
-	if result := vk.CreateRenderPass(deviceHandle, &renderPassCreateInfo, nil, &renderPass); result != vk.Success {
-		log.Err(vk.Error(result), "create render pass")
+	// Creating render pass, the swapchain image is cleared so its previous
+	// contents are not needed. Getting it in and out of the attachment layout
+	// is left to the frame graph.
+	renderPass, err := pompeii.NewRenderPassBuilder().
+		ColorAttachment(swapchain.Format, vk.SampleCount1Bit, vk.AttachmentLoadOpClear, vk.AttachmentStoreOpStore, vk.ImageLayoutColorAttachmentOptimal).
+		Subpass(0).
+		Build(device)
+	if err != nil {
+		log.Err(err, "create render pass")
 		return
 	}
-	defer vk.DestroyRenderPass(deviceHandle, renderPass, nil)
+	defer renderPass.Destroy()
 
-	// Creating framebuffers
-	var imageCount uint32
-	if result := vk.GetSwapchainImages(deviceHandle, swapchain, &imageCount, nil); result != vk.Success {
-		log.Err(vk.Error(result), "get swapchain image count")
+	// Shaders
+	vertShaderModule, err := pompeii.NewShaderModuleFromFile(device, "tri.vert.spv")
+	if err != nil {
+		log.Err(err, "create vertex shader")
 		return
 	}
-	log.Log("Swapchain image count: %d", imageCount)
-
-	swapChainImages := make([]vk.Image, imageCount)
-	if result := vk.GetSwapchainImages(deviceHandle, swapchain, &imageCount, swapChainImages); result != vk.Success {
-		log.Err(vk.Error(result), "get swapchain images")
+	defer vertShaderModule.Destroy()
+	fragShaderModule, err := pompeii.NewShaderModuleFromFile(device, "tri.frag.spv")
+	if err != nil {
+		log.Err(err, "create frag shader")
 		return
 	}
+	defer fragShaderModule.Destroy()
 
-	// TODO: Use single framebuffer, render to texture, then make swapchain copy from texture
-	framebufferWidth := uint32(ResWidth)
-	framebufferHeight := uint32(ResHeight)
-	framebuffers := make([]vk.Framebuffer, len(swapChainImages))
-	framebufferViews := make([]vk.ImageView, len(swapChainImages))
-	for i, img := range swapChainImages {
-		imageViewCreateInfo := vk.ImageViewCreateInfo{
-			SType:    vk.StructureTypeImageViewCreateInfo,
-			Image:    img,
-			ViewType: vk.ImageViewType2d,
-			Format:   format.Format,
-			Components: vk.ComponentMapping{
-				R: vk.ComponentSwizzleIdentity,
-				G: vk.ComponentSwizzleIdentity,
-				B: vk.ComponentSwizzleIdentity,
-				A: vk.ComponentSwizzleIdentity,
-			},
-			SubresourceRange: vk.ImageSubresourceRange{
-				AspectMask:     vk.ImageAspectFlags(vk.ImageAspectColorBit),
-				BaseMipLevel:   0,
-				LevelCount:     1,
-				BaseArrayLayer: 0,
-				LayerCount:     1,
-			},
-		}
-		if result := vk.CreateImageView(deviceHandle, &imageViewCreateInfo, nil, &framebufferViews[i]); result != vk.Success {
-			log.Err(vk.Error(result), "create image view")
-			return
-		}
-
-		// Framebuffer parameters
-		framebufferCreateInfo := vk.FramebufferCreateInfo{
-			SType:           vk.StructureTypeFramebufferCreateInfo,
-			RenderPass:      renderPass,
-			AttachmentCount: 1,
-			PAttachments: []vk.ImageView{
-				framebufferViews[i],
-			},
-			Width:  framebufferWidth,
-			Height: framebufferHeight,
-			Layers: 1,
-		}
-		if result := vk.CreateFramebuffer(deviceHandle, &framebufferCreateInfo, nil, &framebuffers[i]); result != vk.Success {
-			log.Err(vk.Error(result), "create framebuffer")
-			return
-		}
-	}
-
-	defer (func() {
-		for i := range swapChainImages {
-			vk.DestroyImageView(deviceHandle, framebufferViews[i], nil)
-			vk.DestroyFramebuffer(deviceHandle, framebuffers[i], nil)
-		}
-	})()
-
-	// Shaders
-	var vertShaderModule vk.ShaderModule
-	var fragShaderModule vk.ShaderModule
-	{
-		shaderCode, err := ioutil.ReadFile("tri.vert.spv")
-		if err != nil {
-			log.Err(err, "read vertex code")
-			return
-		}
-
-		shaderModuleCreateInfo := vk.ShaderModuleCreateInfo{
-			SType:    vk.StructureTypeShaderModuleCreateInfo,
-			CodeSize: uint(len(shaderCode)),
-			PCode:    sliceUint32(shaderCode),
-		}
-		if result := vk.CreateShaderModule(deviceHandle, &shaderModuleCreateInfo, nil, &vertShaderModule); result != vk.Success {
-			log.Err(vk.Error(result), "create vertex shader")
-			return
-		}
-	}
-	defer vk.DestroyShaderModule(deviceHandle, vertShaderModule, nil)
-	{
-		shaderCode, err := ioutil.ReadFile("tri.frag.spv")
-		if err != nil {
-			log.Err(err, "read frag code")
-			return
-		}
-
-		shaderModuleCreateInfo := vk.ShaderModuleCreateInfo{
-			SType:    vk.StructureTypeShaderModuleCreateInfo,
-			CodeSize: uint(len(shaderCode)),
-			PCode:    sliceUint32(shaderCode),
-		}
-		if result := vk.CreateShaderModule(deviceHandle, &shaderModuleCreateInfo, nil, &fragShaderModule); result != vk.Success {
-			log.Err(vk.Error(result), "create frag shader")
-			return
-		}
-	}
-	defer vk.DestroyShaderModule(deviceHandle, fragShaderModule, nil)
-
-	// Shader stages
-	// PName must be "main"???
-	// Oh.. it's the name of the entry function in the shader...
-	shaderStageCreateInfos := []vk.PipelineShaderStageCreateInfo{
-		{
-			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
-			Stage:  vk.ShaderStageVertexBit,
-			Module: vertShaderModule,
-			PName:  vkString("main"),
-		},
-		{
-			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
-			Stage:  vk.ShaderStageFragmentBit,
-			Module: fragShaderModule,
-			PName:  vkString("main"),
-		},
-	}
-
-	// Vertex Input
-	vertexInputStateCreateInfo := vk.PipelineVertexInputStateCreateInfo{
-		SType: vk.StructureTypePipelineVertexInputStateCreateInfo,
-	}
-
-	// Input assembly
-	inputAssemblyStateCreateInfo := vk.PipelineInputAssemblyStateCreateInfo{
-		SType:                  vk.StructureTypePipelineInputAssemblyStateCreateInfo,
-		Topology:               vk.PrimitiveTopologyTriangleList,
-		PrimitiveRestartEnable: vk.False,
-	}
-
-	// Viewport
-	viewport := vk.Viewport{
-		X:        0.0,
-		Y:        0.0,
-		Width:    float32(framebufferWidth),
-		Height:   float32(framebufferHeight),
-		MinDepth: 0.0,
-		MaxDepth: 1.0,
-	}
-	scissor := vk.Rect2D{
-		Offset: vk.Offset2D{
-			X: 0,
-			Y: 0,
-		},
-		Extent: vk.Extent2D{
-			Width:  framebufferWidth,
-			Height: framebufferHeight,
-		},
-	}
-	viewportStateCreateInfo := vk.PipelineViewportStateCreateInfo{
-		SType:         vk.StructureTypePipelineViewportStateCreateInfo,
-		ViewportCount: 1,
-		PViewports: []vk.Viewport{
-			viewport,
-		},
-		ScissorCount: 1,
-		PScissors: []vk.Rect2D{
-			scissor,
-		},
-	}
-
-	// Raster state
-	rasterStateCreateInfo := vk.PipelineRasterizationStateCreateInfo{
-		SType:                   vk.StructureTypePipelineRasterizationStateCreateInfo,
-		DepthClampEnable:        vk.False,
-		RasterizerDiscardEnable: vk.False,
-		PolygonMode:             vk.PolygonModeFill,
-		CullMode:                vk.CullModeFlags(vk.CullModeBackBit),
-		FrontFace:               vk.FrontFaceCounterClockwise,
-		DepthBiasEnable:         vk.False,
-		DepthBiasConstantFactor: 0.0,
-		DepthBiasClamp:          0.0,
-		DepthBiasSlopeFactor:    0.0,
-		LineWidth:               1.0,
-	}
-
-	// Multisample state
-	multisampleStateCreateInfo := vk.PipelineMultisampleStateCreateInfo{
-		SType:                 vk.StructureTypePipelineMultisampleStateCreateInfo,
-		RasterizationSamples:  vk.SampleCount1Bit,
-		SampleShadingEnable:   vk.False,
-		MinSampleShading:      1.0,
-		AlphaToCoverageEnable: vk.False,
-		AlphaToOneEnable:      vk.False,
-	}
-
-	// Blending state
-	colorBlendAttachmentState := vk.PipelineColorBlendAttachmentState{
-		BlendEnable:         vk.False,
-		SrcColorBlendFactor: vk.BlendFactorOne,
-		DstColorBlendFactor: vk.BlendFactorZero,
-		ColorBlendOp:        vk.BlendOpAdd,
-		SrcAlphaBlendFactor: vk.BlendFactorOne,
-		DstAlphaBlendFactor: vk.BlendFactorZero,
-		AlphaBlendOp:        vk.BlendOpAdd,
-		ColorWriteMask:      vk.ColorComponentFlags(vk.ColorComponentRBit | vk.ColorComponentGBit | vk.ColorComponentBBit | vk.ColorComponentABit),
-	}
-	colorBlendStateCreateInfo := vk.PipelineColorBlendStateCreateInfo{
-		SType:           vk.StructureTypePipelineColorBlendStateCreateInfo,
-		LogicOpEnable:   vk.False,
-		LogicOp:         vk.LogicOpCopy,
-		AttachmentCount: 1,
-		PAttachments: []vk.PipelineColorBlendAttachmentState{
-			colorBlendAttachmentState,
-		},
-		BlendConstants: [4]float32{0.0, 0.0, 0.0, 0.0},
-	}
-
-	// Dynamic state
-	dynamicStateCreateInfo := vk.PipelineDynamicStateCreateInfo{
-		SType: vk.StructureTypePipelineDynamicStateCreateInfo,
+	// Pipeline layout, derived from what the shaders use
+	pipelineLayout, err := pompeii.NewReflectedPipelineLayout(device, framework.BackendDescriptorLayouts(), vertShaderModule, fragShaderModule)
+	if err != nil {
+		log.Err(err, "create pipeline layout")
+		return
 	}
+	defer pipelineLayout.Destroy()
 
-	// Pipeline layout
-	layoutCreateInfo := vk.PipelineLayoutCreateInfo{
-		SType: vk.StructureTypePipelineLayoutCreateInfo,
-	}
-	var pipelineLayout vk.PipelineLayout
-	if result := vk.CreatePipelineLayout(deviceHandle, &layoutCreateInfo, nil, &pipelineLayout); result != vk.Success {
-		log.Err(vk.Error(result), "create pipeline layout")
+	// Graphics pipeline, vertex input follows the vertex shader's inputs
+	graphicsPipeline, err := pompeii.NewGraphicsPipelineBuilder().
+		Shaders(vertShaderModule, fragShaderModule).
+		VertexInputFromShader().
+		Cache(framework.BackendPipelineCache()).
+		Build(device, renderPass, 0, pipelineLayout)
+	if err != nil {
+		log.Err(err, "create graphics pipeline")
 		return
 	}
-	defer vk.DestroyPipelineLayout(deviceHandle, pipelineLayout, nil)
-
-	// Graphics pipeline
-	pipelineCreateInfo := []vk.GraphicsPipelineCreateInfo{
-		{
-			SType:               vk.StructureTypeGraphicsPipelineCreateInfo,
-			StageCount:          uint32(len(shaderStageCreateInfos)),
-			PStages:             shaderStageCreateInfos,
-			PVertexInputState:   &vertexInputStateCreateInfo,
-			PDynamicState:       &dynamicStateCreateInfo,
-			PInputAssemblyState: &inputAssemblyStateCreateInfo,
-			PViewportState:      &viewportStateCreateInfo,
-			PRasterizationState: &rasterStateCreateInfo,
-			PMultisampleState:   &multisampleStateCreateInfo,
-			PColorBlendState:    &colorBlendStateCreateInfo,
-			Layout:              pipelineLayout,
-			RenderPass:          renderPass,
-		},
+	defer graphicsPipeline.Destroy()
+	if err := device.SetObjectName(graphicsPipeline.Handle(), "triangle"); err != nil {
+		log.Warn("Could not name pipeline: %s\n", err)
 	}
-	graphicsPipeline := make([]vk.Pipeline, 1)
-	if result := vk.CreateGraphicsPipelines(deviceHandle, nil, 1, pipelineCreateInfo, nil, graphicsPipeline); result != vk.Success {
-		log.Err(vk.Error(result), "create pipeline layout")
+
+	// Framebuffers, rebuilt whenever the swapchain is recreated
+	// TODO: Use single framebuffer, render to texture, then make swapchain copy from texture
+	framebuffer, err := pompeii.NewFramebuffer(framework.BackendAllocator(), renderPass, pompeii.FramebufferOptions{
+		Swapchain: swapchain,
+	})
+	if err != nil {
+		log.Err(err, "create framebuffers")
 		return
 	}
-	defer vk.DestroyPipeline(deviceHandle, graphicsPipeline[0], nil)
-
-	// Set up Command buffers
-	// Command pool
-	var graphicsQueueCmdPool vk.CommandPool
-	graphicsCmdPoolCreateInfo := vk.CommandPoolCreateInfo{
-		SType:            vk.StructureTypeCommandPoolCreateInfo,
-		QueueFamilyIndex: uint32(device.GraphicsIndex),
-	}
-	if result := vk.CreateCommandPool(deviceHandle, &graphicsCmdPoolCreateInfo, nil, &graphicsQueueCmdPool); result != vk.Success {
-		log.Err(vk.Error(result), "create graphics command pool")
+	defer framebuffer.Destroy()
+
+	// Frame graph, works out the barriers around the triangle pass
+	frameGraph := graph.New()
+	backbuffer := frameGraph.ImportImage("swapchain", graph.ImageInfo{
+		Format: uint32(swapchain.Format),
+	}, graph.External{
+		// Acquiring is waited on at color output
+		Stages: graph.StageColorAttachmentOutput,
+		// Shared between graphics and present families if they differ
+		Concurrent: true,
+	})
+	frameGraph.AddPass("triangle", graph.QueueGraphics).Write(backbuffer, graph.ColorAttachment)
+	frameGraph.Present(backbuffer)
+	plan, err := frameGraph.Compile(pompeii.GraphQueueFamilies(device))
+	if err != nil {
+		log.Err(err, "compile frame graph")
 		return
 	}
-	defer vk.DestroyCommandPool(deviceHandle, graphicsQueueCmdPool, nil)
-
-	// Set up Command buffers
-	graphicsQueueCmdBuffers := make([]vk.CommandBuffer, imageCount)
-	graphicsCmdBufferAllocateInfo := vk.CommandBufferAllocateInfo{
-		SType:              vk.StructureTypeCommandBufferAllocateInfo,
-		CommandPool:        graphicsQueueCmdPool,
-		Level:              vk.CommandBufferLevelPrimary,
-		CommandBufferCount: imageCount,
-	}
-	if result := vk.AllocateCommandBuffers(deviceHandle, &graphicsCmdBufferAllocateInfo, graphicsQueueCmdBuffers); result != vk.Success {
-		log.Err(vk.Error(result), "allocate graphics command buffers")
+	graphResources, err := pompeii.NewGraphResources(framework.BackendAllocator(), plan)
+	if err != nil {
+		log.Err(err, "create frame graph resources")
 		return
 	}
-	defer vk.FreeCommandBuffers(deviceHandle, graphicsQueueCmdPool, imageCount, graphicsQueueCmdBuffers)
+	defer graphResources.Destroy()
 
-	// Record the buffers
-	graphicsCmdBufferBeginInfo := vk.CommandBufferBeginInfo{
-		SType: vk.StructureTypeCommandBufferBeginInfo,
-		Flags: vk.CommandBufferUsageFlags(vk.CommandBufferUsageSimultaneousUseBit),
-	}
-	graphicsSubresourceRange := vk.ImageSubresourceRange{
-		AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
-		LevelCount: 1,
-		LayerCount: 1,
-	}
-	for i := range graphicsQueueCmdBuffers {
-		vk.BeginCommandBuffer(graphicsQueueCmdBuffers[i], &graphicsCmdBufferBeginInfo)
-
-		barrierFromPresentToDraw := vk.ImageMemoryBarrier{
-			SType:               vk.StructureTypeImageMemoryBarrier,
-			SrcAccessMask:       vk.AccessFlags(vk.AccessMemoryReadBit),
-			DstAccessMask:       vk.AccessFlags(vk.AccessColorAttachmentWriteBit),
-			OldLayout:           vk.ImageLayoutPresentSrc,
-			NewLayout:           vk.ImageLayoutPresentSrc,
-			SrcQueueFamilyIndex: uint32(device.PresentIndex),
-			DstQueueFamilyIndex: uint32(device.GraphicsIndex),
-			Image:               swapChainImages[i],
-			SubresourceRange:    graphicsSubresourceRange,
-		}
-		vk.CmdPipelineBarrier(graphicsQueueCmdBuffers[i], vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit), vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit), 0, 0, nil, 0, nil, 1, []vk.ImageMemoryBarrier{barrierFromPresentToDraw})
-
-		renderPassBeginInfo := vk.RenderPassBeginInfo{
-			SType:       vk.StructureTypeRenderPassBeginInfo,
-			RenderPass:  renderPass,
-			Framebuffer: framebuffers[i],
-			RenderArea: vk.Rect2D{
-				Offset: vk.Offset2D{
-					X: 0,
-					Y: 0,
-				},
-				Extent: vk.Extent2D{
-					Width:  framebufferWidth,
-					Height: framebufferHeight,
-				},
-			},
-			ClearValueCount: 1,
-			PClearValues: []vk.ClearValue{
-				vk.NewClearValue([]float32{1.0, 0.8, 0.4, 0.0}),
-			},
-		}
-		vk.CmdBeginRenderPass(graphicsQueueCmdBuffers[i], &renderPassBeginInfo, vk.SubpassContentsInline)
-		vk.CmdBindPipeline(graphicsQueueCmdBuffers[i], vk.PipelineBindPointGraphics, graphicsPipeline[0])
-		vk.CmdDraw(graphicsQueueCmdBuffers[i], 3, 1, 0, 0)
-		vk.CmdEndRenderPass(graphicsQueueCmdBuffers[i])
-
-		barrierFromDrawToPresent := vk.ImageMemoryBarrier{
-			SType:               vk.StructureTypeImageMemoryBarrier,
-			SrcAccessMask:       vk.AccessFlags(vk.AccessColorAttachmentWriteBit),
-			DstAccessMask:       vk.AccessFlags(vk.AccessMemoryReadBit),
-			OldLayout:           vk.ImageLayoutPresentSrc,
-			NewLayout:           vk.ImageLayoutPresentSrc,
-			SrcQueueFamilyIndex: uint32(device.GraphicsIndex),
-			DstQueueFamilyIndex: uint32(device.PresentIndex),
-			Image:               swapChainImages[i],
-			SubresourceRange:    graphicsSubresourceRange,
-		}
-		vk.CmdPipelineBarrier(graphicsQueueCmdBuffers[i], vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit), vk.PipelineStageFlags(vk.PipelineStageBottomOfPipeBit), 0, 0, nil, 0, nil, 1, []vk.ImageMemoryBarrier{barrierFromDrawToPresent})
+	// Record the frame's command buffer for the acquired image
+	recordCommandBuffer := func(cmd *pompeii.CommandBuffer, imageIndex uint32) error {
+		extent := swapchain.Extent
 
-		if result := vk.EndCommandBuffer(graphicsQueueCmdBuffers[i]); result != vk.Success {
-			log.Err(vk.Error(result), "record graphics command buffer")
-			return
+		if err := cmd.Begin(vk.CommandBufferUsageOneTimeSubmitBit); err != nil {
+			return err
 		}
+
+		graphResources.ImportImage(backbuffer, swapchain.Images[imageIndex])
+		pass := plan.Passes[0]
+		cmd.BeginLabel(pass.Name, [4]float32{})
+		cmd.GraphBarrier(pass.Before, graphResources)
+
+		cmd.BeginRenderPass(renderPass.Handle(), framebuffer.Handle(imageIndex), vk.Rect2D{Extent: extent}, []vk.ClearValue{
+			vk.NewClearValue([]float32{1.0, 0.8, 0.4, 0.0}),
+		}, vk.SubpassContentsInline)
+		cmd.BindPipeline(vk.PipelineBindPointGraphics, graphicsPipeline.Handle())
+		cmd.SetViewport(vk.Viewport{
+			Width:    float32(extent.Width),
+			Height:   float32(extent.Height),
+			MinDepth: 0.0,
+			MaxDepth: 1.0,
+		})
+		cmd.SetScissor(vk.Rect2D{
+			Extent: extent,
+		})
+		cmd.BindVertexBuffers(0, []vk.Buffer{vertexBuffer.Handle()}, []vk.DeviceSize{0})
+		cmd.Draw(uint32(len(vertices)/2), 1, 0, 0)
+		cmd.EndRenderPass()
+
+		cmd.GraphBarrier(pass.After, graphResources)
+		cmd.EndLabel()
+
+		return errors.Wrap(cmd.End(), "record graphics command buffer")
 	}
 	// -Set up render pass
 
 	fmt.Println("Drawing")
 	for !framework.ShouldClose() {
-		var imageIndex uint32
-		result := vk.AcquireNextImage(deviceHandle, swapchain, vk.MaxUint64, imageAvailableSemaphore.Handle(), vk.NullFence, &imageIndex)
-		switch result {
-		case vk.Success:
-			fallthrough
-		case vk.Suboptimal:
-		case vk.ErrorOutOfDate:
-			fmt.Println("aquire outdate")
-			log.Log("aquire outdate")
-		default:
-			log.Err(vk.Error(result), "aquire image")
+		frame, err := frames.Begin()
+		if err != nil {
+			log.Err(err, "begin frame")
 			return
 		}
 
-		submitInfo := vk.SubmitInfo{
-			SType:              vk.StructureTypeSubmitInfo,
-			WaitSemaphoreCount: 1,
-			PWaitSemaphores: []vk.Semaphore{
-				imageAvailableSemaphore.Handle(),
-			},
-			PWaitDstStageMask: []vk.PipelineStageFlags{
-				vk.PipelineStageFlags(vk.PipelineStageTransferBit),
-			},
-			CommandBufferCount: 1,
-			PCommandBuffers: []vk.CommandBuffer{
-				graphicsQueueCmdBuffers[imageIndex],
-			},
-			SignalSemaphoreCount: 1,
-			PSignalSemaphores: []vk.Semaphore{
-				renderingFinishedSemaphore.Handle(),
-			},
+		imageIndex, err := swapchain.Acquire(frame.ImageAvailable)
+		if err == pompeii.ErrSwapchainSuspended {
+			glfw.WaitEvents()
+			continue
+		} else if err != nil {
+			log.Err(err, "aquire image")
+			return
 		}
-		if result := vk.QueueSubmit(graphicsQueue, 1, []vk.SubmitInfo{
-			submitInfo,
-		}, vk.NullFence); result != vk.Success {
-			log.Err(vk.Error(result), "queue submit")
+
+		if _, err := framebuffer.Update(); err != nil {
+			log.Err(err, "create framebuffers")
 			return
 		}
 
-		presentInfo := vk.PresentInfo{
-			SType:              vk.StructureTypePresentInfo,
-			WaitSemaphoreCount: 1,
-			PWaitSemaphores: []vk.Semaphore{
-				renderingFinishedSemaphore.Handle(),
-			},
-			SwapchainCount: 1,
-			PSwapchains: []vk.Swapchain{
-				swapchain,
-			},
-			PImageIndices: []uint32{
-				imageIndex,
-			},
+		if err := recordCommandBuffer(frame.CommandBuffers[0], imageIndex); err != nil {
+			log.Err(err, "record frame")
+			return
 		}
-		result = vk.QueuePresent(presentQueue, &presentInfo)
-		switch result {
-		case vk.Success:
-			break
-		case vk.Suboptimal:
-			fallthrough
-		case vk.ErrorOutOfDate:
-			log.Log("present outdate")
-		default:
-			log.Err(vk.Error(result), "image present")
+		if err := frame.Submit(graphicsQueue, vk.PipelineStageColorAttachmentOutputBit); err != nil {
+			log.Err(err, "queue submit")
+			return
+		}
+
+		if err := swapchain.Present(presentQueue, imageIndex, frame.RenderFinished); err != nil {
+			log.Err(err, "image present")
 			return
 		}
 
@@ -1,8 +1,13 @@
 package myr
 
 import (
+	"os"
+	"strconv"
+	"strings"
+
 	"github.com/pkg/errors"
 	"github.com/vulkan-go/glfw/v3.3/glfw"
+	vk "github.com/vulkan-go/vulkan"
 
 	"github.com/perlw/abyssal_drifter/logger"
 	"github.com/perlw/abyssal_drifter/pompeii"
@@ -13,11 +18,15 @@ const engineName = "MYR"
 type Myr struct {
 	log logger.Logger
 
-	window   *glfw.Window
-	instance *pompeii.Instance
-	gpu      *pompeii.GPU
-	surface  pompeii.Surface
-	device   *pompeii.Device
+	window            *glfw.Window
+	instance          *pompeii.Instance
+	debug             *pompeii.DebugMessenger
+	gpu               *pompeii.GPU
+	surface           pompeii.Surface
+	device            *pompeii.Device
+	allocator         *pompeii.Allocator
+	cache             *pompeii.PipelineCache
+	descriptorLayouts *pompeii.DescriptorLayoutCache
 }
 
 func New(appName string, resWidth, resHeight int) (*Myr, error) {
@@ -27,7 +36,7 @@ func New(appName string, resWidth, resHeight int) (*Myr, error) {
 
 	glfw.Init()
 	glfw.WindowHint(glfw.ClientAPI, glfw.NoAPI)
-	glfw.WindowHint(glfw.Resizable, glfw.False)
+	glfw.WindowHint(glfw.Resizable, glfw.True)
 	var err error
 	m.window, err = glfw.CreateWindow(resWidth, resHeight, appName, nil, nil)
 	if err != nil {
@@ -38,11 +47,52 @@ func New(appName string, resWidth, resHeight int) (*Myr, error) {
 		return nil, err
 	}
 
-	extensions := m.window.GetRequiredInstanceExtensions()
-	m.instance, err = pompeii.NewInstance(appName, engineName, []string{
-		"VK_LAYER_LUNARG_standard_validation",
-		"VK_LAYER_LUNARG_assistant_layer",
-	}, append(extensions, "VK_EXT_debug_report"))
+	options := pompeii.InstanceOptions{
+		AppName:            appName,
+		AppVersion:         vk.MakeVersion(1, 0, 0),
+		EngineName:         engineName,
+		EngineVersion:      vk.MakeVersion(0, 0, 1),
+		APIVersion:         vk.MakeVersion(1, 2, 0),
+		RequiredExtensions: m.window.GetRequiredInstanceExtensions(),
+		// Lets GPUs report their newer features and driver on 1.0 instances.
+		OptionalExtensions: []string{"VK_KHR_get_physical_device_properties2"},
+		Validation:         m.validationOptions(),
+	}
+	debugExtension, err := pompeii.DebugExtension()
+	if err != nil {
+		m.log.Warn("No debug output: %s\n", err)
+	} else {
+		options.RequiredExtensions = append(options.RequiredExtensions, debugExtension)
+	}
+	m.instance, err = pompeii.NewInstance(options)
+	if err != nil {
+		return nil, err
+	}
+	m.log.Log("Instance: Vulkan %s\n", vk.Version(m.instance.APIVersion))
+	m.log.Log("Instance layers: %v\n", m.instance.Layers)
+	m.log.Log("Instance extensions: %v\n", m.instance.Extensions)
+	if options.Validation != nil {
+		if m.instance.ValidationLayer == "" {
+			m.log.Warn("Validation requested but no validation layer installed\n")
+		} else {
+			m.log.Log("Validation: %s (%s)\n", m.instance.ValidationLayer, m.instance.Validation)
+		}
+	}
+	if debugExtension != "" {
+		debugOptions := pompeii.DebugOptions{
+			Sink: m.debugMessage,
+		}
+		// Shader printf output arrives as info messages
+		if m.instance.Validation.DebugPrintf {
+			debugOptions.Severities = vk.DebugUtilsMessageSeverityInfoBit | vk.DebugUtilsMessageSeverityWarningBit | vk.DebugUtilsMessageSeverityErrorBit
+		}
+		m.debug, err = pompeii.NewDebugMessenger(m.instance, debugOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m.surface, err = pompeii.NewWindowSurface(m.instance, m.window)
 	if err != nil {
 		return nil, err
 	}
@@ -53,50 +103,134 @@ func New(appName string, resWidth, resHeight int) (*Myr, error) {
 	}
 	for t, gpu := range gpus {
 		m.log.Log("# GPU %d\n%s", t, gpu.Debug())
-		m.log.Log(gpu.Debug())
-		if gpu.Match(uint32(resWidth), uint32(resHeight)) {
-			m.gpu = &gpus[t]
-		}
 	}
-	if m.gpu == nil {
-		return nil, errors.New("no matching GPU")
+	policy := pompeii.GPUPolicy{
+		RequiredExtensions: []string{"VK_KHR_swapchain"},
+		MinViewportWidth:   uint32(resWidth),
+		MinViewportHeight:  uint32(resHeight),
+		PresentSurface:     m.surface,
+		Override:           gpuOverride(),
+	}
+	var candidates []pompeii.GPUCandidate
+	m.gpu, candidates, err = pompeii.SelectGPU(gpus, policy)
+	for _, candidate := range candidates {
+		if candidate.Rejected() {
+			m.log.Warn("%s", candidate)
+		} else {
+			m.log.Log("%s", candidate)
+		}
 	}
-	m.log.Log("Picked: %s\n", m.gpu.Name)
-
-	m.surface, err = pompeii.NewWindowSurface(m.instance, m.window)
 	if err != nil {
 		return nil, err
 	}
+	m.log.Log("Picked: %s\n", m.gpu.Name)
 
 	families, err := m.gpu.QueueFamilies()
 	if err != nil {
 		return nil, errors.Wrap(err, "could not get families")
 	}
 	m.log.Log("Queue families: %d\n", len(families))
-	graphicsFamily := -1
-	presentFamily := -1
 	for _, family := range families {
 		m.log.Log("%+v\n", family)
-		if family.Graphics {
-			graphicsFamily = family.Index
-			if family.SurfacePresentSupport(m.surface) {
-				m.log.Log("Family %d => present support\n", family.Index)
-				presentFamily = family.Index
-			}
-		}
 	}
-	m.device, err = pompeii.NewDevice(m.gpu, graphicsFamily, presentFamily)
+	plan, err := pompeii.PlanQueues(families, pompeii.QueuePlanOptions{
+		Surface: m.surface,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not plan queues")
+	}
+	m.log.Log("Queue plan: %+v\n", *plan)
+	m.device, err = pompeii.NewDevice(m.gpu, plan, pompeii.DeviceOptions{
+		RequiredExtensions: []string{"VK_KHR_swapchain"},
+	})
 	if err != nil {
 		return nil, err
 	}
+	m.log.Log("Device extensions: %v\n", m.device.Extensions)
+
+	m.allocator = pompeii.NewAllocator(m.gpu, m.device, pompeii.AllocatorOptions{})
+	m.descriptorLayouts = pompeii.NewDescriptorLayoutCache(m.device)
+
+	cachePath, err := pompeii.PipelineCachePath(appName)
+	if err != nil {
+		m.log.Warn("No pipeline cache on disk: %s\n", err)
+	}
+	m.cache, err = pompeii.NewPipelineCache(m.gpu, m.device, cachePath)
+	if err != nil {
+		return nil, err
+	}
+	if m.cache.Discarded != nil {
+		m.log.Warn("Discarded %s\n", m.cache.Discarded)
+	}
 
 	return &m, nil
 }
 
+// validationOptions reads MYR_VALIDATION, either "off" or a comma separated
+// list of extra checks: gpu, sync, best and printf. Core validation is on by
+// default.
+func (m *Myr) validationOptions() *pompeii.ValidationOptions {
+	value := os.Getenv("MYR_VALIDATION")
+	if value == "off" {
+		return nil
+	}
+	options := pompeii.ValidationOptions{}
+	for _, check := range strings.Split(value, ",") {
+		switch strings.TrimSpace(check) {
+		case "":
+		case "gpu":
+			options.GPUAssisted = true
+		case "sync":
+			options.Synchronization = true
+		case "best":
+			options.BestPractices = true
+		case "printf":
+			options.DebugPrintf = true
+		default:
+			m.log.Warn("Unknown validation check %q in MYR_VALIDATION\n", check)
+		}
+	}
+	return &options
+}
+
+// gpuOverride lets MYR_GPU force a GPU, either by index or by (part of) name.
+func gpuOverride() *pompeii.GPUOverride {
+	value := os.Getenv("MYR_GPU")
+	if value == "" {
+		return nil
+	}
+	if index, err := strconv.Atoi(value); err == nil {
+		return &pompeii.GPUOverride{Index: index}
+	}
+	return &pompeii.GPUOverride{Name: value}
+}
+
+func (m *Myr) debugMessage(message pompeii.DebugMessage) {
+	switch message.Severity {
+	case vk.DebugUtilsMessageSeverityErrorBit:
+		m.log.Err(nil, "%s\n", message)
+	case vk.DebugUtilsMessageSeverityWarningBit:
+		m.log.Warn("%s\n", message)
+	default:
+		m.log.Log("%s\n", message)
+	}
+}
+
 func (m *Myr) Destroy() {
+	m.device.WaitIdle()
+	m.log.Log("Memory: %s\n", m.allocator.Stats())
+	if err := m.cache.Save(); err != nil {
+		m.log.Warn("Could not save pipeline cache: %s\n", err)
+	}
+	m.cache.Destroy()
+	m.descriptorLayouts.Destroy()
+	m.allocator.Destroy()
 	m.device.Destroy()
 	m.surface.Destroy()
 
+	if m.debug != nil {
+		m.debug.Destroy()
+	}
 	m.instance.Destroy()
 	m.window.Destroy()
 
@@ -122,3 +256,15 @@ func (m Myr) BackendSurface() pompeii.Surface {
 func (m Myr) BackendDevice() *pompeii.Device {
 	return m.device
 }
+
+func (m Myr) BackendAllocator() *pompeii.Allocator {
+	return m.allocator
+}
+
+func (m Myr) BackendPipelineCache() *pompeii.PipelineCache {
+	return m.cache
+}
+
+func (m Myr) BackendDescriptorLayouts() *pompeii.DescriptorLayoutCache {
+	return m.descriptorLayouts
+}
@@ -0,0 +1,545 @@
+package pompeii
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	defaultBlockSize = 64 << 20
+	// Mapped slices are capped at this size.
+	maxMappedSize = 1 << 30
+)
+
+type AllocatorOptions struct {
+	// BlockSize of the vk.DeviceMemory blocks that get sub-allocated, 64MiB
+	// if zero. Small heaps get smaller blocks.
+	BlockSize uint64
+}
+
+// MemoryRequest describes where an allocation should live.
+type MemoryRequest struct {
+	// Required property flags, types lacking any of them are never used.
+	Required vk.MemoryPropertyFlagBits
+	// Preferred property flags, the type matching the most of them wins.
+	Preferred vk.MemoryPropertyFlagBits
+
+	Kind     ResourceKind
+	Strategy AllocationStrategy
+	// Mapped keeps the allocation mapped for its whole lifetime, needs a
+	// host visible memory type.
+	Mapped bool
+	// Dedicated gives the allocation its own vk.DeviceMemory. Large
+	// allocations are always dedicated.
+	Dedicated bool
+}
+
+// MemoryTypeStats is a snapshot of a single memory type's usage.
+type MemoryTypeStats struct {
+	MemoryType int
+	Heap       int
+	Flags      vk.MemoryPropertyFlags
+
+	Blocks               int
+	BlockBytes           uint64
+	Allocations          int
+	UsedBytes            uint64
+	DedicatedAllocations int
+	DedicatedBytes       uint64
+}
+
+type AllocatorStats struct {
+	Types []MemoryTypeStats
+
+	Blocks      int
+	Allocations int
+	// AllocatedBytes is what was taken from the driver, UsedBytes what was
+	// handed out of it.
+	AllocatedBytes uint64
+	UsedBytes      uint64
+}
+
+func (s AllocatorStats) String() string {
+	return fmt.Sprintf("%d allocations, %d/%d bytes used in %d blocks", s.Allocations, s.UsedBytes, s.AllocatedBytes, s.Blocks)
+}
+
+type memoryBlock struct {
+	memoryType int
+	memory     vk.DeviceMemory
+	size       uint64
+	sub        subAllocator
+	mapped     unsafe.Pointer
+}
+
+type poolKey struct {
+	memoryType int
+	strategy   AllocationStrategy
+}
+
+// Allocator sub-allocates device memory in blocks, one set of blocks per
+// memory type and strategy. It is safe for concurrent use.
+type Allocator struct {
+	mutex sync.Mutex
+
+	device             *Device
+	memoryTypes        []vk.MemoryType
+	heapSizes          []uint64
+	blockSize          uint64
+	granularity        uint64
+	nonCoherentAtom    uint64
+	pools              map[poolKey][]*memoryBlock
+	dedicated          map[*Allocation]struct{}
+	dedicatedPerType   []int
+	dedicatedBytesType []uint64
+}
+
+func NewAllocator(g *GPU, d *Device, options AllocatorOptions) *Allocator {
+	a := Allocator{
+		device:          d,
+		blockSize:       options.BlockSize,
+		granularity:     uint64(g.props.Limits.BufferImageGranularity),
+		nonCoherentAtom: uint64(g.props.Limits.NonCoherentAtomSize),
+		pools:           map[poolKey][]*memoryBlock{},
+		dedicated:       map[*Allocation]struct{}{},
+	}
+	if a.blockSize == 0 {
+		a.blockSize = defaultBlockSize
+	}
+
+	for t := uint32(0); t < g.memProps.MemoryHeapCount; t++ {
+		heap := g.memProps.MemoryHeaps[t]
+		heap.Deref()
+		a.heapSizes = append(a.heapSizes, uint64(heap.Size))
+	}
+	for t := uint32(0); t < g.memProps.MemoryTypeCount; t++ {
+		memoryType := g.memProps.MemoryTypes[t]
+		memoryType.Deref()
+		a.memoryTypes = append(a.memoryTypes, memoryType)
+	}
+	a.dedicatedPerType = make([]int, len(a.memoryTypes))
+	a.dedicatedBytesType = make([]uint64, len(a.memoryTypes))
+
+	return &a
+}
+
+// Destroy frees all memory, allocations still alive become invalid.
+func (a *Allocator) Destroy() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for key, blocks := range a.pools {
+		for _, block := range blocks {
+			a.freeBlock(block)
+		}
+		delete(a.pools, key)
+	}
+	for allocation := range a.dedicated {
+		a.freeBlock(allocation.block)
+		delete(a.dedicated, allocation)
+	}
+}
+
+// MemoryTypes returns the candidate memory types for typeBits, best first.
+func (a *Allocator) MemoryTypes(typeBits uint32, required, preferred vk.MemoryPropertyFlagBits) []int {
+	return rankMemoryTypes(a.memoryTypes, typeBits, required, preferred)
+}
+
+// FindMemoryType returns the best memory type for typeBits.
+func (a *Allocator) FindMemoryType(typeBits uint32, required, preferred vk.MemoryPropertyFlagBits) (int, error) {
+	candidates := a.MemoryTypes(typeBits, required, preferred)
+	if len(candidates) == 0 {
+		return -1, errors.Errorf("no memory type with flags 0x%x in type bits 0x%x", required, typeBits)
+	}
+	return candidates[0], nil
+}
+
+func rankMemoryTypes(memoryTypes []vk.MemoryType, typeBits uint32, required, preferred vk.MemoryPropertyFlagBits) []int {
+	candidates := []int{}
+	scores := []int{}
+	for t, memoryType := range memoryTypes {
+		flags := vk.MemoryPropertyFlagBits(memoryType.PropertyFlags)
+		if typeBits&(1<<uint(t)) == 0 || flags&required != required {
+			continue
+		}
+
+		score := 0
+		for bit := vk.MemoryPropertyFlagBits(1); bit <= preferred; bit <<= 1 {
+			if preferred&bit != 0 && flags&bit != 0 {
+				score++
+			}
+		}
+
+		// Insertion sort, keeping the driver's order for equal scores.
+		at := len(candidates)
+		for at > 0 && scores[at-1] < score {
+			at--
+		}
+		candidates = append(candidates[:at], append([]int{t}, candidates[at:]...)...)
+		scores = append(scores[:at], append([]int{score}, scores[at:]...)...)
+	}
+	return candidates
+}
+
+// Allocate finds memory for requirements, trying the next candidate memory
+// type when one runs out.
+func (a *Allocator) Allocate(requirements vk.MemoryRequirements, request MemoryRequest) (*Allocation, error) {
+	requirements.Deref()
+	required := request.Required
+	if request.Mapped {
+		required |= vk.MemoryPropertyHostVisibleBit
+	}
+
+	candidates := a.MemoryTypes(requirements.MemoryTypeBits, required, request.Preferred)
+	if len(candidates) == 0 {
+		return nil, errors.Errorf("allocate memory: no memory type with flags 0x%x in type bits 0x%x", required, requirements.MemoryTypeBits)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var err error
+	for _, memoryType := range candidates {
+		var allocation *Allocation
+		allocation, err = a.allocate(memoryType, uint64(requirements.Size), uint64(requirements.Alignment), request)
+		if err == nil {
+			return allocation, nil
+		}
+		if cause := errors.Cause(err); cause != vk.Error(vk.ErrorOutOfDeviceMemory) && cause != vk.Error(vk.ErrorOutOfHostMemory) {
+			break
+		}
+	}
+	return nil, errors.Wrap(err, "allocate memory")
+}
+
+// AllocateBuffer allocates memory for buffer and binds it.
+func (a *Allocator) AllocateBuffer(buffer vk.Buffer, request MemoryRequest) (*Allocation, error) {
+	var requirements vk.MemoryRequirements
+	vk.GetBufferMemoryRequirements(a.device.Handle(), buffer, &requirements)
+	request.Kind = ResourceLinear
+
+	allocation, err := a.Allocate(requirements, request)
+	if err != nil {
+		return nil, err
+	}
+	if result := vk.BindBufferMemory(a.device.Handle(), buffer, allocation.Memory(), vk.DeviceSize(allocation.Offset)); result != vk.Success {
+		allocation.Free()
+		return nil, errors.Wrap(vk.Error(result), "bind buffer memory")
+	}
+	return allocation, nil
+}
+
+// AllocateImage allocates memory for image and binds it. Linear tiled images
+// should pass ResourceLinear as Kind, anything else is treated as optimal.
+func (a *Allocator) AllocateImage(image vk.Image, request MemoryRequest) (*Allocation, error) {
+	var requirements vk.MemoryRequirements
+	vk.GetImageMemoryRequirements(a.device.Handle(), image, &requirements)
+	if request.Kind != ResourceLinear {
+		request.Kind = ResourceOptimal
+	}
+
+	allocation, err := a.Allocate(requirements, request)
+	if err != nil {
+		return nil, err
+	}
+	if result := vk.BindImageMemory(a.device.Handle(), image, allocation.Memory(), vk.DeviceSize(allocation.Offset)); result != vk.Success {
+		allocation.Free()
+		return nil, errors.Wrap(vk.Error(result), "bind image memory")
+	}
+	return allocation, nil
+}
+
+func (a *Allocator) allocate(memoryType int, size, alignment uint64, request MemoryRequest) (*Allocation, error) {
+	blockSize := a.blockSizeFor(memoryType)
+	if request.Dedicated || size > blockSize/2 {
+		block, err := a.newBlock(memoryType, size, request.Strategy, request.Mapped)
+		if err != nil {
+			return nil, err
+		}
+		allocation := Allocation{
+			Size:       size,
+			MemoryType: memoryType,
+			Dedicated:  true,
+			flags:      a.memoryTypes[memoryType].PropertyFlags,
+			allocator:  a,
+			block:      block,
+		}
+		a.dedicated[&allocation] = struct{}{}
+		a.dedicatedPerType[memoryType]++
+		a.dedicatedBytesType[memoryType] += size
+		return &allocation, nil
+	}
+
+	key := poolKey{
+		memoryType: memoryType,
+		strategy:   request.Strategy,
+	}
+	for _, block := range a.pools[key] {
+		offset, ok := block.sub.alloc(size, alignment, request.Kind)
+		if !ok {
+			continue
+		}
+		if request.Mapped {
+			if err := a.mapBlock(block); err != nil {
+				block.sub.free(offset)
+				return nil, err
+			}
+		}
+		return &Allocation{
+			Offset:     offset,
+			Size:       size,
+			MemoryType: memoryType,
+			flags:      a.memoryTypes[memoryType].PropertyFlags,
+			allocator:  a,
+			block:      block,
+			key:        key,
+		}, nil
+	}
+
+	block, err := a.newBlock(memoryType, blockSize, request.Strategy, request.Mapped)
+	if err != nil {
+		return nil, err
+	}
+	offset, ok := block.sub.alloc(size, alignment, request.Kind)
+	if !ok {
+		a.freeBlock(block)
+		return nil, errors.Errorf("%d bytes do not fit a new block", size)
+	}
+	a.pools[key] = append(a.pools[key], block)
+	return &Allocation{
+		Offset:     offset,
+		Size:       size,
+		MemoryType: memoryType,
+		flags:      a.memoryTypes[memoryType].PropertyFlags,
+		allocator:  a,
+		block:      block,
+		key:        key,
+	}, nil
+}
+
+func (a *Allocator) blockSizeFor(memoryType int) uint64 {
+	heapSize := a.heapSizes[a.memoryTypes[memoryType].HeapIndex]
+	if heapSize/8 < a.blockSize {
+		return alignUp(heapSize/8, 1<<20)
+	}
+	return a.blockSize
+}
+
+func (a *Allocator) newBlock(memoryType int, size uint64, strategy AllocationStrategy, mapped bool) (*memoryBlock, error) {
+	block := memoryBlock{
+		memoryType: memoryType,
+		size:       size,
+		sub:        newSubAllocator(strategy, size, a.granularity),
+	}
+
+	memoryAllocateInfo := vk.MemoryAllocateInfo{
+		SType:           vk.StructureTypeMemoryAllocateInfo,
+		AllocationSize:  vk.DeviceSize(size),
+		MemoryTypeIndex: uint32(memoryType),
+	}
+	if result := vk.AllocateMemory(a.device.Handle(), &memoryAllocateInfo, nil, &block.memory); result != vk.Success {
+		return nil, vk.Error(result)
+	}
+	if mapped {
+		if err := a.mapBlock(&block); err != nil {
+			a.freeBlock(&block)
+			return nil, err
+		}
+	}
+
+	return &block, nil
+}
+
+// mapBlock maps the whole block once, it stays mapped until it is freed.
+func (a *Allocator) mapBlock(block *memoryBlock) error {
+	if block.mapped != nil {
+		return nil
+	}
+	if result := vk.MapMemory(a.device.Handle(), block.memory, 0, vk.DeviceSize(vk.WholeSize), 0, &block.mapped); result != vk.Success {
+		return errors.Wrap(vk.Error(result), "map memory")
+	}
+	return nil
+}
+
+func (a *Allocator) freeBlock(block *memoryBlock) {
+	if block.mapped != nil {
+		vk.UnmapMemory(a.device.Handle(), block.memory)
+		block.mapped = nil
+	}
+	vk.FreeMemory(a.device.Handle(), block.memory, nil)
+	block.memory = vk.NullDeviceMemory
+}
+
+func (a *Allocator) free(allocation *Allocation) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if allocation.Dedicated {
+		if _, ok := a.dedicated[allocation]; !ok {
+			return
+		}
+		delete(a.dedicated, allocation)
+		a.dedicatedPerType[allocation.MemoryType]--
+		a.dedicatedBytesType[allocation.MemoryType] -= allocation.Size
+		a.freeBlock(allocation.block)
+		return
+	}
+
+	block := allocation.block
+	block.sub.free(allocation.Offset)
+	if block.sub.count() > 0 {
+		return
+	}
+
+	// Keep one empty block per pool around to avoid thrashing.
+	blocks := a.pools[allocation.key]
+	empty := 0
+	for _, b := range blocks {
+		if b.sub.count() == 0 {
+			empty++
+		}
+	}
+	if empty < 2 {
+		return
+	}
+	for t, b := range blocks {
+		if b == block {
+			a.pools[allocation.key] = append(blocks[:t], blocks[t+1:]...)
+			break
+		}
+	}
+	a.freeBlock(block)
+}
+
+func (a *Allocator) Stats() AllocatorStats {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	stats := AllocatorStats{
+		Types: make([]MemoryTypeStats, len(a.memoryTypes)),
+	}
+	for t, memoryType := range a.memoryTypes {
+		stats.Types[t] = MemoryTypeStats{
+			MemoryType:           t,
+			Heap:                 int(memoryType.HeapIndex),
+			Flags:                memoryType.PropertyFlags,
+			DedicatedAllocations: a.dedicatedPerType[t],
+			DedicatedBytes:       a.dedicatedBytesType[t],
+		}
+	}
+	for key, blocks := range a.pools {
+		typeStats := &stats.Types[key.memoryType]
+		for _, block := range blocks {
+			typeStats.Blocks++
+			typeStats.BlockBytes += block.size
+			typeStats.Allocations += block.sub.count()
+			typeStats.UsedBytes += block.sub.used()
+		}
+	}
+	for _, typeStats := range stats.Types {
+		stats.Blocks += typeStats.Blocks
+		stats.Allocations += typeStats.Allocations + typeStats.DedicatedAllocations
+		stats.AllocatedBytes += typeStats.BlockBytes + typeStats.DedicatedBytes
+		stats.UsedBytes += typeStats.UsedBytes + typeStats.DedicatedBytes
+	}
+	return stats
+}
+
+// Allocation is a range of device memory handed out by an Allocator.
+type Allocation struct {
+	Offset     uint64
+	Size       uint64
+	MemoryType int
+	Dedicated  bool
+
+	// flags of the memory type, kept so they outlive Free.
+	flags     vk.MemoryPropertyFlags
+	allocator *Allocator
+	block     *memoryBlock
+	key       poolKey
+}
+
+func (a *Allocation) Free() {
+	if a.allocator == nil {
+		return
+	}
+	a.allocator.free(a)
+	a.allocator = nil
+	a.block = nil
+}
+
+// Memory returns vk.NullDeviceMemory once the allocation is freed.
+func (a *Allocation) Memory() vk.DeviceMemory {
+	if a.block == nil {
+		return vk.NullDeviceMemory
+	}
+	return a.block.memory
+}
+
+func (a *Allocation) Flags() vk.MemoryPropertyFlags {
+	return a.flags
+}
+
+// Mapped returns the allocation's host memory, nil unless it was allocated
+// with MemoryRequest.Mapped.
+func (a *Allocation) Mapped() []byte {
+	if a.block == nil || a.block.mapped == nil {
+		return nil
+	}
+	size := a.Size
+	if size > maxMappedSize {
+		size = maxMappedSize
+	}
+	ptr := unsafe.Pointer(uintptr(a.block.mapped) + uintptr(a.Offset))
+	return (*[maxMappedSize]byte)(ptr)[:size:size]
+}
+
+// Flush makes host writes visible to the device, a no-op for host coherent
+// memory.
+func (a *Allocation) Flush() error {
+	ranges, ok := a.mappedRange()
+	if !ok {
+		return nil
+	}
+	if result := vk.FlushMappedMemoryRanges(a.allocator.device.Handle(), 1, ranges); result != vk.Success {
+		return errors.Wrap(vk.Error(result), "flush mapped memory")
+	}
+	return nil
+}
+
+// Invalidate makes device writes visible to the host, a no-op for host
+// coherent memory.
+func (a *Allocation) Invalidate() error {
+	ranges, ok := a.mappedRange()
+	if !ok {
+		return nil
+	}
+	if result := vk.InvalidateMappedMemoryRanges(a.allocator.device.Handle(), 1, ranges); result != vk.Success {
+		return errors.Wrap(vk.Error(result), "invalidate mapped memory")
+	}
+	return nil
+}
+
+// mappedRange covers the allocation rounded out to nonCoherentAtomSize.
+func (a *Allocation) mappedRange() ([]vk.MappedMemoryRange, bool) {
+	if a.allocator == nil || a.block.mapped == nil || a.Flags()&vk.MemoryPropertyFlags(vk.MemoryPropertyHostCoherentBit) != 0 {
+		return nil, false
+	}
+	atom := a.allocator.nonCoherentAtom
+	offset := alignDown(a.Offset, atom)
+	end := alignUp(a.Offset+a.Size, atom)
+	if end > a.block.size {
+		end = a.block.size
+	}
+	return []vk.MappedMemoryRange{
+		{
+			SType:  vk.StructureTypeMappedMemoryRange,
+			Memory: a.block.memory,
+			Offset: vk.DeviceSize(offset),
+			Size:   vk.DeviceSize(end - offset),
+		},
+	}, true
+}
@@ -0,0 +1,160 @@
+package pompeii
+
+import (
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+var (
+	// HostMemory is persistently mapped memory the CPU writes and the GPU
+	// reads, e.g. staging and per-frame uniform buffers.
+	HostMemory = MemoryRequest{
+		Required:  vk.MemoryPropertyHostVisibleBit,
+		Preferred: vk.MemoryPropertyHostCoherentBit,
+		Mapped:    true,
+	}
+	// ReadbackMemory is mapped memory the GPU writes and the CPU reads.
+	ReadbackMemory = MemoryRequest{
+		Required:  vk.MemoryPropertyHostVisibleBit,
+		Preferred: vk.MemoryPropertyHostCachedBit,
+		Mapped:    true,
+	}
+	// DeviceMemory is fast GPU memory, filled through uploads.
+	DeviceMemory = MemoryRequest{
+		Preferred: vk.MemoryPropertyDeviceLocalBit,
+	}
+)
+
+type Buffer struct {
+	Size  uint64
+	Usage vk.BufferUsageFlagBits
+
+	allocator  *Allocator
+	allocation *Allocation
+	buffer     vk.Buffer
+}
+
+func NewBuffer(a *Allocator, size uint64, usage vk.BufferUsageFlagBits, memory MemoryRequest) (*Buffer, error) {
+	b := Buffer{
+		Size:      size,
+		Usage:     usage,
+		allocator: a,
+	}
+
+	bufferCreateInfo := vk.BufferCreateInfo{
+		SType:       vk.StructureTypeBufferCreateInfo,
+		Size:        vk.DeviceSize(size),
+		Usage:       vk.BufferUsageFlags(usage),
+		SharingMode: vk.SharingModeExclusive,
+	}
+	if result := vk.CreateBuffer(a.device.Handle(), &bufferCreateInfo, nil, &b.buffer); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "create buffer")
+	}
+
+	var err error
+	if b.allocation, err = a.AllocateBuffer(b.buffer, memory); err != nil {
+		b.Destroy()
+		return nil, errors.Wrap(err, "create buffer")
+	}
+
+	return &b, nil
+}
+
+// NewHostBuffer creates a mapped buffer, written to directly with Write.
+func NewHostBuffer(a *Allocator, size uint64, usage vk.BufferUsageFlagBits) (*Buffer, error) {
+	return NewBuffer(a, size, usage, HostMemory)
+}
+
+// NewDeviceBuffer creates a device local buffer, filled with Upload.
+func NewDeviceBuffer(a *Allocator, size uint64, usage vk.BufferUsageFlagBits) (*Buffer, error) {
+	return NewBuffer(a, size, usage|vk.BufferUsageTransferDstBit, DeviceMemory)
+}
+
+func (b *Buffer) Destroy() {
+	if b.buffer != vk.NullBuffer {
+		vk.DestroyBuffer(b.allocator.device.Handle(), b.buffer, nil)
+		b.buffer = vk.NullBuffer
+	}
+	if b.allocation != nil {
+		b.allocation.Free()
+		b.allocation = nil
+	}
+}
+
+// Mapped returns the buffer's memory, nil unless it is host visible.
+func (b *Buffer) Mapped() []byte {
+	return b.allocation.Mapped()
+}
+
+func (b *Buffer) HostVisible() bool {
+	return b.allocation.Mapped() != nil
+}
+
+// Write copies data into a host visible buffer at offset.
+func (b *Buffer) Write(offset uint64, data []byte) error {
+	mapped := b.Mapped()
+	if mapped == nil {
+		return errors.New("write buffer: not host visible")
+	}
+	if offset+uint64(len(data)) > b.Size {
+		return errors.Errorf("write buffer: %d bytes at %d overflow %d byte buffer", len(data), offset, b.Size)
+	}
+	copy(mapped[offset:], data)
+	return b.allocation.Flush()
+}
+
+// Read copies from a host visible buffer at offset into data.
+func (b *Buffer) Read(offset uint64, data []byte) error {
+	mapped := b.Mapped()
+	if mapped == nil {
+		return errors.New("read buffer: not host visible")
+	}
+	if offset+uint64(len(data)) > b.Size {
+		return errors.Errorf("read buffer: %d bytes at %d overflow %d byte buffer", len(data), offset, b.Size)
+	}
+	if err := b.allocation.Invalidate(); err != nil {
+		return err
+	}
+	copy(data, mapped[offset:])
+	return nil
+}
+
+// Upload writes data at offset, through a staging buffer and a copy
+// recorded from pool and run on queue if the buffer isn't host visible.
+// Blocks until the copy is done.
+func (b *Buffer) Upload(pool *CommandPool, queue *Queue, offset uint64, data []byte) error {
+	if b.HostVisible() {
+		return b.Write(offset, data)
+	}
+	if offset+uint64(len(data)) > b.Size {
+		return errors.Errorf("upload buffer: %d bytes at %d overflow %d byte buffer", len(data), offset, b.Size)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	staging, err := NewHostBuffer(b.allocator, uint64(len(data)), vk.BufferUsageTransferSrcBit)
+	if err != nil {
+		return errors.Wrap(err, "upload buffer")
+	}
+	defer staging.Destroy()
+	if err := staging.Write(0, data); err != nil {
+		return errors.Wrap(err, "upload buffer")
+	}
+
+	err = pool.OneTimeSubmit(queue, func(cmd *CommandBuffer) {
+		cmd.CopyBuffer(staging.Handle(), b.buffer, vk.BufferCopy{
+			DstOffset: vk.DeviceSize(offset),
+			Size:      vk.DeviceSize(len(data)),
+		})
+	})
+	return errors.Wrap(err, "upload buffer")
+}
+
+func (b *Buffer) Allocation() *Allocation {
+	return b.allocation
+}
+
+func (b *Buffer) Handle() vk.Buffer {
+	return b.buffer
+}
@@ -0,0 +1,247 @@
+package pompeii
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	pipelineCacheHeaderSize    = 16 + vk.UuidSize
+	pipelineCacheHeaderVersion = 1
+)
+
+// PipelineCachePath returns where the pipeline cache for app is kept, inside
+// the user's cache directory.
+func PipelineCachePath(app string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Wrap(err, "find user cache dir")
+	}
+	return filepath.Join(dir, app, "pipeline.cache"), nil
+}
+
+// PipelineCache wraps a vk.PipelineCache that is loaded from and saved to
+// disk. Pipelines may be built against it from several goroutines, but
+// workers that build a lot are better off with a Fork each which is merged
+// back when they are done. Merge waits for builds using the cache to finish.
+type PipelineCache struct {
+	Path string
+	// Discarded is why the file at Path was not used, nil if it was loaded
+	// or didn't exist.
+	Discarded error
+
+	// mutex is held exclusively by Merge, which needs the only access to
+	// the cache, and shared by everything else.
+	mutex         sync.RWMutex
+	props         vk.PhysicalDeviceProperties
+	logicalDevice vk.Device
+	cache         vk.PipelineCache
+}
+
+// NewPipelineCache loads the cache at path, an empty path gives a cache that
+// is never saved. Files that are unreadable or were written by another
+// device or driver are discarded, see Discarded.
+func NewPipelineCache(g *GPU, d *Device, path string) (*PipelineCache, error) {
+	c := PipelineCache{
+		Path:          path,
+		props:         g.props,
+		logicalDevice: d.Handle(),
+	}
+
+	var data []byte
+	if path != "" {
+		var err error
+		data, err = ioutil.ReadFile(path)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			c.Discarded = errors.Wrap(err, "read pipeline cache")
+			data = nil
+		default:
+			if err := validatePipelineCache(data, &c.props); err != nil {
+				c.Discarded = errors.Wrapf(err, "pipeline cache %s", path)
+				data = nil
+			}
+		}
+	}
+
+	if err := c.create(data); err != nil {
+		if data == nil {
+			return nil, err
+		}
+		// Drivers validate the blob beyond the header, start over if they
+		// refuse it.
+		c.Discarded = errors.Wrapf(err, "pipeline cache %s", path)
+		if err := c.create(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
+
+func (c *PipelineCache) create(data []byte) error {
+	createInfo := vk.PipelineCacheCreateInfo{
+		SType: vk.StructureTypePipelineCacheCreateInfo,
+	}
+	if len(data) > 0 {
+		createInfo.InitialDataSize = uint(len(data))
+		createInfo.PInitialData = unsafe.Pointer(&data[0])
+	}
+	if result := vk.CreatePipelineCache(c.logicalDevice, &createInfo, nil, &c.cache); result != vk.Success {
+		return errors.Wrap(vk.Error(result), "create pipeline cache")
+	}
+	return nil
+}
+
+// validatePipelineCache checks the header every cache blob starts with
+// against the device the cache is meant for.
+func validatePipelineCache(data []byte, props *vk.PhysicalDeviceProperties) error {
+	if len(data) < pipelineCacheHeaderSize {
+		return errors.Errorf("truncated header, %d bytes", len(data))
+	}
+	le := binary.LittleEndian
+	headerSize := le.Uint32(data)
+	version := le.Uint32(data[4:])
+	vendorID := le.Uint32(data[8:])
+	deviceID := le.Uint32(data[12:])
+	uuid := data[16:pipelineCacheHeaderSize]
+
+	switch {
+	case headerSize < pipelineCacheHeaderSize || int(headerSize) > len(data):
+		return errors.Errorf("invalid header size %d", headerSize)
+	case version != pipelineCacheHeaderVersion:
+		return errors.Errorf("unknown header version %d", version)
+	case vendorID != props.VendorID || deviceID != props.DeviceID:
+		return errors.Errorf("written by device %04x:%04x, not %04x:%04x", vendorID, deviceID, props.VendorID, props.DeviceID)
+	case !bytes.Equal(uuid, props.PipelineCacheUUID[:]):
+		return errors.New("written by another driver")
+	}
+	return nil
+}
+
+// Fork creates an empty, unsaved cache on the same device for a worker.
+func (c *PipelineCache) Fork() (*PipelineCache, error) {
+	fork := PipelineCache{
+		props:         c.props,
+		logicalDevice: c.logicalDevice,
+	}
+	if err := fork.create(nil); err != nil {
+		return nil, err
+	}
+	return &fork, nil
+}
+
+// Merge folds the contents of caches into c, the caches are left as is.
+func (c *PipelineCache) Merge(caches ...*PipelineCache) error {
+	if len(caches) == 0 {
+		return nil
+	}
+	handles := make([]vk.PipelineCache, len(caches))
+	for t, cache := range caches {
+		if cache == c {
+			return errors.New("merge pipeline cache into itself")
+		}
+		handles[t] = cache.cache
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if result := vk.MergePipelineCaches(c.logicalDevice, c.cache, uint32(len(handles)), handles); result != vk.Success {
+		return errors.Wrap(vk.Error(result), "merge pipeline caches")
+	}
+	return nil
+}
+
+// Data returns the current contents as the driver serializes them.
+func (c *PipelineCache) Data() ([]byte, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var size uint
+	if result := vk.GetPipelineCacheData(c.logicalDevice, c.cache, &size, nil); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "get pipeline cache size")
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	data := make([]byte, size)
+	if result := vk.GetPipelineCacheData(c.logicalDevice, c.cache, &size, unsafe.Pointer(&data[0])); result != vk.Success && result != vk.Incomplete {
+		return nil, errors.Wrap(vk.Error(result), "get pipeline cache data")
+	}
+	return data[:size], nil
+}
+
+// Save writes the cache to Path through a temporary file, so a crash never
+// leaves a half written cache behind.
+func (c *PipelineCache) Save() error {
+	if c.Path == "" {
+		return nil
+	}
+	data, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	dir := filepath.Dir(c.Path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "create pipeline cache dir")
+	}
+	file, err := ioutil.TempFile(dir, filepath.Base(c.Path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "create pipeline cache file")
+	}
+	tmp := file.Name()
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, c.Path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "write pipeline cache")
+	}
+	return nil
+}
+
+func (c *PipelineCache) Destroy() {
+	if c.cache != vk.NullPipelineCache {
+		vk.DestroyPipelineCache(c.logicalDevice, c.cache, nil)
+		c.cache = vk.NullPipelineCache
+	}
+}
+
+// lockShared keeps Merge out while a pipeline is created with the cache and
+// returns the unlock, a nil cache needs no locking.
+func (c *PipelineCache) lockShared() func() {
+	if c == nil {
+		return func() {}
+	}
+	c.mutex.RLock()
+	return c.mutex.RUnlock
+}
+
+// Handle returns vk.NullPipelineCache for a nil cache, so it can be passed
+// straight to pipeline creation.
+func (c *PipelineCache) Handle() vk.PipelineCache {
+	if c == nil {
+		return vk.NullPipelineCache
+	}
+	return c.cache
+}
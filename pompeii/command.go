@@ -0,0 +1,418 @@
+package pompeii
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+type CommandPool struct {
+	Family int
+
+	device *Device
+	pool   vk.CommandPool
+	// buffers allocated from the pool and not freed yet, so Reset can
+	// reset their recording state too.
+	buffers map[*CommandBuffer]struct{}
+}
+
+// NewCommandPool creates a pool for queueFamily. Transient pools hint that
+// their buffers are short lived, resettable pools allow resetting buffers
+// individually instead of only the pool as a whole.
+func NewCommandPool(d *Device, queueFamily int, transient, resettable bool) (*CommandPool, error) {
+	p := CommandPool{
+		Family:  queueFamily,
+		device:  d,
+		buffers: map[*CommandBuffer]struct{}{},
+	}
+
+	var flags vk.CommandPoolCreateFlagBits
+	if transient {
+		flags |= vk.CommandPoolCreateTransientBit
+	}
+	if resettable {
+		flags |= vk.CommandPoolCreateResetCommandBufferBit
+	}
+	commandPoolCreateInfo := vk.CommandPoolCreateInfo{
+		SType:            vk.StructureTypeCommandPoolCreateInfo,
+		Flags:            vk.CommandPoolCreateFlags(flags),
+		QueueFamilyIndex: uint32(queueFamily),
+	}
+	if result := vk.CreateCommandPool(d.Handle(), &commandPoolCreateInfo, nil, &p.pool); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "create command pool")
+	}
+
+	return &p, nil
+}
+
+// Destroy frees all buffers allocated from the pool along with it.
+func (p *CommandPool) Destroy() {
+	if p.pool != vk.NullCommandPool {
+		vk.DestroyCommandPool(p.device.Handle(), p.pool, nil)
+		p.pool = vk.NullCommandPool
+	}
+}
+
+func (p *CommandPool) Allocate(count int, secondary bool) ([]*CommandBuffer, error) {
+	level := vk.CommandBufferLevelPrimary
+	if secondary {
+		level = vk.CommandBufferLevelSecondary
+	}
+
+	handles := make([]vk.CommandBuffer, count)
+	commandBufferAllocateInfo := vk.CommandBufferAllocateInfo{
+		SType:              vk.StructureTypeCommandBufferAllocateInfo,
+		CommandPool:        p.pool,
+		Level:              level,
+		CommandBufferCount: uint32(count),
+	}
+	if result := vk.AllocateCommandBuffers(p.device.Handle(), &commandBufferAllocateInfo, handles); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "allocate command buffers")
+	}
+
+	buffers := make([]*CommandBuffer, count)
+	for t, handle := range handles {
+		buffers[t] = &CommandBuffer{
+			Secondary: secondary,
+			pool:      p,
+			cmd:       handle,
+		}
+		p.buffers[buffers[t]] = struct{}{}
+	}
+	return buffers, nil
+}
+
+func (p *CommandPool) Free(buffers ...*CommandBuffer) {
+	if len(buffers) == 0 {
+		return
+	}
+	vk.FreeCommandBuffers(p.device.Handle(), p.pool, uint32(len(buffers)), commandBufferHandles(buffers))
+	for _, buffer := range buffers {
+		delete(p.buffers, buffer)
+	}
+}
+
+// Reset returns every buffer of the pool to the initial state, typically
+// once per frame.
+func (p *CommandPool) Reset(releaseResources bool) error {
+	var flags vk.CommandPoolResetFlags
+	if releaseResources {
+		flags = vk.CommandPoolResetFlags(vk.CommandPoolResetReleaseResourcesBit)
+	}
+	if result := vk.ResetCommandPool(p.device.Handle(), p.pool, flags); result != vk.Success {
+		return errors.Wrap(vk.Error(result), "reset command pool")
+	}
+	for buffer := range p.buffers {
+		buffer.resetState()
+	}
+	return nil
+}
+
+// OneTimeSubmit records a throwaway command buffer with record, submits it
+// to queue and blocks until it has executed.
+func (p *CommandPool) OneTimeSubmit(queue *Queue, record func(cmd *CommandBuffer)) error {
+	buffers, err := p.Allocate(1, false)
+	if err != nil {
+		return err
+	}
+	cmd := buffers[0]
+	defer p.Free(cmd)
+
+	if err := cmd.Begin(vk.CommandBufferUsageOneTimeSubmitBit); err != nil {
+		return err
+	}
+	record(cmd)
+	if err := cmd.End(); err != nil {
+		return err
+	}
+
+	fence, err := NewFence(p.device, false)
+	if err != nil {
+		return err
+	}
+	defer fence.Destroy()
+
+	if err := queue.SubmitBatches([]SubmitBatch{
+		{
+			CommandBuffers: buffers,
+		},
+	}, fence); err != nil {
+		return err
+	}
+	return fence.Wait(-1)
+}
+
+func (p *CommandPool) Handle() vk.CommandPool {
+	return p.pool
+}
+
+// CommandBuffer records commands between Begin and End. Recording methods
+// don't return errors themselves, misuse (recording outside Begin/End,
+// mismatched render passes) is remembered and returned by End.
+type CommandBuffer struct {
+	Secondary bool
+
+	pool         *CommandPool
+	cmd          vk.CommandBuffer
+	recording    bool
+	inRenderPass bool
+	err          error
+}
+
+func commandBufferHandles(buffers []*CommandBuffer) []vk.CommandBuffer {
+	handles := make([]vk.CommandBuffer, len(buffers))
+	for t, buffer := range buffers {
+		handles[t] = buffer.cmd
+	}
+	return handles
+}
+
+func (c *CommandBuffer) Begin(usage vk.CommandBufferUsageFlagBits) error {
+	return c.begin(usage, nil)
+}
+
+// BeginSecondary starts a secondary buffer that continues subpass of
+// renderPass, framebuffer may be vk.NullFramebuffer if unknown.
+func (c *CommandBuffer) BeginSecondary(usage vk.CommandBufferUsageFlagBits, renderPass vk.RenderPass, subpass uint32, framebuffer vk.Framebuffer) error {
+	if !c.Secondary {
+		return errors.New("begin command buffer: not a secondary command buffer")
+	}
+	inheritanceInfo := vk.CommandBufferInheritanceInfo{
+		SType:       vk.StructureTypeCommandBufferInheritanceInfo,
+		RenderPass:  renderPass,
+		Subpass:     subpass,
+		Framebuffer: framebuffer,
+	}
+	if renderPass != vk.NullRenderPass {
+		usage |= vk.CommandBufferUsageRenderPassContinueBit
+	}
+	return c.begin(usage, &inheritanceInfo)
+}
+
+func (c *CommandBuffer) begin(usage vk.CommandBufferUsageFlagBits, inheritanceInfo *vk.CommandBufferInheritanceInfo) error {
+	if c.recording {
+		return errors.New("begin command buffer: already recording")
+	}
+
+	beginInfo := vk.CommandBufferBeginInfo{
+		SType: vk.StructureTypeCommandBufferBeginInfo,
+		Flags: vk.CommandBufferUsageFlags(usage),
+	}
+	if inheritanceInfo != nil {
+		beginInfo.PInheritanceInfo = []vk.CommandBufferInheritanceInfo{
+			*inheritanceInfo,
+		}
+	}
+	if result := vk.BeginCommandBuffer(c.cmd, &beginInfo); result != vk.Success {
+		return errors.Wrap(vk.Error(result), "begin command buffer")
+	}
+
+	c.recording = true
+	c.inRenderPass = false
+	c.err = nil
+	return nil
+}
+
+// End finishes recording, returning the first recording error if any.
+func (c *CommandBuffer) End() error {
+	if !c.recording {
+		return errors.New("end command buffer: not recording")
+	}
+	c.recording = false
+
+	if c.inRenderPass {
+		c.fail("end command buffer: render pass still active")
+	}
+	if result := vk.EndCommandBuffer(c.cmd); result != vk.Success {
+		c.fail(errors.Wrap(vk.Error(result), "end command buffer").Error())
+	}
+	return c.err
+}
+
+// Reset requires the buffer to come from a resettable pool.
+func (c *CommandBuffer) Reset() error {
+	if result := vk.ResetCommandBuffer(c.cmd, 0); result != vk.Success {
+		return errors.Wrap(vk.Error(result), "reset command buffer")
+	}
+	c.resetState()
+	return nil
+}
+
+// resetState puts the recording state back to that of a new buffer.
+func (c *CommandBuffer) resetState() {
+	c.recording = false
+	c.inRenderPass = false
+	c.err = nil
+}
+
+func (c *CommandBuffer) Handle() vk.CommandBuffer {
+	return c.cmd
+}
+
+func (c *CommandBuffer) fail(message string) {
+	if c.err == nil {
+		c.err = errors.New(message)
+	}
+}
+
+// check reports whether a command may be recorded, renderPass tells whether
+// the command has to be inside (1), outside (-1) or either (0) of a render
+// pass.
+func (c *CommandBuffer) check(command string, renderPass int) bool {
+	switch {
+	case !c.recording:
+		c.fail(command + ": command buffer not recording")
+		return false
+	case renderPass > 0 && !c.inRenderPass && !c.Secondary:
+		c.fail(command + ": needs an active render pass")
+		return false
+	case renderPass < 0 && c.inRenderPass:
+		c.fail(command + ": not allowed inside a render pass")
+		return false
+	}
+	return true
+}
+
+func (c *CommandBuffer) BeginRenderPass(renderPass vk.RenderPass, framebuffer vk.Framebuffer, area vk.Rect2D, clearValues []vk.ClearValue, contents vk.SubpassContents) {
+	if !c.check("begin render pass", -1) {
+		return
+	}
+	renderPassBeginInfo := vk.RenderPassBeginInfo{
+		SType:           vk.StructureTypeRenderPassBeginInfo,
+		RenderPass:      renderPass,
+		Framebuffer:     framebuffer,
+		RenderArea:      area,
+		ClearValueCount: uint32(len(clearValues)),
+		PClearValues:    clearValues,
+	}
+	vk.CmdBeginRenderPass(c.cmd, &renderPassBeginInfo, contents)
+	c.inRenderPass = true
+}
+
+func (c *CommandBuffer) NextSubpass(contents vk.SubpassContents) {
+	if !c.check("next subpass", 1) {
+		return
+	}
+	vk.CmdNextSubpass(c.cmd, contents)
+}
+
+func (c *CommandBuffer) EndRenderPass() {
+	if !c.check("end render pass", 1) {
+		return
+	}
+	vk.CmdEndRenderPass(c.cmd)
+	c.inRenderPass = false
+}
+
+func (c *CommandBuffer) BindPipeline(bindPoint vk.PipelineBindPoint, pipeline vk.Pipeline) {
+	if !c.check("bind pipeline", 0) {
+		return
+	}
+	vk.CmdBindPipeline(c.cmd, bindPoint, pipeline)
+}
+
+func (c *CommandBuffer) SetViewport(viewports ...vk.Viewport) {
+	if !c.check("set viewport", 0) {
+		return
+	}
+	vk.CmdSetViewport(c.cmd, 0, uint32(len(viewports)), viewports)
+}
+
+func (c *CommandBuffer) SetScissor(scissors ...vk.Rect2D) {
+	if !c.check("set scissor", 0) {
+		return
+	}
+	vk.CmdSetScissor(c.cmd, 0, uint32(len(scissors)), scissors)
+}
+
+func (c *CommandBuffer) BindVertexBuffers(firstBinding uint32, buffers []vk.Buffer, offsets []vk.DeviceSize) {
+	if !c.check("bind vertex buffers", 0) {
+		return
+	}
+	if len(buffers) != len(offsets) {
+		c.fail("bind vertex buffers: need one offset per buffer")
+		return
+	}
+	vk.CmdBindVertexBuffers(c.cmd, firstBinding, uint32(len(buffers)), buffers, offsets)
+}
+
+func (c *CommandBuffer) BindIndexBuffer(buffer vk.Buffer, offset vk.DeviceSize, indexType vk.IndexType) {
+	if !c.check("bind index buffer", 0) {
+		return
+	}
+	vk.CmdBindIndexBuffer(c.cmd, buffer, offset, indexType)
+}
+
+func (c *CommandBuffer) BindDescriptorSets(bindPoint vk.PipelineBindPoint, layout vk.PipelineLayout, firstSet uint32, sets []vk.DescriptorSet, dynamicOffsets []uint32) {
+	if !c.check("bind descriptor sets", 0) {
+		return
+	}
+	vk.CmdBindDescriptorSets(c.cmd, bindPoint, layout, firstSet, uint32(len(sets)), sets, uint32(len(dynamicOffsets)), dynamicOffsets)
+}
+
+func (c *CommandBuffer) PushConstants(layout vk.PipelineLayout, stages vk.ShaderStageFlags, offset uint32, data []byte) {
+	if !c.check("push constants", 0) || len(data) == 0 {
+		return
+	}
+	vk.CmdPushConstants(c.cmd, layout, stages, offset, uint32(len(data)), unsafe.Pointer(&data[0]))
+}
+
+func (c *CommandBuffer) Draw(vertexCount, instanceCount, firstVertex, firstInstance uint32) {
+	if !c.check("draw", 1) {
+		return
+	}
+	vk.CmdDraw(c.cmd, vertexCount, instanceCount, firstVertex, firstInstance)
+}
+
+func (c *CommandBuffer) DrawIndexed(indexCount, instanceCount, firstIndex uint32, vertexOffset int32, firstInstance uint32) {
+	if !c.check("draw indexed", 1) {
+		return
+	}
+	vk.CmdDrawIndexed(c.cmd, indexCount, instanceCount, firstIndex, vertexOffset, firstInstance)
+}
+
+func (c *CommandBuffer) Dispatch(x, y, z uint32) {
+	if !c.check("dispatch", -1) {
+		return
+	}
+	vk.CmdDispatch(c.cmd, x, y, z)
+}
+
+func (c *CommandBuffer) Barrier(srcStage, dstStage vk.PipelineStageFlags, memoryBarriers []vk.MemoryBarrier, bufferBarriers []vk.BufferMemoryBarrier, imageBarriers []vk.ImageMemoryBarrier) {
+	if !c.check("pipeline barrier", 0) {
+		return
+	}
+	vk.CmdPipelineBarrier(c.cmd, srcStage, dstStage, 0,
+		uint32(len(memoryBarriers)), memoryBarriers,
+		uint32(len(bufferBarriers)), bufferBarriers,
+		uint32(len(imageBarriers)), imageBarriers,
+	)
+}
+
+func (c *CommandBuffer) CopyBuffer(src, dst vk.Buffer, regions ...vk.BufferCopy) {
+	if !c.check("copy buffer", -1) {
+		return
+	}
+	vk.CmdCopyBuffer(c.cmd, src, dst, uint32(len(regions)), regions)
+}
+
+func (c *CommandBuffer) CopyBufferToImage(src vk.Buffer, dst vk.Image, dstLayout vk.ImageLayout, regions ...vk.BufferImageCopy) {
+	if !c.check("copy buffer to image", -1) {
+		return
+	}
+	vk.CmdCopyBufferToImage(c.cmd, src, dst, dstLayout, uint32(len(regions)), regions)
+}
+
+func (c *CommandBuffer) ExecuteCommands(secondaries ...*CommandBuffer) {
+	if !c.check("execute commands", 0) {
+		return
+	}
+	for _, secondary := range secondaries {
+		if !secondary.Secondary {
+			c.fail("execute commands: not a secondary command buffer")
+			return
+		}
+	}
+	vk.CmdExecuteCommands(c.cmd, uint32(len(secondaries)), commandBufferHandles(secondaries))
+}
@@ -0,0 +1,584 @@
+package pompeii
+
+/*
+#include <stdlib.h>
+#include "ext.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	structureTypeDebugUtilsObjectNameInfo = 1000128000
+	structureTypeDebugUtilsLabel          = 1000128002
+)
+
+// DebugObject is an object a debug message refers to, Name is set when the
+// object was named with Device.SetObjectName.
+type DebugObject struct {
+	Type   vk.ObjectType
+	Handle uint64
+	Name   string
+}
+
+func (o DebugObject) String() string {
+	if o.Name != "" {
+		return fmt.Sprintf("%s 0x%x %q", objectTypeName(o.Type), o.Handle, o.Name)
+	}
+	return fmt.Sprintf("%s 0x%x", objectTypeName(o.Type), o.Handle)
+}
+
+type DebugMessage struct {
+	Severity vk.DebugUtilsMessageSeverityFlagBits
+	Type     vk.DebugUtilsMessageTypeFlagBits
+	ID       int32
+	// IDName is the VUID for validation messages, empty when falling back
+	// to VK_EXT_debug_report which only has the layer name.
+	IDName  string
+	Text    string
+	Objects []DebugObject
+	// QueueLabels and CommandBufferLabels are the labels open when the
+	// message was triggered, always empty with VK_EXT_debug_report.
+	QueueLabels         []string
+	CommandBufferLabels []string
+}
+
+func (m DebugMessage) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s %s]", severityName(m.Severity), messageTypeName(m.Type))
+	if m.IDName != "" {
+		fmt.Fprintf(&b, " %s", m.IDName)
+	}
+	fmt.Fprintf(&b, ": %s", m.Text)
+	if len(m.Objects) > 0 {
+		objects := make([]string, len(m.Objects))
+		for t, object := range m.Objects {
+			objects[t] = object.String()
+		}
+		fmt.Fprintf(&b, "\n\tobjects: %s", strings.Join(objects, ", "))
+	}
+	if len(m.QueueLabels) > 0 {
+		fmt.Fprintf(&b, "\n\tqueue labels: %s", strings.Join(m.QueueLabels, ", "))
+	}
+	if len(m.CommandBufferLabels) > 0 {
+		fmt.Fprintf(&b, "\n\tcommand buffer labels: %s", strings.Join(m.CommandBufferLabels, ", "))
+	}
+	return b.String()
+}
+
+func severityName(severity vk.DebugUtilsMessageSeverityFlagBits) string {
+	switch {
+	case severity&vk.DebugUtilsMessageSeverityErrorBit != 0:
+		return "Error"
+	case severity&vk.DebugUtilsMessageSeverityWarningBit != 0:
+		return "Warning"
+	case severity&vk.DebugUtilsMessageSeverityInfoBit != 0:
+		return "Info"
+	default:
+		return "Verbose"
+	}
+}
+
+func messageTypeName(types vk.DebugUtilsMessageTypeFlagBits) string {
+	names := []string{}
+	if types&vk.DebugUtilsMessageTypeGeneralBit != 0 {
+		names = append(names, "General")
+	}
+	if types&vk.DebugUtilsMessageTypeValidationBit != 0 {
+		names = append(names, "Validation")
+	}
+	if types&vk.DebugUtilsMessageTypePerformanceBit != 0 {
+		names = append(names, "Performance")
+	}
+	return strings.Join(names, "|")
+}
+
+var objectTypeNames = map[vk.ObjectType]string{
+	vk.ObjectTypeInstance:            "Instance",
+	vk.ObjectTypePhysicalDevice:      "PhysicalDevice",
+	vk.ObjectTypeDevice:              "Device",
+	vk.ObjectTypeQueue:               "Queue",
+	vk.ObjectTypeSemaphore:           "Semaphore",
+	vk.ObjectTypeCommandBuffer:       "CommandBuffer",
+	vk.ObjectTypeFence:               "Fence",
+	vk.ObjectTypeDeviceMemory:        "DeviceMemory",
+	vk.ObjectTypeBuffer:              "Buffer",
+	vk.ObjectTypeImage:               "Image",
+	vk.ObjectTypeEvent:               "Event",
+	vk.ObjectTypeQueryPool:           "QueryPool",
+	vk.ObjectTypeBufferView:          "BufferView",
+	vk.ObjectTypeImageView:           "ImageView",
+	vk.ObjectTypeShaderModule:        "ShaderModule",
+	vk.ObjectTypePipelineCache:       "PipelineCache",
+	vk.ObjectTypePipelineLayout:      "PipelineLayout",
+	vk.ObjectTypeRenderPass:          "RenderPass",
+	vk.ObjectTypePipeline:            "Pipeline",
+	vk.ObjectTypeDescriptorSetLayout: "DescriptorSetLayout",
+	vk.ObjectTypeSampler:             "Sampler",
+	vk.ObjectTypeDescriptorPool:      "DescriptorPool",
+	vk.ObjectTypeDescriptorSet:       "DescriptorSet",
+	vk.ObjectTypeFramebuffer:         "Framebuffer",
+	vk.ObjectTypeCommandPool:         "CommandPool",
+	vk.ObjectTypeSurface:             "Surface",
+	vk.ObjectTypeSwapchain:           "Swapchain",
+}
+
+func objectTypeName(objectType vk.ObjectType) string {
+	if name, ok := objectTypeNames[objectType]; ok {
+		return name
+	}
+	return "Object"
+}
+
+// DebugSink receives debug messages on whichever thread triggered them.
+type DebugSink func(message DebugMessage)
+
+type DebugOptions struct {
+	// Severities and Types filter the messages delivered, zero values pick
+	// warnings and errors of every type.
+	Severities vk.DebugUtilsMessageSeverityFlagBits
+	Types      vk.DebugUtilsMessageTypeFlagBits
+	Sink       DebugSink
+
+	// Fail is called with every validation error after the sink, e.g. a
+	// testing.T's Error.
+	Fail func(args ...interface{})
+	// PanicOnError panics on validation errors. The panic unwinds through
+	// the driver, so it is only meant for debugging.
+	PanicOnError bool
+}
+
+// DebugExtension picks the instance extension to enable for
+// NewDebugMessenger, VK_EXT_debug_utils over the deprecated
+// VK_EXT_debug_report.
+func DebugExtension() (string, error) {
+	available, err := getAvailableInstanceExtensions("")
+	if err != nil {
+		return "", errors.Wrap(err, "could not get instance extensions")
+	}
+	for _, name := range []string{"VK_EXT_debug_utils", "VK_EXT_debug_report"} {
+		if inStringSlice(available, name) {
+			return name, nil
+		}
+	}
+	return "", errors.New("no debug extension available")
+}
+
+// DebugMessenger routes validation and driver messages to a sink. It uses
+// VK_EXT_debug_utils when the instance enabled it and falls back to
+// VK_EXT_debug_report otherwise.
+type DebugMessenger struct {
+	// Utils is false when falling back to VK_EXT_debug_report.
+	Utils bool
+
+	options   DebugOptions
+	errors    int64
+	id        uintptr
+	instance  vk.Instance
+	messenger uint64
+	report    vk.DebugReportCallback
+}
+
+// debugMessengers maps the ids handed to the driver as user data back to
+// their messengers, Go pointers may not be kept by C.
+var debugMessengers = struct {
+	sync.Mutex
+	next uintptr
+	byID map[uintptr]*DebugMessenger
+}{
+	byID: map[uintptr]*DebugMessenger{},
+}
+
+func NewDebugMessenger(i *Instance, options DebugOptions) (*DebugMessenger, error) {
+	if options.Severities == 0 {
+		options.Severities = vk.DebugUtilsMessageSeverityWarningBit | vk.DebugUtilsMessageSeverityErrorBit
+	}
+	if options.Types == 0 {
+		options.Types = vk.DebugUtilsMessageTypeGeneralBit | vk.DebugUtilsMessageTypeValidationBit | vk.DebugUtilsMessageTypePerformanceBit
+	}
+
+	m := DebugMessenger{
+		options:  options,
+		instance: i.Handle(),
+		report:   vk.NullDebugReportCallback,
+	}
+
+	debugMessengers.Lock()
+	debugMessengers.next++
+	m.id = debugMessengers.next
+	debugMessengers.byID[m.id] = &m
+	debugMessengers.Unlock()
+
+	switch {
+	case i.HasExtension("VK_EXT_debug_utils"):
+		fn, err := i.proc("vkCreateDebugUtilsMessengerEXT")
+		if err != nil {
+			m.Destroy()
+			return nil, errors.Wrap(err, "create debug messenger")
+		}
+		var messenger C.uint64_t
+		if result := vk.Result(C.pompeiiCreateDebugUtilsMessenger(fn, unsafe.Pointer(m.instance), C.uint32_t(options.Severities), C.uint32_t(options.Types), C.uintptr_t(m.id), &messenger)); result != vk.Success {
+			m.Destroy()
+			return nil, errors.Wrap(vk.Error(result), "create debug messenger")
+		}
+		m.Utils = true
+		m.messenger = uint64(messenger)
+
+	case i.HasExtension("VK_EXT_debug_report"):
+		debugCreateInfo := vk.DebugReportCallbackCreateInfo{
+			SType:       vk.StructureTypeDebugReportCallbackCreateInfo,
+			Flags:       vk.DebugReportFlags(reportFlags(options)),
+			PfnCallback: debugReportMessage,
+		}
+		if result := vk.CreateDebugReportCallback(m.instance, &debugCreateInfo, nil, &m.report); result != vk.Success {
+			m.Destroy()
+			return nil, errors.Wrap(vk.Error(result), "create debug report callback")
+		}
+
+	default:
+		m.Destroy()
+		return nil, errors.New("create debug messenger: instance has no debug extension enabled")
+	}
+
+	return &m, nil
+}
+
+func (m *DebugMessenger) Destroy() {
+	if m.messenger != 0 {
+		if fn := instanceProc(m.instance, "vkDestroyDebugUtilsMessengerEXT"); fn != nil {
+			C.pompeiiDestroyDebugUtilsMessenger(fn, unsafe.Pointer(m.instance), C.uint64_t(m.messenger))
+		}
+		m.messenger = 0
+	}
+	if m.report != vk.NullDebugReportCallback {
+		vk.DestroyDebugReportCallback(m.instance, m.report, nil)
+		m.report = vk.NullDebugReportCallback
+	}
+
+	debugMessengers.Lock()
+	delete(debugMessengers.byID, m.id)
+	debugMessengers.Unlock()
+}
+
+// Errors returns how many validation errors have been delivered so far,
+// tests can check it stayed at zero.
+func (m *DebugMessenger) Errors() int {
+	return int(atomic.LoadInt64(&m.errors))
+}
+
+func (m *DebugMessenger) deliver(message DebugMessage) {
+	if message.Severity&m.options.Severities == 0 || message.Type&m.options.Types == 0 {
+		return
+	}
+	if m.options.Sink != nil {
+		m.options.Sink(message)
+	}
+
+	if message.Severity&vk.DebugUtilsMessageSeverityErrorBit == 0 || message.Type&vk.DebugUtilsMessageTypeValidationBit == 0 {
+		return
+	}
+	atomic.AddInt64(&m.errors, 1)
+	if m.options.Fail != nil {
+		m.options.Fail(message.String())
+	}
+	if m.options.PanicOnError {
+		panic(message.String())
+	}
+}
+
+func debugMessenger(id uintptr) *DebugMessenger {
+	debugMessengers.Lock()
+	defer debugMessengers.Unlock()
+	return debugMessengers.byID[id]
+}
+
+func debugLabelNames(labels *C.pompeiiDebugUtilsLabel, count C.uint32_t) []string {
+	if count == 0 {
+		return nil
+	}
+	names := make([]string, count)
+	for t, label := range (*[1 << 16]C.pompeiiDebugUtilsLabel)(unsafe.Pointer(labels))[:count:count] {
+		names[t] = C.GoString(label.pLabelName)
+	}
+	return names
+}
+
+//export pompeiiDebugUtilsMessage
+func pompeiiDebugUtilsMessage(severity, types C.uint32_t, data *C.pompeiiDebugUtilsMessengerCallbackData, id C.uintptr_t) C.uint32_t {
+	m := debugMessenger(uintptr(id))
+	if m == nil {
+		return C.uint32_t(vk.False)
+	}
+
+	message := DebugMessage{
+		Severity:            vk.DebugUtilsMessageSeverityFlagBits(severity),
+		Type:                vk.DebugUtilsMessageTypeFlagBits(types),
+		ID:                  int32(data.messageIdNumber),
+		IDName:              C.GoString(data.pMessageIdName),
+		Text:                C.GoString(data.pMessage),
+		QueueLabels:         debugLabelNames(data.pQueueLabels, data.queueLabelCount),
+		CommandBufferLabels: debugLabelNames(data.pCmdBufLabels, data.cmdBufLabelCount),
+	}
+	if data.objectCount > 0 {
+		objects := (*[1 << 16]C.pompeiiDebugUtilsObjectNameInfo)(unsafe.Pointer(data.pObjects))[:data.objectCount:data.objectCount]
+		for _, object := range objects {
+			message.Objects = append(message.Objects, DebugObject{
+				Type:   vk.ObjectType(object.objectType),
+				Handle: uint64(object.objectHandle),
+				Name:   C.GoString(object.pObjectName),
+			})
+		}
+	}
+
+	m.deliver(message)
+	return C.uint32_t(vk.False)
+}
+
+func reportFlags(options DebugOptions) vk.DebugReportFlagBits {
+	var flags vk.DebugReportFlagBits
+	if options.Severities&vk.DebugUtilsMessageSeverityErrorBit != 0 {
+		flags |= vk.DebugReportErrorBit
+	}
+	if options.Severities&vk.DebugUtilsMessageSeverityWarningBit != 0 {
+		flags |= vk.DebugReportWarningBit | vk.DebugReportPerformanceWarningBit
+	}
+	if options.Severities&vk.DebugUtilsMessageSeverityInfoBit != 0 {
+		flags |= vk.DebugReportInformationBit
+	}
+	if options.Severities&vk.DebugUtilsMessageSeverityVerboseBit != 0 {
+		flags |= vk.DebugReportDebugBit
+	}
+	return flags
+}
+
+// debugReportMessage translates VK_EXT_debug_report messages. The bindings
+// only keep the first callback registered, so it hands the message to every
+// messenger that fell back to debug report.
+func debugReportMessage(flags vk.DebugReportFlags, objectType vk.DebugReportObjectType,
+	object uint64, location uint, messageCode int32, pLayerPrefix string,
+	pMessage string, pUserData unsafe.Pointer) vk.Bool32 {
+	message := DebugMessage{
+		Type: vk.DebugUtilsMessageTypeValidationBit,
+		ID:   messageCode,
+		Text: strings.TrimRight(pMessage, "\x00"),
+	}
+	switch {
+	case flags&vk.DebugReportFlags(vk.DebugReportErrorBit) != 0:
+		message.Severity = vk.DebugUtilsMessageSeverityErrorBit
+	case flags&vk.DebugReportFlags(vk.DebugReportPerformanceWarningBit) != 0:
+		message.Severity = vk.DebugUtilsMessageSeverityWarningBit
+		message.Type = vk.DebugUtilsMessageTypePerformanceBit
+	case flags&vk.DebugReportFlags(vk.DebugReportWarningBit) != 0:
+		message.Severity = vk.DebugUtilsMessageSeverityWarningBit
+	case flags&vk.DebugReportFlags(vk.DebugReportInformationBit) != 0:
+		message.Severity = vk.DebugUtilsMessageSeverityInfoBit
+		message.Type = vk.DebugUtilsMessageTypeGeneralBit
+	default:
+		message.Severity = vk.DebugUtilsMessageSeverityVerboseBit
+		message.Type = vk.DebugUtilsMessageTypeGeneralBit
+	}
+	if prefix := strings.TrimRight(pLayerPrefix, "\x00"); prefix != "" {
+		message.Text = prefix + ": " + message.Text
+	}
+	if object != 0 {
+		// Debug report object types match the core ones up to the command
+		// pool.
+		debugType := vk.ObjectTypeUnknown
+		if objectType <= vk.DebugReportObjectTypeCommandPool {
+			debugType = vk.ObjectType(objectType)
+		}
+		message.Objects = []DebugObject{
+			{Type: debugType, Handle: object},
+		}
+	}
+
+	debugMessengers.Lock()
+	messengers := make([]*DebugMessenger, 0, len(debugMessengers.byID))
+	for _, m := range debugMessengers.byID {
+		if m.report != vk.NullDebugReportCallback {
+			messengers = append(messengers, m)
+		}
+	}
+	debugMessengers.Unlock()
+	for _, m := range messengers {
+		m.deliver(message)
+	}
+	return vk.Bool32(vk.False)
+}
+
+// debugUtils holds the VK_EXT_debug_utils entry points a device uses, it is
+// nil when the instance did not enable the extension.
+type debugUtils struct {
+	setObjectName    unsafe.Pointer
+	cmdBeginLabel    unsafe.Pointer
+	cmdEndLabel      unsafe.Pointer
+	cmdInsertLabel   unsafe.Pointer
+	queueBeginLabel  unsafe.Pointer
+	queueEndLabel    unsafe.Pointer
+	queueInsertLabel unsafe.Pointer
+}
+
+func loadDebugUtils(instance vk.Instance) *debugUtils {
+	u := debugUtils{
+		setObjectName:    instanceProc(instance, "vkSetDebugUtilsObjectNameEXT"),
+		cmdBeginLabel:    instanceProc(instance, "vkCmdBeginDebugUtilsLabelEXT"),
+		cmdEndLabel:      instanceProc(instance, "vkCmdEndDebugUtilsLabelEXT"),
+		cmdInsertLabel:   instanceProc(instance, "vkCmdInsertDebugUtilsLabelEXT"),
+		queueBeginLabel:  instanceProc(instance, "vkQueueBeginDebugUtilsLabelEXT"),
+		queueEndLabel:    instanceProc(instance, "vkQueueEndDebugUtilsLabelEXT"),
+		queueInsertLabel: instanceProc(instance, "vkQueueInsertDebugUtilsLabelEXT"),
+	}
+	if u.setObjectName == nil || u.cmdBeginLabel == nil || u.cmdEndLabel == nil || u.cmdInsertLabel == nil ||
+		u.queueBeginLabel == nil || u.queueEndLabel == nil || u.queueInsertLabel == nil {
+		return nil
+	}
+	return &u
+}
+
+// debugObjectHandle maps a Vulkan handle to its object type and raw value.
+func debugObjectHandle(handle interface{}) (vk.ObjectType, uint64, bool) {
+	switch h := handle.(type) {
+	case vk.Device:
+		return vk.ObjectTypeDevice, uint64(uintptr(unsafe.Pointer(h))), true
+	case vk.Queue:
+		return vk.ObjectTypeQueue, uint64(uintptr(unsafe.Pointer(h))), true
+	case vk.CommandBuffer:
+		return vk.ObjectTypeCommandBuffer, uint64(uintptr(unsafe.Pointer(h))), true
+	case vk.Semaphore:
+		return vk.ObjectTypeSemaphore, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.Fence:
+		return vk.ObjectTypeFence, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.DeviceMemory:
+		return vk.ObjectTypeDeviceMemory, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.Buffer:
+		return vk.ObjectTypeBuffer, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.Image:
+		return vk.ObjectTypeImage, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.ImageView:
+		return vk.ObjectTypeImageView, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.ShaderModule:
+		return vk.ObjectTypeShaderModule, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.PipelineCache:
+		return vk.ObjectTypePipelineCache, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.PipelineLayout:
+		return vk.ObjectTypePipelineLayout, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.RenderPass:
+		return vk.ObjectTypeRenderPass, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.Pipeline:
+		return vk.ObjectTypePipeline, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.DescriptorSetLayout:
+		return vk.ObjectTypeDescriptorSetLayout, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.Sampler:
+		return vk.ObjectTypeSampler, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.DescriptorPool:
+		return vk.ObjectTypeDescriptorPool, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.DescriptorSet:
+		return vk.ObjectTypeDescriptorSet, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.Framebuffer:
+		return vk.ObjectTypeFramebuffer, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.CommandPool:
+		return vk.ObjectTypeCommandPool, *(*uint64)(unsafe.Pointer(&h)), true
+	case vk.Swapchain:
+		return vk.ObjectTypeSwapchain, *(*uint64)(unsafe.Pointer(&h)), true
+	}
+	return vk.ObjectTypeUnknown, 0, false
+}
+
+// SetObjectName names a Vulkan handle, e.g. a Buffer's Handle(), in debug
+// messages and tools. Without VK_EXT_debug_utils it does nothing.
+func (d *Device) SetObjectName(handle interface{}, name string) error {
+	if d.debugUtils == nil {
+		return nil
+	}
+	objectType, objectHandle, ok := debugObjectHandle(handle)
+	if !ok {
+		return errors.Errorf("set object name: %T is not a Vulkan handle", handle)
+	}
+
+	info := (*C.pompeiiDebugUtilsObjectNameInfo)(C.calloc(1, C.sizeof_pompeiiDebugUtilsObjectNameInfo))
+	defer C.free(unsafe.Pointer(info))
+	info.sType = structureTypeDebugUtilsObjectNameInfo
+	info.objectType = C.int32_t(objectType)
+	info.objectHandle = C.uint64_t(objectHandle)
+	info.pObjectName = C.CString(name)
+	defer C.free(unsafe.Pointer(info.pObjectName))
+
+	if result := vk.Result(C.pompeiiSetDebugUtilsObjectName(d.debugUtils.setObjectName, unsafe.Pointer(d.logicalDevice), info)); result != vk.Success {
+		return errors.Wrap(vk.Error(result), "set object name")
+	}
+	return nil
+}
+
+func debugLabelCommand(fn, object unsafe.Pointer, name string, color [4]float32) {
+	label := (*C.pompeiiDebugUtilsLabel)(C.calloc(1, C.sizeof_pompeiiDebugUtilsLabel))
+	defer C.free(unsafe.Pointer(label))
+	label.sType = structureTypeDebugUtilsLabel
+	label.pLabelName = C.CString(name)
+	defer C.free(unsafe.Pointer(label.pLabelName))
+	for t, c := range color {
+		label.color[t] = C.float(c)
+	}
+	C.pompeiiDebugUtilsLabelCommand(fn, object, label)
+}
+
+// BeginLabel opens a labelled region shown by debuggers and attached to
+// debug messages, color may be left zero. Labels do nothing without
+// VK_EXT_debug_utils.
+func (c *CommandBuffer) BeginLabel(name string, color [4]float32) {
+	if !c.check("begin label", 0) || c.pool.device.debugUtils == nil {
+		return
+	}
+	debugLabelCommand(c.pool.device.debugUtils.cmdBeginLabel, unsafe.Pointer(c.cmd), name, color)
+}
+
+func (c *CommandBuffer) EndLabel() {
+	if !c.check("end label", 0) || c.pool.device.debugUtils == nil {
+		return
+	}
+	C.pompeiiDebugUtilsEndLabel(c.pool.device.debugUtils.cmdEndLabel, unsafe.Pointer(c.cmd))
+}
+
+func (c *CommandBuffer) InsertLabel(name string, color [4]float32) {
+	if !c.check("insert label", 0) || c.pool.device.debugUtils == nil {
+		return
+	}
+	debugLabelCommand(c.pool.device.debugUtils.cmdInsertLabel, unsafe.Pointer(c.cmd), name, color)
+}
+
+// BeginLabel opens a labelled region of queue operations, see
+// CommandBuffer.BeginLabel.
+func (q *Queue) BeginLabel(name string, color [4]float32) {
+	if q.debugUtils == nil {
+		return
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	debugLabelCommand(q.debugUtils.queueBeginLabel, unsafe.Pointer(q.queue), name, color)
+}
+
+func (q *Queue) EndLabel() {
+	if q.debugUtils == nil {
+		return
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	C.pompeiiDebugUtilsEndLabel(q.debugUtils.queueEndLabel, unsafe.Pointer(q.queue))
+}
+
+func (q *Queue) InsertLabel(name string, color [4]float32) {
+	if q.debugUtils == nil {
+		return
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	debugLabelCommand(q.debugUtils.queueInsertLabel, unsafe.Pointer(q.queue), name, color)
+}
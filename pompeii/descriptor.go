@@ -0,0 +1,432 @@
+package pompeii
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+type DescriptorBinding struct {
+	Binding uint32
+	Type    vk.DescriptorType
+	Count   uint32
+	Stages  vk.ShaderStageFlagBits
+}
+
+type DescriptorSetLayout struct {
+	// Bindings sorted by binding number.
+	Bindings []DescriptorBinding
+
+	logicalDevice vk.Device
+	layout        vk.DescriptorSetLayout
+}
+
+func sortedBindings(bindings []DescriptorBinding) []DescriptorBinding {
+	sorted := append([]DescriptorBinding{}, bindings...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Binding < sorted[j].Binding
+	})
+	return sorted
+}
+
+func NewDescriptorSetLayout(d *Device, bindings ...DescriptorBinding) (*DescriptorSetLayout, error) {
+	l := DescriptorSetLayout{
+		Bindings:      sortedBindings(bindings),
+		logicalDevice: d.Handle(),
+	}
+
+	layoutBindings := make([]vk.DescriptorSetLayoutBinding, len(l.Bindings))
+	for t, binding := range l.Bindings {
+		if t > 0 && binding.Binding == l.Bindings[t-1].Binding {
+			return nil, errors.Errorf("create descriptor set layout: binding %d used twice", binding.Binding)
+		}
+		if binding.Count == 0 {
+			return nil, errors.Errorf("create descriptor set layout: binding %d has no descriptors", binding.Binding)
+		}
+		layoutBindings[t] = vk.DescriptorSetLayoutBinding{
+			Binding:         binding.Binding,
+			DescriptorType:  binding.Type,
+			DescriptorCount: binding.Count,
+			StageFlags:      vk.ShaderStageFlags(binding.Stages),
+		}
+	}
+
+	descriptorSetLayoutCreateInfo := vk.DescriptorSetLayoutCreateInfo{
+		SType:        vk.StructureTypeDescriptorSetLayoutCreateInfo,
+		BindingCount: uint32(len(layoutBindings)),
+		PBindings:    layoutBindings,
+	}
+	if result := vk.CreateDescriptorSetLayout(l.logicalDevice, &descriptorSetLayoutCreateInfo, nil, &l.layout); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "create descriptor set layout")
+	}
+	return &l, nil
+}
+
+func (l *DescriptorSetLayout) Destroy() {
+	if l.layout != vk.NullDescriptorSetLayout {
+		vk.DestroyDescriptorSetLayout(l.logicalDevice, l.layout, nil)
+		l.layout = vk.NullDescriptorSetLayout
+	}
+}
+
+func (l *DescriptorSetLayout) Handle() vk.DescriptorSetLayout {
+	return l.layout
+}
+
+func (l *DescriptorSetLayout) binding(binding uint32) (DescriptorBinding, bool) {
+	for _, b := range l.Bindings {
+		if b.Binding == binding {
+			return b, true
+		}
+	}
+	return DescriptorBinding{}, false
+}
+
+// DescriptorLayoutCache hands out one layout per distinct set of bindings,
+// so pipeline layouts describing the same set share it and sets allocated
+// for one are compatible with the others.
+type DescriptorLayoutCache struct {
+	mutex   sync.Mutex
+	device  *Device
+	layouts map[string]*DescriptorSetLayout
+}
+
+func NewDescriptorLayoutCache(d *Device) *DescriptorLayoutCache {
+	return &DescriptorLayoutCache{
+		device:  d,
+		layouts: map[string]*DescriptorSetLayout{},
+	}
+}
+
+func descriptorLayoutKey(bindings []DescriptorBinding) string {
+	parts := make([]string, len(bindings))
+	for t, b := range bindings {
+		parts[t] = fmt.Sprintf("%d:%d:%d:%d", b.Binding, b.Type, b.Count, b.Stages)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Get returns the layout for bindings, creating it on first use. The cache
+// owns the layout, don't destroy it.
+func (c *DescriptorLayoutCache) Get(bindings ...DescriptorBinding) (*DescriptorSetLayout, error) {
+	key := descriptorLayoutKey(sortedBindings(bindings))
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if layout, ok := c.layouts[key]; ok {
+		return layout, nil
+	}
+	layout, err := NewDescriptorSetLayout(c.device, bindings...)
+	if err != nil {
+		return nil, err
+	}
+	c.layouts[key] = layout
+	return layout, nil
+}
+
+func (c *DescriptorLayoutCache) Destroy() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, layout := range c.layouts {
+		layout.Destroy()
+	}
+	c.layouts = map[string]*DescriptorSetLayout{}
+}
+
+// DescriptorPoolSize is how many descriptors of a type a pool holds per set.
+type DescriptorPoolSize struct {
+	Type   vk.DescriptorType
+	PerSet float32
+}
+
+var DefaultDescriptorPoolSizes = []DescriptorPoolSize{
+	{vk.DescriptorTypeSampler, 0.5},
+	{vk.DescriptorTypeCombinedImageSampler, 4},
+	{vk.DescriptorTypeSampledImage, 4},
+	{vk.DescriptorTypeStorageImage, 1},
+	{vk.DescriptorTypeUniformTexelBuffer, 1},
+	{vk.DescriptorTypeStorageTexelBuffer, 1},
+	{vk.DescriptorTypeUniformBuffer, 2},
+	{vk.DescriptorTypeStorageBuffer, 2},
+	{vk.DescriptorTypeUniformBufferDynamic, 1},
+	{vk.DescriptorTypeStorageBufferDynamic, 1},
+	{vk.DescriptorTypeInputAttachment, 0.5},
+}
+
+const defaultSetsPerPool = 256
+
+// DescriptorAllocator allocates sets from pools it creates as they run out.
+// Sets are never freed one by one, Reset returns all of them at once.
+type DescriptorAllocator struct {
+	SetsPerPool uint32
+	Sizes       []DescriptorPoolSize
+
+	mutex         sync.Mutex
+	logicalDevice vk.Device
+	current       vk.DescriptorPool
+	used          []vk.DescriptorPool
+	free          []vk.DescriptorPool
+}
+
+// NewDescriptorAllocator uses DefaultDescriptorPoolSizes and 256 sets per
+// pool for zero values.
+func NewDescriptorAllocator(d *Device, setsPerPool uint32, sizes []DescriptorPoolSize) *DescriptorAllocator {
+	if setsPerPool == 0 {
+		setsPerPool = defaultSetsPerPool
+	}
+	if len(sizes) == 0 {
+		sizes = DefaultDescriptorPoolSizes
+	}
+	return &DescriptorAllocator{
+		SetsPerPool:   setsPerPool,
+		Sizes:         sizes,
+		logicalDevice: d.Handle(),
+		current:       vk.NullDescriptorPool,
+	}
+}
+
+func (a *DescriptorAllocator) nextPool() error {
+	if a.current != vk.NullDescriptorPool {
+		a.used = append(a.used, a.current)
+		a.current = vk.NullDescriptorPool
+	}
+	if len(a.free) > 0 {
+		a.current = a.free[len(a.free)-1]
+		a.free = a.free[:len(a.free)-1]
+		return nil
+	}
+
+	poolSizes := make([]vk.DescriptorPoolSize, 0, len(a.Sizes))
+	for _, size := range a.Sizes {
+		count := uint32(size.PerSet * float32(a.SetsPerPool))
+		if count == 0 {
+			count = 1
+		}
+		poolSizes = append(poolSizes, vk.DescriptorPoolSize{
+			Type:            size.Type,
+			DescriptorCount: count,
+		})
+	}
+	descriptorPoolCreateInfo := vk.DescriptorPoolCreateInfo{
+		SType:         vk.StructureTypeDescriptorPoolCreateInfo,
+		MaxSets:       a.SetsPerPool,
+		PoolSizeCount: uint32(len(poolSizes)),
+		PPoolSizes:    poolSizes,
+	}
+	if result := vk.CreateDescriptorPool(a.logicalDevice, &descriptorPoolCreateInfo, nil, &a.current); result != vk.Success {
+		a.current = vk.NullDescriptorPool
+		return errors.Wrap(vk.Error(result), "create descriptor pool")
+	}
+	return nil
+}
+
+func (a *DescriptorAllocator) allocate(layout *DescriptorSetLayout) (vk.DescriptorSet, vk.Result) {
+	descriptorSetAllocateInfo := vk.DescriptorSetAllocateInfo{
+		SType:              vk.StructureTypeDescriptorSetAllocateInfo,
+		DescriptorPool:     a.current,
+		DescriptorSetCount: 1,
+		PSetLayouts:        []vk.DescriptorSetLayout{layout.Handle()},
+	}
+	var set vk.DescriptorSet
+	result := vk.AllocateDescriptorSets(a.logicalDevice, &descriptorSetAllocateInfo, &set)
+	return set, result
+}
+
+// Allocate returns a set for layout, moving on to a new pool when the
+// current one is exhausted or too fragmented.
+func (a *DescriptorAllocator) Allocate(layout *DescriptorSetLayout) (*DescriptorSet, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.current == vk.NullDescriptorPool {
+		if err := a.nextPool(); err != nil {
+			return nil, err
+		}
+	}
+	set, result := a.allocate(layout)
+	if result == vk.ErrorOutOfPoolMemory || result == vk.ErrorFragmentedPool {
+		if err := a.nextPool(); err != nil {
+			return nil, err
+		}
+		set, result = a.allocate(layout)
+	}
+	if result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "allocate descriptor set")
+	}
+
+	return &DescriptorSet{
+		Layout:        layout,
+		logicalDevice: a.logicalDevice,
+		set:           set,
+	}, nil
+}
+
+// Reset frees every set allocated so far, keeping the pools for reuse. The
+// GPU must be done with the sets.
+func (a *DescriptorAllocator) Reset() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.current != vk.NullDescriptorPool {
+		a.used = append(a.used, a.current)
+		a.current = vk.NullDescriptorPool
+	}
+	for _, pool := range a.used {
+		if result := vk.ResetDescriptorPool(a.logicalDevice, pool, 0); result != vk.Success {
+			return errors.Wrap(vk.Error(result), "reset descriptor pool")
+		}
+		a.free = append(a.free, pool)
+	}
+	a.used = nil
+	return nil
+}
+
+func (a *DescriptorAllocator) Destroy() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	pools := append(a.used, a.free...)
+	if a.current != vk.NullDescriptorPool {
+		pools = append(pools, a.current)
+	}
+	for _, pool := range pools {
+		vk.DestroyDescriptorPool(a.logicalDevice, pool, nil)
+	}
+	a.current = vk.NullDescriptorPool
+	a.used = nil
+	a.free = nil
+}
+
+// DescriptorSet lives until the allocator it came from is reset.
+type DescriptorSet struct {
+	Layout *DescriptorSetLayout
+
+	logicalDevice vk.Device
+	set           vk.DescriptorSet
+}
+
+// Write starts a batch of updates to the set, applied by Update.
+func (s *DescriptorSet) Write() *DescriptorWriter {
+	return &DescriptorWriter{
+		set: s,
+	}
+}
+
+func (s *DescriptorSet) Handle() vk.DescriptorSet {
+	return s.set
+}
+
+// DescriptorSetHandles collects the handles of sets for binding.
+func DescriptorSetHandles(sets ...*DescriptorSet) []vk.DescriptorSet {
+	handles := make([]vk.DescriptorSet, len(sets))
+	for t, set := range sets {
+		handles[t] = set.Handle()
+	}
+	return handles
+}
+
+// DescriptorWriter checks every write against the set's layout, the first
+// mismatch is returned by Update and nothing is written.
+type DescriptorWriter struct {
+	set    *DescriptorSet
+	writes []vk.WriteDescriptorSet
+	err    error
+}
+
+func (w *DescriptorWriter) write(binding uint32, descriptorType vk.DescriptorType, count int) (vk.WriteDescriptorSet, bool) {
+	if w.err != nil {
+		return vk.WriteDescriptorSet{}, false
+	}
+	layoutBinding, ok := w.set.Layout.binding(binding)
+	switch {
+	case !ok:
+		w.err = errors.Errorf("write descriptor set: no binding %d", binding)
+	case layoutBinding.Type != descriptorType:
+		w.err = errors.Errorf("write descriptor set: binding %d is of type %d, not %d", binding, layoutBinding.Type, descriptorType)
+	case uint32(count) > layoutBinding.Count:
+		w.err = errors.Errorf("write descriptor set: %d descriptors for binding %d which holds %d", count, binding, layoutBinding.Count)
+	}
+	return vk.WriteDescriptorSet{
+		SType:           vk.StructureTypeWriteDescriptorSet,
+		DstSet:          w.set.set,
+		DstBinding:      binding,
+		DescriptorCount: uint32(count),
+		DescriptorType:  descriptorType,
+	}, w.err == nil
+}
+
+// Buffer writes a uniform or storage buffer range, size 0 means the rest of
+// the buffer.
+func (w *DescriptorWriter) Buffer(binding uint32, descriptorType vk.DescriptorType, buffer *Buffer, offset, size uint64) *DescriptorWriter {
+	write, ok := w.write(binding, descriptorType, 1)
+	if !ok {
+		return w
+	}
+	rangeSize := vk.DeviceSize(size)
+	if size == 0 {
+		rangeSize = vk.DeviceSize(vk.WholeSize)
+	}
+	write.PBufferInfo = []vk.DescriptorBufferInfo{
+		{
+			Buffer: buffer.Handle(),
+			Offset: vk.DeviceSize(offset),
+			Range:  rangeSize,
+		},
+	}
+	w.writes = append(w.writes, write)
+	return w
+}
+
+// Image writes a sampled, storage or input attachment image, or a combined
+// image sampler when sampler is set.
+func (w *DescriptorWriter) Image(binding uint32, descriptorType vk.DescriptorType, view *ImageView, layout vk.ImageLayout, sampler *Sampler) *DescriptorWriter {
+	write, ok := w.write(binding, descriptorType, 1)
+	if !ok {
+		return w
+	}
+	info := vk.DescriptorImageInfo{
+		ImageView:   view.Handle(),
+		ImageLayout: layout,
+	}
+	if sampler != nil {
+		info.Sampler = sampler.Handle()
+	}
+	write.PImageInfo = []vk.DescriptorImageInfo{info}
+	w.writes = append(w.writes, write)
+	return w
+}
+
+// Texture writes a combined image sampler to be read in
+// ShaderReadOnlyOptimal.
+func (w *DescriptorWriter) Texture(binding uint32, view *ImageView, sampler *Sampler) *DescriptorWriter {
+	return w.Image(binding, vk.DescriptorTypeCombinedImageSampler, view, vk.ImageLayoutShaderReadOnlyOptimal, sampler)
+}
+
+func (w *DescriptorWriter) Sampler(binding uint32, sampler *Sampler) *DescriptorWriter {
+	write, ok := w.write(binding, vk.DescriptorTypeSampler, 1)
+	if !ok {
+		return w
+	}
+	write.PImageInfo = []vk.DescriptorImageInfo{
+		{
+			Sampler: sampler.Handle(),
+		},
+	}
+	w.writes = append(w.writes, write)
+	return w
+}
+
+func (w *DescriptorWriter) Update() error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.writes) > 0 {
+		vk.UpdateDescriptorSets(w.set.logicalDevice, uint32(len(w.writes)), w.writes, 0, nil)
+	}
+	w.writes = nil
+	return nil
+}
@@ -1,54 +1,196 @@
 package pompeii
 
 import (
+	"strings"
+
 	"github.com/pkg/errors"
 	vk "github.com/vulkan-go/vulkan"
 )
 
+type DeviceOptions struct {
+	RequiredExtensions []string
+	// OptionalExtensions are enabled when the GPU supports them.
+	OptionalExtensions []string
+
+	RequiredFeatures DeviceFeatures
+	// OptionalFeatures are enabled when the GPU supports them.
+	OptionalFeatures DeviceFeatures
+}
+
+// MissingDeviceSupportError lists every required extension and feature the
+// GPU lacks.
+type MissingDeviceSupportError struct {
+	GPU        string
+	Extensions []string
+	Features   []string
+}
+
+func (e *MissingDeviceSupportError) Error() string {
+	missing := []string{}
+	if len(e.Extensions) > 0 {
+		missing = append(missing, "extensions "+strings.Join(e.Extensions, ", "))
+	}
+	if len(e.Features) > 0 {
+		missing = append(missing, "features "+strings.Join(e.Features, ", "))
+	}
+	return e.GPU + " is missing " + strings.Join(missing, " and ")
+}
+
 type Device struct {
 	GraphicsIndex int
 	PresentIndex  int
 
+	GraphicsQueue *Queue
+	// PresentQueue is nil when the plan had no surface.
+	PresentQueue  *Queue
+	ComputeQueue  *Queue
+	TransferQueue *Queue
+	// Queues holds every created queue, each slot only once.
+	Queues []*Queue
+
+	// Extensions and Features that were actually enabled, required and
+	// supported optional ones alike.
+	Extensions []string
+	Features   DeviceFeatures
+
+	instance      vk.Instance
+	limits        vk.PhysicalDeviceLimits
 	logicalDevice vk.Device
+	vulkan12      bool
+	debugUtils    *debugUtils
 }
 
-func NewDevice(g *GPU, graphicsFamilyIndex, presentFamilyIndex int) (*Device, error) {
+func NewDevice(g *GPU, plan *QueuePlan, options DeviceOptions) (*Device, error) {
 	d := Device{
-		GraphicsIndex: graphicsFamilyIndex,
-		PresentIndex:  presentFamilyIndex,
+		GraphicsIndex: plan.Graphics[0].Family,
+		PresentIndex:  plan.Present.Family,
+		instance:      g.instance,
+		limits:        g.Limits(),
+	}
+
+	available, err := g.Extensions()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get device extensions")
+	}
+	supported := g.SupportedFeatures()
+
+	missing := MissingDeviceSupportError{
+		GPU:      g.Name,
+		Features: options.RequiredFeatures.Missing(supported),
+	}
+	for _, name := range options.RequiredExtensions {
+		if inStringSlice(available, name) {
+			d.Extensions = append(d.Extensions, name)
+		} else {
+			missing.Extensions = append(missing.Extensions, name)
+		}
+	}
+	if len(missing.Extensions) > 0 || len(missing.Features) > 0 {
+		return nil, &missing
+	}
+	for _, name := range options.OptionalExtensions {
+		if inStringSlice(available, name) && !inStringSlice(d.Extensions, name) {
+			d.Extensions = append(d.Extensions, name)
+		}
 	}
+	d.Features = options.RequiredFeatures.Union(options.OptionalFeatures.Intersect(supported))
 
-	queuePriorities := []float32{1.0}
+	// Before 1.2 timeline semaphores come from their extension.
+	d.vulkan12 = g.apiVersionAtLeast(1, 2)
+	timelineKHR := !d.vulkan12 && d.Features.Vulkan12.TimelineSemaphore == vk.True
+	if timelineKHR && !inStringSlice(d.Extensions, "VK_KHR_timeline_semaphore") {
+		d.Extensions = append(d.Extensions, "VK_KHR_timeline_semaphore")
+	}
+
+	activeExtensions := make([]string, len(d.Extensions))
+	for t, name := range d.Extensions {
+		activeExtensions[t] = vkString(name)
+	}
+
+	queueCreateInfos := plan.createInfos()
 	deviceCreateInfo := vk.DeviceCreateInfo{
-		SType:                vk.StructureTypeDeviceCreateInfo,
-		QueueCreateInfoCount: 1,
-		PQueueCreateInfos: []vk.DeviceQueueCreateInfo{
-			{
-				SType:            vk.StructureTypeDeviceQueueCreateInfo,
-				QueueFamilyIndex: uint32(graphicsFamilyIndex),
-				QueueCount:       uint32(len(queuePriorities)),
-				PQueuePriorities: queuePriorities,
-			},
-		},
+		SType:                   vk.StructureTypeDeviceCreateInfo,
+		QueueCreateInfoCount:    uint32(len(queueCreateInfos)),
+		PQueueCreateInfos:       queueCreateInfos,
 		EnabledLayerCount:       0,
 		PpEnabledLayerNames:     nil,
-		EnabledExtensionCount:   1,
-		PpEnabledExtensionNames: []string{vkString("VK_KHR_swapchain")},
+		EnabledExtensionCount:   uint32(len(activeExtensions)),
+		PpEnabledExtensionNames: activeExtensions,
+	}
+	// Anything beyond the core features has to go through the pNext chain,
+	// in which case pEnabledFeatures must be left empty.
+	if d.Features.extended() {
+		chain := newFeatureChain(d.Features, d.vulkan12, timelineKHR)
+		defer chain.free()
+		deviceCreateInfo.PNext = chain.pointer()
+	} else {
+		deviceCreateInfo.PEnabledFeatures = []vk.PhysicalDeviceFeatures{
+			d.Features.Core,
+		}
 	}
 	if result := vk.CreateDevice(g.Handle(), &deviceCreateInfo, nil, &d.logicalDevice); result != vk.Success {
 		return nil, errors.Wrap(vk.Error(result), "create device")
 	}
+	d.debugUtils = loadDebugUtils(d.instance)
+
+	queues := map[QueueSlot]*Queue{}
+	queue := func(slot QueueSlot) *Queue {
+		if q, ok := queues[slot]; ok {
+			return q
+		}
+		q := newQueue(d.logicalDevice, slot, d.debugUtils)
+		queues[slot] = q
+		d.Queues = append(d.Queues, q)
+		return q
+	}
+	d.GraphicsQueue = queue(plan.Graphics[0])
+	for _, slot := range plan.Graphics[1:] {
+		queue(slot)
+	}
+	if plan.Present.Family != -1 {
+		d.PresentQueue = queue(plan.Present)
+	}
+	d.ComputeQueue = queue(plan.Compute[0])
+	for _, slot := range plan.Compute[1:] {
+		queue(slot)
+	}
+	d.TransferQueue = queue(plan.Transfer[0])
+	for _, slot := range plan.Transfer[1:] {
+		queue(slot)
+	}
 
 	return &d, nil
 }
 
+// Queue returns the queue created for slot, or nil if the plan had none.
+func (d *Device) Queue(slot QueueSlot) *Queue {
+	for _, q := range d.Queues {
+		if q.Family == slot.Family && q.Index == slot.Index {
+			return q
+		}
+	}
+	return nil
+}
+
 func (d *Device) Destroy() {
 	d.WaitIdle()
 	vk.DestroyDevice(d.logicalDevice, nil)
 }
 
+// WaitIdle holds every queue lock while waiting, vkDeviceWaitIdle requires
+// all queues to be externally synchronized.
 func (d *Device) WaitIdle() {
+	for _, q := range d.Queues {
+		q.mutex.Lock()
+	}
 	vk.DeviceWaitIdle(d.logicalDevice)
+	for _, q := range d.Queues {
+		q.mutex.Unlock()
+	}
+}
+
+func (d *Device) HasExtension(name string) bool {
+	return inStringSlice(d.Extensions, name)
 }
 
 func (d *Device) Handle() vk.Device {
@@ -0,0 +1,165 @@
+#include <stddef.h>
+
+#include "ext.h"
+#include "_cgo_export.h"
+
+#if defined(_WIN32)
+#include <windows.h>
+#else
+#include <dlfcn.h>
+#endif
+
+static pompeiiGetInstanceProcAddrFunc getInstanceProcAddr = NULL;
+
+void pompeiiSetGetInstanceProcAddr(void *fn) {
+	getInstanceProcAddr = (pompeiiGetInstanceProcAddrFunc)fn;
+}
+
+void *pompeiiGetInstanceProcAddr(void) {
+	return (void *)getInstanceProcAddr;
+}
+
+int pompeiiLoadDefaultGetInstanceProcAddr(void) {
+#if defined(_WIN32)
+	HMODULE lib = LoadLibraryA("vulkan-1.dll");
+	if (lib == NULL) {
+		return 0;
+	}
+	getInstanceProcAddr = (pompeiiGetInstanceProcAddrFunc)GetProcAddress(lib, "vkGetInstanceProcAddr");
+#else
+#if defined(__APPLE__)
+	const char *names[] = {"libvulkan.1.dylib", "libvulkan.dylib", "libMoltenVK.dylib", NULL};
+#else
+	const char *names[] = {"libvulkan.so.1", "libvulkan.so", NULL};
+#endif
+	void *lib = NULL;
+	for (int t = 0; names[t] != NULL && lib == NULL; t++) {
+		lib = dlopen(names[t], RTLD_NOW | RTLD_LOCAL);
+	}
+	if (lib == NULL) {
+		return 0;
+	}
+	getInstanceProcAddr = (pompeiiGetInstanceProcAddrFunc)dlsym(lib, "vkGetInstanceProcAddr");
+#endif
+	return getInstanceProcAddr != NULL;
+}
+
+void *pompeiiInstanceProc(void *instance, const char *name) {
+	if (getInstanceProcAddr == NULL) {
+		return NULL;
+	}
+	return (void *)getInstanceProcAddr(instance, name);
+}
+
+typedef pompeiiVoidFunction (POMPEII_VKAPI *getDeviceProcAddrFunc)(void *device, const char *name);
+
+// pompeiiDeviceProc skips the loader's dispatch for device commands, and only
+// returns commands the device actually enabled.
+void *pompeiiDeviceProc(void *instance, void *device, const char *name) {
+	getDeviceProcAddrFunc getDeviceProcAddr = (getDeviceProcAddrFunc)pompeiiInstanceProc(instance, "vkGetDeviceProcAddr");
+	if (getDeviceProcAddr == NULL) {
+		return NULL;
+	}
+	return (void *)getDeviceProcAddr(device, name);
+}
+
+typedef int32_t (POMPEII_VKAPI *createHeadlessSurfaceFunc)(void *instance, const pompeiiHeadlessSurfaceCreateInfo *info, const void *allocator, uint64_t *surface);
+
+int32_t pompeiiCreateHeadlessSurface(void *fn, void *instance, const pompeiiHeadlessSurfaceCreateInfo *info, uint64_t *surface) {
+	return ((createHeadlessSurfaceFunc)fn)(instance, info, NULL, surface);
+}
+
+typedef int32_t (POMPEII_VKAPI *enumerateInstanceVersionFunc)(uint32_t *version);
+
+int32_t pompeiiEnumerateInstanceVersion(void *fn, uint32_t *version) {
+	return ((enumerateInstanceVersionFunc)fn)(version);
+}
+
+typedef void (POMPEII_VKAPI *getPhysicalDeviceFeatures2Func)(void *physicalDevice, void *features);
+
+void pompeiiGetPhysicalDeviceFeatures2(void *fn, void *physicalDevice, void *features) {
+	((getPhysicalDeviceFeatures2Func)fn)(physicalDevice, features);
+}
+
+// VkPhysicalDeviceProperties2 with room for VkPhysicalDeviceProperties, which
+// is not mirrored as only the chained structs are of interest.
+typedef struct {
+	int32_t sType;
+	void *pNext;
+	uint64_t properties[256];
+} physicalDeviceProperties2;
+
+typedef void (POMPEII_VKAPI *getPhysicalDeviceProperties2Func)(void *physicalDevice, physicalDeviceProperties2 *properties);
+
+void pompeiiGetPhysicalDeviceDriverProperties(void *fn, void *physicalDevice, pompeiiDriverProperties *driver) {
+	physicalDeviceProperties2 properties = {
+		.sType = 1000059001,
+		.pNext = driver,
+	};
+	((getPhysicalDeviceProperties2Func)fn)(physicalDevice, &properties);
+}
+
+typedef int32_t (POMPEII_VKAPI *waitSemaphoresFunc)(void *device, const pompeiiSemaphoreWaitInfo *info, uint64_t timeout);
+typedef int32_t (POMPEII_VKAPI *signalSemaphoreFunc)(void *device, const pompeiiSemaphoreSignalInfo *info);
+typedef int32_t (POMPEII_VKAPI *getSemaphoreCounterValueFunc)(void *device, uint64_t semaphore, uint64_t *value);
+
+int32_t pompeiiWaitSemaphores(void *fn, void *device, const pompeiiSemaphoreWaitInfo *info, uint64_t timeout) {
+	return ((waitSemaphoresFunc)fn)(device, info, timeout);
+}
+
+int32_t pompeiiSignalSemaphore(void *fn, void *device, const pompeiiSemaphoreSignalInfo *info) {
+	return ((signalSemaphoreFunc)fn)(device, info);
+}
+
+int32_t pompeiiGetSemaphoreCounterValue(void *fn, void *device, uint64_t semaphore, uint64_t *value) {
+	return ((getSemaphoreCounterValueFunc)fn)(device, semaphore, value);
+}
+
+typedef uint32_t (POMPEII_VKAPI *debugUtilsMessengerCallback)(uint32_t severity, uint32_t types, const pompeiiDebugUtilsMessengerCallbackData *data, void *userData);
+
+typedef struct {
+	int32_t sType;
+	const void *pNext;
+	uint32_t flags;
+	uint32_t messageSeverity;
+	uint32_t messageType;
+	debugUtilsMessengerCallback pfnUserCallback;
+	void *pUserData;
+} debugUtilsMessengerCreateInfo;
+
+typedef int32_t (POMPEII_VKAPI *createDebugUtilsMessengerFunc)(void *instance, const debugUtilsMessengerCreateInfo *info, const void *allocator, uint64_t *messenger);
+typedef void (POMPEII_VKAPI *destroyDebugUtilsMessengerFunc)(void *instance, uint64_t messenger, const void *allocator);
+typedef int32_t (POMPEII_VKAPI *setDebugUtilsObjectNameFunc)(void *device, const pompeiiDebugUtilsObjectNameInfo *info);
+typedef void (POMPEII_VKAPI *debugUtilsLabelFunc)(void *object, const pompeiiDebugUtilsLabel *label);
+typedef void (POMPEII_VKAPI *debugUtilsEndLabelFunc)(void *object);
+
+static uint32_t POMPEII_VKAPI debugUtilsCallback(uint32_t severity, uint32_t types, const pompeiiDebugUtilsMessengerCallbackData *data, void *userData) {
+	return pompeiiDebugUtilsMessage(severity, types, (pompeiiDebugUtilsMessengerCallbackData *)data, (uintptr_t)userData);
+}
+
+int32_t pompeiiCreateDebugUtilsMessenger(void *fn, void *instance, uint32_t severities, uint32_t types, uintptr_t id, uint64_t *messenger) {
+	debugUtilsMessengerCreateInfo info = {
+		.sType = 1000128004,
+		.messageSeverity = severities,
+		.messageType = types,
+		.pfnUserCallback = debugUtilsCallback,
+		.pUserData = (void *)id,
+	};
+	return ((createDebugUtilsMessengerFunc)fn)(instance, &info, NULL, messenger);
+}
+
+void pompeiiDestroyDebugUtilsMessenger(void *fn, void *instance, uint64_t messenger) {
+	((destroyDebugUtilsMessengerFunc)fn)(instance, messenger, NULL);
+}
+
+int32_t pompeiiSetDebugUtilsObjectName(void *fn, void *device, const pompeiiDebugUtilsObjectNameInfo *info) {
+	return ((setDebugUtilsObjectNameFunc)fn)(device, info);
+}
+
+void pompeiiDebugUtilsLabelCommand(void *fn, void *object, const pompeiiDebugUtilsLabel *label) {
+	((debugUtilsLabelFunc)fn)(object, label);
+}
+
+void pompeiiDebugUtilsEndLabel(void *fn, void *object) {
+	((debugUtilsEndLabelFunc)fn)(object);
+}
@@ -0,0 +1,84 @@
+package pompeii
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <stdlib.h>
+#include "ext.h"
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// SetGetInstanceProcAddr hands the vkGetInstanceProcAddr pointer to both the
+// vulkan bindings and pompeii, which uses it to load extension entry points
+// the bindings do not know about. Must be called before Init.
+func SetGetInstanceProcAddr(procAddr unsafe.Pointer) {
+	C.pompeiiSetGetInstanceProcAddr(procAddr)
+	vk.SetGetInstanceProcAddr(procAddr)
+}
+
+// SetDefaultGetInstanceProcAddr loads the system Vulkan loader directly, for
+// when there is no windowing library around to provide it (e.g. headless).
+func SetDefaultGetInstanceProcAddr() error {
+	if C.pompeiiLoadDefaultGetInstanceProcAddr() == 0 {
+		return errors.New("could not load vulkan library")
+	}
+	vk.SetGetInstanceProcAddr(C.pompeiiGetInstanceProcAddr())
+	return nil
+}
+
+func instanceProc(instance vk.Instance, name string) unsafe.Pointer {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	return C.pompeiiInstanceProc(unsafe.Pointer(instance), cName)
+}
+
+// properties2Proc looks up one of the vkGetPhysicalDevice*2 commands, core
+// from 1.1 on and from VK_KHR_get_physical_device_properties2 before. It is
+// nil when the instance can use neither.
+func (g *GPU) properties2Proc(name string) unsafe.Pointer {
+	switch {
+	case g.apiVersionAtLeast(1, 1):
+		return instanceProc(g.instance, name)
+	case g.properties2KHR:
+		return instanceProc(g.instance, name+"KHR")
+	default:
+		return nil
+	}
+}
+
+func (i *Instance) proc(name string) (unsafe.Pointer, error) {
+	fn := instanceProc(i.instance, name)
+	if fn == nil {
+		return nil, errors.Errorf("%s not available", name)
+	}
+	return fn, nil
+}
+
+// proc looks up a device level command through vkGetDeviceProcAddr. Core
+// names resolve on any device, so callers pick between a core name and its
+// extension name by the API version themselves.
+func (d *Device) proc(name string) (unsafe.Pointer, error) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	fn := C.pompeiiDeviceProc(unsafe.Pointer(d.instance), unsafe.Pointer(d.logicalDevice), cName)
+	if fn == nil {
+		return nil, errors.Errorf("%s not available", name)
+	}
+	return fn, nil
+}
+
+// surfaceFromUint64 converts a surface handle returned by a trampoline into
+// the vulkan binding type.
+func surfaceFromUint64(handle uint64) vk.Surface {
+	return *(*vk.Surface)(unsafe.Pointer(&handle))
+}
+
+func semaphoreToUint64(semaphore vk.Semaphore) uint64 {
+	return *(*uint64)(unsafe.Pointer(&semaphore))
+}
@@ -0,0 +1,145 @@
+// Trampolines for entry points the vulkan bindings do not load themselves.
+// Only the handful of types needed by the trampolines are mirrored here so
+// pompeii does not depend on a particular set of Vulkan headers.
+#ifndef POMPEII_EXT_H
+#define POMPEII_EXT_H
+
+#include <stdint.h>
+
+#if defined(_WIN32)
+#define POMPEII_VKAPI __stdcall
+#else
+#define POMPEII_VKAPI
+#endif
+
+typedef void (POMPEII_VKAPI *pompeiiVoidFunction)(void);
+typedef pompeiiVoidFunction (POMPEII_VKAPI *pompeiiGetInstanceProcAddrFunc)(void *instance, const char *name);
+
+void pompeiiSetGetInstanceProcAddr(void *fn);
+void *pompeiiGetInstanceProcAddr(void);
+int pompeiiLoadDefaultGetInstanceProcAddr(void);
+void *pompeiiInstanceProc(void *instance, const char *name);
+void *pompeiiDeviceProc(void *instance, void *device, const char *name);
+
+// VK_EXT_headless_surface
+typedef struct {
+	int32_t sType;
+	const void *pNext;
+	uint32_t flags;
+} pompeiiHeadlessSurfaceCreateInfo;
+
+int32_t pompeiiCreateHeadlessSurface(void *fn, void *instance, const pompeiiHeadlessSurfaceCreateInfo *info, uint64_t *surface);
+
+// vkGetPhysicalDeviceFeatures2, core in 1.1
+void pompeiiGetPhysicalDeviceFeatures2(void *fn, void *physicalDevice, void *features);
+
+// VK_KHR_timeline_semaphore, core in 1.2
+typedef struct {
+	int32_t sType;
+	const void *pNext;
+	uint32_t timelineSemaphore;
+} pompeiiTimelineSemaphoreFeatures;
+
+typedef struct {
+	int32_t sType;
+	const void *pNext;
+	int32_t semaphoreType;
+	uint64_t initialValue;
+} pompeiiSemaphoreTypeCreateInfo;
+
+typedef struct {
+	int32_t sType;
+	const void *pNext;
+	uint32_t waitSemaphoreValueCount;
+	const uint64_t *pWaitSemaphoreValues;
+	uint32_t signalSemaphoreValueCount;
+	const uint64_t *pSignalSemaphoreValues;
+} pompeiiTimelineSemaphoreSubmitInfo;
+
+typedef struct {
+	int32_t sType;
+	const void *pNext;
+	uint32_t flags;
+	uint32_t semaphoreCount;
+	const uint64_t *pSemaphores;
+	const uint64_t *pValues;
+} pompeiiSemaphoreWaitInfo;
+
+typedef struct {
+	int32_t sType;
+	const void *pNext;
+	uint64_t semaphore;
+	uint64_t value;
+} pompeiiSemaphoreSignalInfo;
+
+int32_t pompeiiWaitSemaphores(void *fn, void *device, const pompeiiSemaphoreWaitInfo *info, uint64_t timeout);
+int32_t pompeiiSignalSemaphore(void *fn, void *device, const pompeiiSemaphoreSignalInfo *info);
+int32_t pompeiiGetSemaphoreCounterValue(void *fn, void *device, uint64_t semaphore, uint64_t *value);
+
+// VK_EXT_debug_utils
+typedef struct {
+	int32_t sType;
+	const void *pNext;
+	const char *pLabelName;
+	float color[4];
+} pompeiiDebugUtilsLabel;
+
+typedef struct {
+	int32_t sType;
+	const void *pNext;
+	int32_t objectType;
+	uint64_t objectHandle;
+	const char *pObjectName;
+} pompeiiDebugUtilsObjectNameInfo;
+
+typedef struct {
+	int32_t sType;
+	const void *pNext;
+	uint32_t flags;
+	const char *pMessageIdName;
+	int32_t messageIdNumber;
+	const char *pMessage;
+	uint32_t queueLabelCount;
+	const pompeiiDebugUtilsLabel *pQueueLabels;
+	uint32_t cmdBufLabelCount;
+	const pompeiiDebugUtilsLabel *pCmdBufLabels;
+	uint32_t objectCount;
+	const pompeiiDebugUtilsObjectNameInfo *pObjects;
+} pompeiiDebugUtilsMessengerCallbackData;
+
+// The messenger calls back into Go with id as its user data.
+int32_t pompeiiCreateDebugUtilsMessenger(void *fn, void *instance, uint32_t severities, uint32_t types, uintptr_t id, uint64_t *messenger);
+void pompeiiDestroyDebugUtilsMessenger(void *fn, void *instance, uint64_t messenger);
+int32_t pompeiiSetDebugUtilsObjectName(void *fn, void *device, const pompeiiDebugUtilsObjectNameInfo *info);
+// Begin and insert label calls share a signature for queues and command
+// buffers alike, as do the end label calls.
+void pompeiiDebugUtilsLabelCommand(void *fn, void *object, const pompeiiDebugUtilsLabel *label);
+void pompeiiDebugUtilsEndLabel(void *fn, void *object);
+
+// vkEnumerateInstanceVersion, core in 1.1
+int32_t pompeiiEnumerateInstanceVersion(void *fn, uint32_t *version);
+
+// VK_EXT_validation_features
+typedef struct {
+	int32_t sType;
+	const void *pNext;
+	uint32_t enabledValidationFeatureCount;
+	const int32_t *pEnabledValidationFeatures;
+	uint32_t disabledValidationFeatureCount;
+	const int32_t *pDisabledValidationFeatures;
+} pompeiiValidationFeatures;
+
+// VkPhysicalDeviceDriverProperties, core in 1.2
+typedef struct {
+	int32_t sType;
+	void *pNext;
+	int32_t driverID;
+	char driverName[256];
+	char driverInfo[256];
+	uint8_t conformanceVersion[4];
+} pompeiiDriverProperties;
+
+// Queried through vkGetPhysicalDeviceProperties2, core in 1.1.
+void pompeiiGetPhysicalDeviceDriverProperties(void *fn, void *physicalDevice, pompeiiDriverProperties *driver);
+
+#endif
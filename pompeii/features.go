@@ -0,0 +1,298 @@
+package pompeii
+
+/*
+#include <stdlib.h>
+#include "ext.h"
+*/
+import "C"
+
+import (
+	"reflect"
+	"unsafe"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+const (
+	structureTypePhysicalDeviceFeatures2        = 1000059000
+	structureTypePhysicalDeviceVulkan11Features = 49
+	structureTypePhysicalDeviceVulkan12Features = 51
+	structureTypeTimelineSemaphoreFeatures      = 1000207000
+
+	coreFeatureCount = 55
+)
+
+// Vulkan11Features mirrors VkPhysicalDeviceVulkan11Features, field for field.
+type Vulkan11Features struct {
+	StorageBuffer16BitAccess           vk.Bool32
+	UniformAndStorageBuffer16BitAccess vk.Bool32
+	StoragePushConstant16              vk.Bool32
+	StorageInputOutput16               vk.Bool32
+	Multiview                          vk.Bool32
+	MultiviewGeometryShader            vk.Bool32
+	MultiviewTessellationShader        vk.Bool32
+	VariablePointersStorageBuffer      vk.Bool32
+	VariablePointers                   vk.Bool32
+	ProtectedMemory                    vk.Bool32
+	SamplerYcbcrConversion             vk.Bool32
+	ShaderDrawParameters               vk.Bool32
+}
+
+// Vulkan12Features mirrors VkPhysicalDeviceVulkan12Features, field for field.
+type Vulkan12Features struct {
+	SamplerMirrorClampToEdge                           vk.Bool32
+	DrawIndirectCount                                  vk.Bool32
+	StorageBuffer8BitAccess                            vk.Bool32
+	UniformAndStorageBuffer8BitAccess                  vk.Bool32
+	StoragePushConstant8                               vk.Bool32
+	ShaderBufferInt64Atomics                           vk.Bool32
+	ShaderSharedInt64Atomics                           vk.Bool32
+	ShaderFloat16                                      vk.Bool32
+	ShaderInt8                                         vk.Bool32
+	DescriptorIndexing                                 vk.Bool32
+	ShaderInputAttachmentArrayDynamicIndexing          vk.Bool32
+	ShaderUniformTexelBufferArrayDynamicIndexing       vk.Bool32
+	ShaderStorageTexelBufferArrayDynamicIndexing       vk.Bool32
+	ShaderUniformBufferArrayNonUniformIndexing         vk.Bool32
+	ShaderSampledImageArrayNonUniformIndexing          vk.Bool32
+	ShaderStorageBufferArrayNonUniformIndexing         vk.Bool32
+	ShaderStorageImageArrayNonUniformIndexing          vk.Bool32
+	ShaderInputAttachmentArrayNonUniformIndexing       vk.Bool32
+	ShaderUniformTexelBufferArrayNonUniformIndexing    vk.Bool32
+	ShaderStorageTexelBufferArrayNonUniformIndexing    vk.Bool32
+	DescriptorBindingUniformBufferUpdateAfterBind      vk.Bool32
+	DescriptorBindingSampledImageUpdateAfterBind       vk.Bool32
+	DescriptorBindingStorageImageUpdateAfterBind       vk.Bool32
+	DescriptorBindingStorageBufferUpdateAfterBind      vk.Bool32
+	DescriptorBindingUniformTexelBufferUpdateAfterBind vk.Bool32
+	DescriptorBindingStorageTexelBufferUpdateAfterBind vk.Bool32
+	DescriptorBindingUpdateUnusedWhilePending          vk.Bool32
+	DescriptorBindingPartiallyBound                    vk.Bool32
+	DescriptorBindingVariableDescriptorCount           vk.Bool32
+	RuntimeDescriptorArray                             vk.Bool32
+	SamplerFilterMinmax                                vk.Bool32
+	ScalarBlockLayout                                  vk.Bool32
+	ImagelessFramebuffer                               vk.Bool32
+	UniformBufferStandardLayout                        vk.Bool32
+	ShaderSubgroupExtendedTypes                        vk.Bool32
+	SeparateDepthStencilLayouts                        vk.Bool32
+	HostQueryReset                                     vk.Bool32
+	TimelineSemaphore                                  vk.Bool32
+	BufferDeviceAddress                                vk.Bool32
+	BufferDeviceAddressCaptureReplay                   vk.Bool32
+	BufferDeviceAddressMultiDevice                     vk.Bool32
+	VulkanMemoryModel                                  vk.Bool32
+	VulkanMemoryModelDeviceScope                       vk.Bool32
+	VulkanMemoryModelAvailabilityVisibilityChains      vk.Bool32
+	ShaderOutputViewportIndex                          vk.Bool32
+	ShaderOutputLayer                                  vk.Bool32
+	SubgroupBroadcastDynamicID                         vk.Bool32
+}
+
+// DeviceFeatures bundles the core features with the Vulkan 1.1 and 1.2
+// feature structs, the latter only being available on 1.2 devices.
+type DeviceFeatures struct {
+	Core     vk.PhysicalDeviceFeatures
+	Vulkan11 Vulkan11Features
+	Vulkan12 Vulkan12Features
+}
+
+// C layouts of the feature structs, allocated in C memory so they can be
+// chained through pNext.
+type physicalDeviceFeatures2C struct {
+	sType    int32
+	pNext    unsafe.Pointer
+	features [coreFeatureCount]vk.Bool32
+}
+
+type vulkan11FeaturesC struct {
+	sType    int32
+	pNext    unsafe.Pointer
+	features Vulkan11Features
+}
+
+type vulkan12FeaturesC struct {
+	sType    int32
+	pNext    unsafe.Pointer
+	features Vulkan12Features
+}
+
+// featureChain is a VkPhysicalDeviceFeatures2 → Vulkan11 → Vulkan12 chain
+// living in C memory. Must be freed. On pre 1.2 devices the extension feature
+// structs of promoted features take the place of Vulkan12.
+type featureChain struct {
+	features2 *physicalDeviceFeatures2C
+	vulkan11  *vulkan11FeaturesC
+	vulkan12  *vulkan12FeaturesC
+	timeline  *C.pompeiiTimelineSemaphoreFeatures
+}
+
+func newFeatureChain(f DeviceFeatures, withVulkan12, withTimelineKHR bool) featureChain {
+	c := featureChain{
+		features2: (*physicalDeviceFeatures2C)(C.calloc(1, C.size_t(unsafe.Sizeof(physicalDeviceFeatures2C{})))),
+	}
+	c.features2.sType = structureTypePhysicalDeviceFeatures2
+	c.features2.features = coreFeaturesToArray(f.Core)
+
+	if withVulkan12 {
+		c.vulkan11 = (*vulkan11FeaturesC)(C.calloc(1, C.size_t(unsafe.Sizeof(vulkan11FeaturesC{}))))
+		c.vulkan11.sType = structureTypePhysicalDeviceVulkan11Features
+		c.vulkan11.features = f.Vulkan11
+
+		c.vulkan12 = (*vulkan12FeaturesC)(C.calloc(1, C.size_t(unsafe.Sizeof(vulkan12FeaturesC{}))))
+		c.vulkan12.sType = structureTypePhysicalDeviceVulkan12Features
+		c.vulkan12.features = f.Vulkan12
+
+		c.features2.pNext = unsafe.Pointer(c.vulkan11)
+		c.vulkan11.pNext = unsafe.Pointer(c.vulkan12)
+	} else if withTimelineKHR {
+		c.timeline = (*C.pompeiiTimelineSemaphoreFeatures)(C.calloc(1, C.sizeof_pompeiiTimelineSemaphoreFeatures))
+		c.timeline.sType = structureTypeTimelineSemaphoreFeatures
+		c.timeline.timelineSemaphore = C.uint32_t(f.Vulkan12.TimelineSemaphore)
+		c.features2.pNext = unsafe.Pointer(c.timeline)
+	}
+
+	return c
+}
+
+func (c featureChain) features() DeviceFeatures {
+	f := DeviceFeatures{
+		Core: coreFeaturesFromArray(c.features2.features),
+	}
+	if c.vulkan11 != nil {
+		f.Vulkan11 = c.vulkan11.features
+		f.Vulkan12 = c.vulkan12.features
+	}
+	if c.timeline != nil {
+		f.Vulkan12.TimelineSemaphore = vk.Bool32(c.timeline.timelineSemaphore)
+	}
+	return f
+}
+
+func (c featureChain) pointer() unsafe.Pointer {
+	return unsafe.Pointer(c.features2)
+}
+
+func (c featureChain) free() {
+	C.free(unsafe.Pointer(c.features2))
+	if c.vulkan11 != nil {
+		C.free(unsafe.Pointer(c.vulkan11))
+		C.free(unsafe.Pointer(c.vulkan12))
+	}
+	if c.timeline != nil {
+		C.free(unsafe.Pointer(c.timeline))
+	}
+}
+
+// queryFeatures asks the driver for all features it knows of and records
+// which of the chained structs it filled in, falling back to the plain 1.0
+// query when the instance can not use vkGetPhysicalDeviceFeatures2.
+func queryFeatures(g *GPU) {
+	g.supported = DeviceFeatures{
+		Core: g.features,
+	}
+	fn := g.properties2Proc("vkGetPhysicalDeviceFeatures2")
+	if fn == nil {
+		return
+	}
+
+	vulkan12 := g.apiVersionAtLeast(1, 2)
+	timelineKHR := false
+	if !vulkan12 {
+		if extensions, err := g.Extensions(); err == nil {
+			timelineKHR = inStringSlice(extensions, "VK_KHR_timeline_semaphore")
+		}
+	}
+
+	chain := newFeatureChain(DeviceFeatures{}, vulkan12, timelineKHR)
+	defer chain.free()
+	C.pompeiiGetPhysicalDeviceFeatures2(fn, unsafe.Pointer(g.physicalDevice), chain.pointer())
+
+	g.supported = chain.features()
+	g.queriedVulkan12 = vulkan12
+	g.queriedTimelineKHR = timelineKHR
+}
+
+func coreFeaturesToArray(f vk.PhysicalDeviceFeatures) [coreFeatureCount]vk.Bool32 {
+	var array [coreFeatureCount]vk.Bool32
+	v := reflect.ValueOf(f)
+	n := 0
+	for t := 0; t < v.NumField() && n < coreFeatureCount; t++ {
+		if v.Type().Field(t).Type == bool32Type {
+			array[n] = vk.Bool32(v.Field(t).Uint())
+			n++
+		}
+	}
+	return array
+}
+
+func coreFeaturesFromArray(array [coreFeatureCount]vk.Bool32) vk.PhysicalDeviceFeatures {
+	var f vk.PhysicalDeviceFeatures
+	v := reflect.ValueOf(&f).Elem()
+	n := 0
+	for t := 0; t < v.NumField() && n < coreFeatureCount; t++ {
+		if v.Type().Field(t).Type == bool32Type {
+			v.Field(t).SetUint(uint64(array[n]))
+			n++
+		}
+	}
+	return f
+}
+
+var bool32Type = reflect.TypeOf(vk.Bool32(0))
+
+// eachBool32 calls fn for every exported Bool32 field of the structs a and b,
+// which must be the same struct type, and stores the result in out.
+func eachBool32(out, a, b reflect.Value, fn func(name string, a, b bool) bool) {
+	for t := 0; t < a.NumField(); t++ {
+		field := a.Type().Field(t)
+		if field.PkgPath != "" || field.Type != bool32Type {
+			continue
+		}
+		if fn(field.Name, a.Field(t).Uint() != 0, b.Field(t).Uint() != 0) {
+			out.Field(t).SetUint(uint64(vk.True))
+		}
+	}
+}
+
+func (f DeviceFeatures) combine(other DeviceFeatures, fn func(name string, a, b bool) bool) DeviceFeatures {
+	var out DeviceFeatures
+	eachBool32(reflect.ValueOf(&out.Core).Elem(), reflect.ValueOf(f.Core), reflect.ValueOf(other.Core), fn)
+	eachBool32(reflect.ValueOf(&out.Vulkan11).Elem(), reflect.ValueOf(f.Vulkan11), reflect.ValueOf(other.Vulkan11), func(name string, a, b bool) bool {
+		return fn("Vulkan11."+name, a, b)
+	})
+	eachBool32(reflect.ValueOf(&out.Vulkan12).Elem(), reflect.ValueOf(f.Vulkan12), reflect.ValueOf(other.Vulkan12), func(name string, a, b bool) bool {
+		return fn("Vulkan12."+name, a, b)
+	})
+	return out
+}
+
+// Missing lists the features enabled in f but not in supported.
+func (f DeviceFeatures) Missing(supported DeviceFeatures) []string {
+	missing := []string{}
+	f.combine(supported, func(name string, a, b bool) bool {
+		if a && !b {
+			missing = append(missing, name)
+		}
+		return false
+	})
+	return missing
+}
+
+func (f DeviceFeatures) Intersect(other DeviceFeatures) DeviceFeatures {
+	return f.combine(other, func(_ string, a, b bool) bool {
+		return a && b
+	})
+}
+
+func (f DeviceFeatures) Union(other DeviceFeatures) DeviceFeatures {
+	return f.combine(other, func(_ string, a, b bool) bool {
+		return a || b
+	})
+}
+
+// extended reports whether any Vulkan 1.1 or 1.2 feature is enabled, which
+// requires passing the features through the pNext chain.
+func (f DeviceFeatures) extended() bool {
+	return f.Vulkan11 != (Vulkan11Features{}) || f.Vulkan12 != (Vulkan12Features{})
+}
@@ -0,0 +1,100 @@
+package pompeii
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// ErrFenceTimeout is returned when a fence wait runs out of time.
+var ErrFenceTimeout = errors.New("fence wait timed out")
+
+// fencePollInterval is how often WaitContext checks for cancellation.
+const fencePollInterval = 10 * time.Millisecond
+
+type Fence struct {
+	logicalDevice vk.Device
+	fence         vk.Fence
+}
+
+func NewFence(d *Device, signaled bool) (*Fence, error) {
+	f := Fence{
+		logicalDevice: d.Handle(),
+	}
+
+	fenceCreateInfo := vk.FenceCreateInfo{
+		SType: vk.StructureTypeFenceCreateInfo,
+	}
+	if signaled {
+		fenceCreateInfo.Flags = vk.FenceCreateFlags(vk.FenceCreateSignaledBit)
+	}
+	if result := vk.CreateFence(d.Handle(), &fenceCreateInfo, nil, &f.fence); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "create fence")
+	}
+
+	return &f, nil
+}
+
+func (f *Fence) Destroy() {
+	if f.fence != vk.NullFence {
+		vk.DestroyFence(f.logicalDevice, f.fence, nil)
+	}
+}
+
+// Wait blocks until the fence is signaled or timeout passes, a negative
+// timeout waits forever.
+func (f *Fence) Wait(timeout time.Duration) error {
+	nanos := vk.MaxUint64
+	if timeout >= 0 {
+		nanos = uint64(timeout.Nanoseconds())
+	}
+
+	switch result := vk.WaitForFences(f.logicalDevice, 1, []vk.Fence{f.fence}, vk.True, nanos); result {
+	case vk.Success:
+		return nil
+	case vk.Timeout:
+		return ErrFenceTimeout
+	default:
+		return errors.Wrap(vk.Error(result), "wait for fence")
+	}
+}
+
+// WaitContext blocks until the fence is signaled or ctx is done.
+func (f *Fence) WaitContext(ctx context.Context) error {
+	for {
+		err := f.Wait(fencePollInterval)
+		if err != ErrFenceTimeout {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+	}
+}
+
+func (f *Fence) Reset() error {
+	if result := vk.ResetFences(f.logicalDevice, 1, []vk.Fence{f.fence}); result != vk.Success {
+		return errors.Wrap(vk.Error(result), "reset fence")
+	}
+	return nil
+}
+
+// Status reports whether the fence is signaled without blocking.
+func (f *Fence) Status() (bool, error) {
+	switch result := vk.GetFenceStatus(f.logicalDevice, f.fence); result {
+	case vk.Success:
+		return true, nil
+	case vk.NotReady:
+		return false, nil
+	default:
+		return false, errors.Wrap(vk.Error(result), "get fence status")
+	}
+}
+
+func (f *Fence) Handle() vk.Fence {
+	return f.fence
+}
@@ -0,0 +1,184 @@
+package pompeii
+
+import (
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Frame holds everything a single frame in flight needs. Its resources may
+// only be touched between FrameContext.Begin and the frame's Submit.
+type Frame struct {
+	Index int
+
+	ImageAvailable *Semaphore
+	RenderFinished *Semaphore
+	InFlight       *Fence
+
+	// CommandPool is transient and reset by FrameContext.Begin, buffers
+	// allocated from it are only valid for this frame's recording.
+	CommandPool    *CommandPool
+	CommandBuffers []*CommandBuffer
+
+	// Descriptors is reset by FrameContext.Begin like CommandPool.
+	Descriptors *DescriptorAllocator
+}
+
+func newFrame(d *Device, index, queueFamily, commandBuffers int) (*Frame, error) {
+	f := Frame{
+		Index: index,
+	}
+
+	var err error
+	if f.ImageAvailable, err = NewSemaphore(d); err != nil {
+		return nil, err
+	}
+	if f.RenderFinished, err = NewSemaphore(d); err != nil {
+		f.destroy()
+		return nil, err
+	}
+	if f.InFlight, err = NewFence(d, true); err != nil {
+		f.destroy()
+		return nil, err
+	}
+
+	if f.CommandPool, err = NewCommandPool(d, queueFamily, true, false); err != nil {
+		f.destroy()
+		return nil, err
+	}
+	if commandBuffers > 0 {
+		if f.CommandBuffers, err = f.CommandPool.Allocate(commandBuffers, false); err != nil {
+			f.destroy()
+			return nil, err
+		}
+	}
+	f.Descriptors = NewDescriptorAllocator(d, 0, nil)
+
+	return &f, nil
+}
+
+func (f *Frame) destroy() {
+	if f.Descriptors != nil {
+		f.Descriptors.Destroy()
+	}
+	if f.CommandPool != nil {
+		f.CommandPool.Destroy()
+	}
+	if f.InFlight != nil {
+		f.InFlight.Destroy()
+	}
+	if f.RenderFinished != nil {
+		f.RenderFinished.Destroy()
+	}
+	if f.ImageAvailable != nil {
+		f.ImageAvailable.Destroy()
+	}
+}
+
+// Submit submits the frame's command buffers to queue. The submission waits
+// for ImageAvailable at waitStage, then signals RenderFinished and InFlight.
+// When the submit fails, an empty one still waits for ImageAvailable and
+// signals InFlight, so the next Acquire gets an unsignaled semaphore and
+// Begin never waits on a fence nothing will signal.
+func (f *Frame) Submit(queue *Queue, waitStage vk.PipelineStageFlagBits) error {
+	if err := f.InFlight.Reset(); err != nil {
+		return err
+	}
+
+	err := queue.SubmitBatches([]SubmitBatch{
+		{
+			Waits: []SemaphoreWait{
+				{
+					Semaphore: f.ImageAvailable,
+					Stage:     waitStage,
+				},
+			},
+			CommandBuffers: f.CommandBuffers,
+			Signals: []SemaphoreSignal{
+				{
+					Semaphore: f.RenderFinished,
+				},
+			},
+		},
+	}, f.InFlight)
+	if err != nil {
+		recovery := queue.SubmitBatches([]SubmitBatch{
+			{
+				Waits: []SemaphoreWait{
+					{
+						Semaphore: f.ImageAvailable,
+						Stage:     waitStage,
+					},
+				},
+			},
+		}, f.InFlight)
+		if recovery != nil {
+			return errors.Wrapf(err, "recover frame semaphore and fence: %v", recovery)
+		}
+		return err
+	}
+	return nil
+}
+
+// FrameContext cycles through a fixed number of frames in flight, keeping
+// the CPU at most that many frames ahead of the GPU.
+type FrameContext struct {
+	Frames []*Frame
+
+	current int
+}
+
+func NewFrameContext(d *Device, framesInFlight, queueFamily, commandBuffersPerFrame int) (*FrameContext, error) {
+	if framesInFlight < 1 {
+		return nil, errors.New("need at least one frame in flight")
+	}
+
+	fc := FrameContext{
+		Frames:  make([]*Frame, 0, framesInFlight),
+		current: -1,
+	}
+	for t := 0; t < framesInFlight; t++ {
+		frame, err := newFrame(d, t, queueFamily, commandBuffersPerFrame)
+		if err != nil {
+			fc.Destroy()
+			return nil, errors.Wrapf(err, "create frame %d", t)
+		}
+		fc.Frames = append(fc.Frames, frame)
+	}
+
+	return &fc, nil
+}
+
+// Destroy expects the device to be idle.
+func (fc *FrameContext) Destroy() {
+	for _, frame := range fc.Frames {
+		frame.destroy()
+	}
+	fc.Frames = nil
+}
+
+// Begin moves on to the next frame, waiting until the GPU is done with its
+// previous use and resetting its command buffers and descriptor sets.
+func (fc *FrameContext) Begin() (*Frame, error) {
+	fc.current = (fc.current + 1) % len(fc.Frames)
+	frame := fc.Frames[fc.current]
+
+	if err := frame.InFlight.Wait(-1); err != nil {
+		return nil, errors.Wrap(err, "wait for frame")
+	}
+	if err := frame.CommandPool.Reset(false); err != nil {
+		return nil, err
+	}
+	if err := frame.Descriptors.Reset(); err != nil {
+		return nil, err
+	}
+
+	return frame, nil
+}
+
+// Current returns the frame returned by the last Begin.
+func (fc *FrameContext) Current() *Frame {
+	if fc.current < 0 {
+		return nil
+	}
+	return fc.Frames[fc.current]
+}
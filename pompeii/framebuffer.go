@@ -0,0 +1,166 @@
+package pompeii
+
+import (
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+type FramebufferOptions struct {
+	// Swapchain provides the image of SwapchainAttachment, one framebuffer
+	// is created per swapchain image and the extent follows the swapchain.
+	Swapchain           *Swapchain
+	SwapchainAttachment uint32
+	// Extent of offscreen framebuffers, ignored with a swapchain.
+	Extent vk.Extent2D
+}
+
+// Framebuffer owns an image for every render pass attachment that isn't the
+// swapchain's, sized to the framebuffer and recreated along with it.
+type Framebuffer struct {
+	Extent vk.Extent2D
+	// Images holds the owned attachment images, nil at the swapchain
+	// attachment.
+	Images []*Image
+	Views  []*ImageView
+
+	allocator    *Allocator
+	renderPass   *RenderPass
+	options      FramebufferOptions
+	generation   int
+	framebuffers []vk.Framebuffer
+}
+
+func NewFramebuffer(a *Allocator, rp *RenderPass, options FramebufferOptions) (*Framebuffer, error) {
+	fb := Framebuffer{
+		allocator:  a,
+		renderPass: rp,
+		options:    options,
+	}
+	if options.Swapchain != nil && int(options.SwapchainAttachment) >= len(rp.Attachments) {
+		return nil, errors.Errorf("create framebuffer: no attachment %d for the swapchain", options.SwapchainAttachment)
+	}
+
+	extent := options.Extent
+	if options.Swapchain != nil {
+		extent = options.Swapchain.Extent
+		fb.generation = options.Swapchain.Generation()
+	}
+	if err := fb.create(extent); err != nil {
+		fb.Destroy()
+		return nil, err
+	}
+	return &fb, nil
+}
+
+func (fb *Framebuffer) create(extent vk.Extent2D) error {
+	fb.Extent = extent
+	// A suspended swapchain has nothing to render to.
+	if extent.Width == 0 || extent.Height == 0 {
+		return nil
+	}
+
+	attachments := fb.renderPass.Attachments
+	fb.Images = make([]*Image, len(attachments))
+	fb.Views = make([]*ImageView, len(attachments))
+	for t, attachment := range attachments {
+		if fb.options.Swapchain != nil && uint32(t) == fb.options.SwapchainAttachment {
+			continue
+		}
+		image, err := NewImage(fb.allocator, ImageOptions{
+			Format:  attachment.Format,
+			Width:   extent.Width,
+			Height:  extent.Height,
+			Samples: attachment.Samples,
+			Usage:   fb.renderPass.Usage[t],
+		})
+		if err != nil {
+			return errors.Wrapf(err, "create framebuffer attachment %d", t)
+		}
+		fb.Images[t] = image
+		if fb.Views[t], err = image.NewView(); err != nil {
+			return errors.Wrapf(err, "create framebuffer attachment %d", t)
+		}
+	}
+
+	count := 1
+	if fb.options.Swapchain != nil {
+		count = len(fb.options.Swapchain.ImageViews)
+	}
+	views := make([]vk.ImageView, len(attachments))
+	for t, view := range fb.Views {
+		if view != nil {
+			views[t] = view.Handle()
+		}
+	}
+	for t := 0; t < count; t++ {
+		if fb.options.Swapchain != nil {
+			views[fb.options.SwapchainAttachment] = fb.options.Swapchain.ImageViews[t]
+		}
+		framebufferCreateInfo := vk.FramebufferCreateInfo{
+			SType:           vk.StructureTypeFramebufferCreateInfo,
+			RenderPass:      fb.renderPass.Handle(),
+			AttachmentCount: uint32(len(views)),
+			PAttachments:    views,
+			Width:           extent.Width,
+			Height:          extent.Height,
+			Layers:          1,
+		}
+		var framebuffer vk.Framebuffer
+		if result := vk.CreateFramebuffer(fb.renderPass.logicalDevice, &framebufferCreateInfo, nil, &framebuffer); result != vk.Success {
+			return errors.Wrap(vk.Error(result), "create framebuffer")
+		}
+		fb.framebuffers = append(fb.framebuffers, framebuffer)
+	}
+	return nil
+}
+
+func (fb *Framebuffer) Destroy() {
+	for _, framebuffer := range fb.framebuffers {
+		vk.DestroyFramebuffer(fb.renderPass.logicalDevice, framebuffer, nil)
+	}
+	fb.framebuffers = nil
+	for t := range fb.Views {
+		if fb.Views[t] != nil {
+			fb.Views[t].Destroy()
+		}
+		if fb.Images[t] != nil {
+			fb.Images[t].Destroy()
+		}
+	}
+	fb.Views = nil
+	fb.Images = nil
+}
+
+// Update rebuilds the framebuffer after its swapchain was recreated and
+// reports whether it did. Call it after acquiring an image.
+func (fb *Framebuffer) Update() (bool, error) {
+	sc := fb.options.Swapchain
+	if sc == nil || sc.Generation() == fb.generation {
+		return false, nil
+	}
+	fb.Destroy()
+	fb.generation = sc.Generation()
+	return true, fb.create(sc.Extent)
+}
+
+// Resize rebuilds an offscreen framebuffer and its images when extent
+// differs from the current one.
+func (fb *Framebuffer) Resize(extent vk.Extent2D) error {
+	if fb.options.Swapchain != nil {
+		return errors.New("resize framebuffer: extent follows the swapchain")
+	}
+	if extent == fb.Extent {
+		return nil
+	}
+	fb.Destroy()
+	return fb.create(extent)
+}
+
+// Handle returns the framebuffer for swapchain image index, offscreen
+// framebuffers only have index 0.
+func (fb *Framebuffer) Handle(index uint32) vk.Framebuffer {
+	if int(index) >= len(fb.framebuffers) {
+		return vk.NullFramebuffer
+	}
+	return fb.framebuffers[index]
+}
@@ -37,6 +37,7 @@ func (g GPUType) String() string {
 
 type QueueFamily struct {
 	Index    int
+	Count    int
 	Graphics bool
 	Compute  bool
 	Transfer bool
@@ -51,17 +52,37 @@ func (q *QueueFamily) SurfacePresentSupport(surface Surface) bool {
 }
 
 type GPU struct {
-	Name string
-	Type GPUType
-
+	Name   string
+	Type   GPUType
+	Vendor Vendor
+	// DriverName, DriverInfo and ConformanceVersion are empty when the
+	// driver can not report them.
+	DriverName         string
+	DriverInfo         string
+	ConformanceVersion string
+
+	instance   vk.Instance
+	apiVersion uint32
+	// properties2KHR is set when the instance enabled
+	// VK_KHR_get_physical_device_properties2.
+	properties2KHR bool
 	physicalDevice vk.PhysicalDevice
 	props          vk.PhysicalDeviceProperties
 	memProps       vk.PhysicalDeviceMemoryProperties
 	features       vk.PhysicalDeviceFeatures
+	supported      DeviceFeatures
+	// queriedVulkan12 is set when supported holds the Vulkan 1.1 and 1.2
+	// features, queriedTimelineKHR when it only holds the timeline semaphore
+	// one from VK_KHR_timeline_semaphore.
+	queriedVulkan12    bool
+	queriedTimelineKHR bool
 }
 
-func newGPU(physicalDevice vk.PhysicalDevice) GPU {
+func newGPU(instance vk.Instance, apiVersion uint32, properties2KHR bool, physicalDevice vk.PhysicalDevice) GPU {
 	g := GPU{
+		instance:       instance,
+		apiVersion:     apiVersion,
+		properties2KHR: properties2KHR,
 		physicalDevice: physicalDevice,
 	}
 
@@ -75,9 +96,12 @@ func newGPU(physicalDevice vk.PhysicalDevice) GPU {
 
 	vk.GetPhysicalDeviceFeatures(g.physicalDevice, &g.features)
 	g.features.Deref()
+	queryFeatures(&g)
 
-	g.Name = string(g.props.DeviceName[:])
+	g.Name = vk.ToString(g.props.DeviceName[:])
 	g.Type = GPUType(g.props.DeviceType)
+	g.Vendor = Vendor(g.props.VendorID)
+	queryDriverProperties(&g)
 
 	return g
 }
@@ -87,17 +111,17 @@ func (g *GPU) Debug() string {
 
 	buffer.WriteString(fmt.Sprintln("Device Name:", g.Name))
 	buffer.WriteString(fmt.Sprintln("Device Type:", g.Type))
+	buffer.WriteString(fmt.Sprintln("Vendor:", g.Vendor))
 	buffer.WriteString("## Backend\n")
 	buffer.WriteString(fmt.Sprintf("Vulkan v%d.%d.%d\n",
 		(g.props.ApiVersion>>22)&0x3ff,
 		(g.props.ApiVersion>>12)&0x3ff,
 		g.props.ApiVersion&0xfff,
 	))
-	buffer.WriteString(fmt.Sprintf("Driver v%d.%d.%d\n",
-		(g.props.DriverVersion>>22)&0x3ff,
-		(g.props.DriverVersion>>12)&0x3ff,
-		g.props.DriverVersion&0xfff,
-	))
+	buffer.WriteString(fmt.Sprintf("Driver v%s\n", g.DriverVersion()))
+	if g.DriverName != "" {
+		buffer.WriteString(fmt.Sprintf("Driver: %s %s (conformance %s)\n", g.DriverName, g.DriverInfo, g.ConformanceVersion))
+	}
 	buffer.WriteString(fmt.Sprintln("Max Image Dimension:", g.props.Limits.MaxImageDimension2D))
 	buffer.WriteString(fmt.Sprintln("Max Viewports:", g.props.Limits.MaxViewports))
 	buffer.WriteString(fmt.Sprintln("Max Viewport Dimensions:", g.props.Limits.MaxViewportDimensions[0], g.props.Limits.MaxViewportDimensions[1]))
@@ -105,8 +129,78 @@ func (g *GPU) Debug() string {
 	return buffer.String()
 }
 
-func (g *GPU) Match(resWidth, resHeight uint32) bool {
-	return (g.props.Limits.MaxViewportDimensions[0] >= resWidth && g.props.Limits.MaxViewportDimensions[1] >= resHeight)
+// DriverVersion decodes the driver version the way the vendor packs it.
+func (g *GPU) DriverVersion() string {
+	return g.Vendor.DriverVersion(g.props.DriverVersion)
+}
+
+func (g *GPU) Features() vk.PhysicalDeviceFeatures {
+	return g.features
+}
+
+// SupportedFeatures includes the Vulkan 1.1 and 1.2 features when the driver
+// can report them.
+func (g *GPU) SupportedFeatures() DeviceFeatures {
+	return g.supported
+}
+
+func (g *GPU) Limits() vk.PhysicalDeviceLimits {
+	return g.props.Limits
+}
+
+// DeviceLocalMemory sums up the size of all device local heaps.
+func (g *GPU) DeviceLocalMemory() uint64 {
+	var size uint64
+	for t := uint32(0); t < g.memProps.MemoryHeapCount; t++ {
+		heap := g.memProps.MemoryHeaps[t]
+		heap.Deref()
+		if heap.Flags&vk.MemoryHeapFlags(vk.MemoryHeapDeviceLocalBit) != 0 {
+			size += uint64(heap.Size)
+		}
+	}
+	return size
+}
+
+// FormatSupported reports whether format supports features with linear or
+// optimal tiling.
+func (g *GPU) FormatSupported(format vk.Format, linear bool, features vk.FormatFeatureFlagBits) bool {
+	var props vk.FormatProperties
+	vk.GetPhysicalDeviceFormatProperties(g.physicalDevice, format, &props)
+	props.Deref()
+
+	supported := props.OptimalTilingFeatures
+	if linear {
+		supported = props.LinearTilingFeatures
+	}
+	return supported&vk.FormatFeatureFlags(features) == vk.FormatFeatureFlags(features)
+}
+
+func (g *GPU) Extensions() ([]string, error) {
+	var count uint32
+	if result := vk.EnumerateDeviceExtensionProperties(g.physicalDevice, "", &count, nil); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "count device extensions")
+	}
+	extensions := make([]vk.ExtensionProperties, count)
+	if result := vk.EnumerateDeviceExtensionProperties(g.physicalDevice, "", &count, extensions); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "get device extensions")
+	}
+
+	names := make([]string, count)
+	for t, ext := range extensions {
+		ext.Deref()
+		names[t] = vk.ToString(ext.ExtensionName[:])
+	}
+	return names, nil
+}
+
+// apiVersionAtLeast checks the version usable with the GPU, which is capped
+// by the version the instance was created with.
+func (g *GPU) apiVersionAtLeast(major, minor int) bool {
+	version := vk.Version(g.props.ApiVersion)
+	if g.apiVersion < g.props.ApiVersion {
+		version = vk.Version(g.apiVersion)
+	}
+	return version.Major() > major || (version.Major() == major && version.Minor() >= minor)
 }
 
 func (g *GPU) QueueFamilies() ([]QueueFamily, error) {
@@ -125,6 +219,7 @@ func (g *GPU) QueueFamilies() ([]QueueFamily, error) {
 
 		families = append(families, QueueFamily{
 			Index:          i,
+			Count:          int(family.QueueCount),
 			Graphics:       (family.QueueFlags&vk.QueueFlags(vk.QueueGraphicsBit) != 0),
 			Compute:        (family.QueueFlags&vk.QueueFlags(vk.QueueComputeBit) != 0),
 			Transfer:       (family.QueueFlags&vk.QueueFlags(vk.QueueTransferBit) != 0),
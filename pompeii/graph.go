@@ -0,0 +1,133 @@
+package pompeii
+
+import (
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+
+	"github.com/perlw/abyssal_drifter/graph"
+)
+
+// GraphQueueFamilies maps the graph's queues onto the device's, queues the
+// device lacks fall back to graphics.
+func GraphQueueFamilies(d *Device) graph.QueueFamilies {
+	families := graph.QueueFamilies{
+		Graphics: uint32(d.GraphicsIndex),
+		Compute:  uint32(d.GraphicsIndex),
+		Transfer: uint32(d.GraphicsIndex),
+	}
+	if d.ComputeQueue != nil {
+		families.Compute = uint32(d.ComputeQueue.Family)
+	}
+	if d.TransferQueue != nil {
+		families.Transfer = uint32(d.TransferQueue.Family)
+	}
+	return families
+}
+
+// GraphResources backs the resources of a compiled graph. The transient
+// images are created up front, imported resources have to be set before
+// recording barriers that touch them.
+//
+// A plan orders each frame's first access to a transient image after the
+// earlier work on the same queue only. One GraphResources can serve every
+// frame in flight while each transient image stays on a single queue, plans
+// that move them between queues need one per frame of the FrameContext.
+type GraphResources struct {
+	Plan *graph.Plan
+	// Images holds one image per physical image of the plan.
+	Images []*Image
+
+	images  map[graph.Resource]vk.Image
+	buffers map[graph.Resource]vk.Buffer
+}
+
+func NewGraphResources(a *Allocator, plan *graph.Plan) (*GraphResources, error) {
+	r := GraphResources{
+		Plan:    plan,
+		images:  map[graph.Resource]vk.Image{},
+		buffers: map[graph.Resource]vk.Buffer{},
+	}
+	for t, physical := range plan.Images {
+		image, err := NewImage(a, ImageOptions{
+			Format:  vk.Format(physical.Info.Format),
+			Width:   physical.Info.Width,
+			Height:  physical.Info.Height,
+			Samples: vk.SampleCountFlagBits(physical.Info.Samples),
+			Usage:   vk.ImageUsageFlagBits(physical.Usage),
+		})
+		if err != nil {
+			r.Destroy()
+			return nil, errors.Wrapf(err, "create graph image %d", t)
+		}
+		r.Images = append(r.Images, image)
+		for _, resource := range physical.Resources {
+			r.images[resource] = image.Handle()
+		}
+	}
+	return &r, nil
+}
+
+func (r *GraphResources) Destroy() {
+	for _, image := range r.Images {
+		image.Destroy()
+	}
+	r.Images = nil
+}
+
+func (r *GraphResources) ImportImage(resource graph.Resource, image vk.Image) {
+	r.images[resource] = image
+}
+
+func (r *GraphResources) ImportBuffer(resource graph.Resource, buffer vk.Buffer) {
+	r.buffers[resource] = buffer
+}
+
+// Image returns the image backing a transient resource.
+func (r *GraphResources) Image(resource graph.Resource) *Image {
+	if physical, ok := r.Plan.Physical(resource); ok {
+		return r.Images[physical]
+	}
+	return nil
+}
+
+// GraphBarrier records a barrier of a compiled graph, resolving its
+// resources through resources.
+func (c *CommandBuffer) GraphBarrier(b graph.Barrier, resources *GraphResources) {
+	if b.Empty() {
+		return
+	}
+
+	imageBarriers := make([]vk.ImageMemoryBarrier, 0, len(b.Images))
+	for _, barrier := range b.Images {
+		info, _ := resources.Plan.Graph().Image(barrier.Resource)
+		imageBarriers = append(imageBarriers, vk.ImageMemoryBarrier{
+			SType:               vk.StructureTypeImageMemoryBarrier,
+			SrcAccessMask:       vk.AccessFlags(barrier.SrcAccess),
+			DstAccessMask:       vk.AccessFlags(barrier.DstAccess),
+			OldLayout:           vk.ImageLayout(barrier.OldLayout),
+			NewLayout:           vk.ImageLayout(barrier.NewLayout),
+			SrcQueueFamilyIndex: barrier.SrcQueueFamily,
+			DstQueueFamilyIndex: barrier.DstQueueFamily,
+			Image:               resources.images[barrier.Resource],
+			SubresourceRange: vk.ImageSubresourceRange{
+				AspectMask: vk.ImageAspectFlags(FormatAspect(vk.Format(info.Format))),
+				LevelCount: vk.RemainingMipLevels,
+				LayerCount: vk.RemainingArrayLayers,
+			},
+		})
+	}
+	bufferBarriers := make([]vk.BufferMemoryBarrier, 0, len(b.Buffers))
+	for _, barrier := range b.Buffers {
+		bufferBarriers = append(bufferBarriers, vk.BufferMemoryBarrier{
+			SType:               vk.StructureTypeBufferMemoryBarrier,
+			SrcAccessMask:       vk.AccessFlags(barrier.SrcAccess),
+			DstAccessMask:       vk.AccessFlags(barrier.DstAccess),
+			SrcQueueFamilyIndex: barrier.SrcQueueFamily,
+			DstQueueFamilyIndex: barrier.DstQueueFamily,
+			Buffer:              resources.buffers[barrier.Resource],
+			Size:                vk.DeviceSize(vk.WholeSize),
+		})
+	}
+
+	c.Barrier(vk.PipelineStageFlags(b.SrcStages), vk.PipelineStageFlags(b.DstStages), nil, bufferBarriers, imageBarriers)
+}
@@ -0,0 +1,440 @@
+package pompeii
+
+import (
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+type ImageOptions struct {
+	Format        vk.Format
+	Width, Height uint32
+	// MipLevels defaults to 1, use MipLevelCount for a full chain.
+	MipLevels uint32
+	// Layers defaults to 1, cube images need a multiple of 6.
+	Layers uint32
+	Cube   bool
+	// Samples defaults to vk.SampleCount1Bit.
+	Samples vk.SampleCountFlagBits
+	Usage   vk.ImageUsageFlagBits
+	// Linear tiling instead of optimal.
+	Linear bool
+	// Memory defaults to DeviceMemory.
+	Memory *MemoryRequest
+}
+
+// Image tracks the layout it was last transitioned to through Transition,
+// all subresources are assumed to share it.
+type Image struct {
+	Format    vk.Format
+	Extent    vk.Extent2D
+	MipLevels uint32
+	Layers    uint32
+	Cube      bool
+	Samples   vk.SampleCountFlagBits
+	Usage     vk.ImageUsageFlagBits
+	Layout    vk.ImageLayout
+
+	allocator  *Allocator
+	allocation *Allocation
+	image      vk.Image
+}
+
+// MipLevelCount returns the length of a full mip chain down to 1x1.
+func MipLevelCount(width, height uint32) uint32 {
+	levels := uint32(1)
+	for width > 1 || height > 1 {
+		width >>= 1
+		height >>= 1
+		levels++
+	}
+	return levels
+}
+
+func NewImage(a *Allocator, options ImageOptions) (*Image, error) {
+	img := Image{
+		Format:    options.Format,
+		Extent:    vk.Extent2D{Width: options.Width, Height: options.Height},
+		MipLevels: options.MipLevels,
+		Layers:    options.Layers,
+		Cube:      options.Cube,
+		Samples:   options.Samples,
+		Usage:     options.Usage,
+		Layout:    vk.ImageLayoutUndefined,
+		allocator: a,
+	}
+	if img.MipLevels == 0 {
+		img.MipLevels = 1
+	}
+	if img.Layers == 0 {
+		img.Layers = 1
+		if img.Cube {
+			img.Layers = 6
+		}
+	}
+	if img.Samples == 0 {
+		img.Samples = vk.SampleCount1Bit
+	}
+	if img.Cube && img.Layers%6 != 0 {
+		return nil, errors.Errorf("create image: cube image needs a multiple of 6 layers, got %d", img.Layers)
+	}
+	if img.MipLevels > MipLevelCount(options.Width, options.Height) {
+		return nil, errors.Errorf("create image: %d mip levels for %dx%d", img.MipLevels, options.Width, options.Height)
+	}
+
+	var flags vk.ImageCreateFlagBits
+	if img.Cube {
+		flags |= vk.ImageCreateCubeCompatibleBit
+	}
+	tiling := vk.ImageTilingOptimal
+	kind := ResourceOptimal
+	if options.Linear {
+		tiling = vk.ImageTilingLinear
+		kind = ResourceLinear
+	}
+
+	imageCreateInfo := vk.ImageCreateInfo{
+		SType:     vk.StructureTypeImageCreateInfo,
+		Flags:     vk.ImageCreateFlags(flags),
+		ImageType: vk.ImageType2d,
+		Format:    img.Format,
+		Extent: vk.Extent3D{
+			Width:  options.Width,
+			Height: options.Height,
+			Depth:  1,
+		},
+		MipLevels:     img.MipLevels,
+		ArrayLayers:   img.Layers,
+		Samples:       img.Samples,
+		Tiling:        tiling,
+		Usage:         vk.ImageUsageFlags(img.Usage),
+		SharingMode:   vk.SharingModeExclusive,
+		InitialLayout: vk.ImageLayoutUndefined,
+	}
+	if result := vk.CreateImage(a.device.Handle(), &imageCreateInfo, nil, &img.image); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "create image")
+	}
+
+	memory := DeviceMemory
+	if options.Memory != nil {
+		memory = *options.Memory
+	}
+	memory.Kind = kind
+	var err error
+	if img.allocation, err = a.AllocateImage(img.image, memory); err != nil {
+		img.Destroy()
+		return nil, errors.Wrap(err, "create image")
+	}
+
+	return &img, nil
+}
+
+func (img *Image) Destroy() {
+	if img.image != vk.NullImage {
+		vk.DestroyImage(img.allocator.device.Handle(), img.image, nil)
+		img.image = vk.NullImage
+	}
+	if img.allocation != nil {
+		img.allocation.Free()
+		img.allocation = nil
+	}
+}
+
+func (img *Image) Aspect() vk.ImageAspectFlagBits {
+	return FormatAspect(img.Format)
+}
+
+// Range covers every mip level and layer of the image.
+func (img *Image) Range() vk.ImageSubresourceRange {
+	return vk.ImageSubresourceRange{
+		AspectMask: vk.ImageAspectFlags(img.Aspect()),
+		LevelCount: img.MipLevels,
+		LayerCount: img.Layers,
+	}
+}
+
+// MipExtent returns the size of mip level.
+func (img *Image) MipExtent(level uint32) vk.Extent2D {
+	extent := vk.Extent2D{
+		Width:  img.Extent.Width >> level,
+		Height: img.Extent.Height >> level,
+	}
+	if extent.Width == 0 {
+		extent.Width = 1
+	}
+	if extent.Height == 0 {
+		extent.Height = 1
+	}
+	return extent
+}
+
+// Transition records a barrier moving the whole image from its current
+// layout to layout.
+func (img *Image) Transition(cmd *CommandBuffer, layout vk.ImageLayout) {
+	srcStage, dstStage, barrier := TransitionBarrier(img.image, img.Range(), img.Layout, layout)
+	cmd.Barrier(srcStage, dstStage, nil, nil, []vk.ImageMemoryBarrier{barrier})
+	img.Layout = layout
+}
+
+func (img *Image) Allocation() *Allocation {
+	return img.allocation
+}
+
+func (img *Image) Handle() vk.Image {
+	return img.image
+}
+
+type ImageView struct {
+	ViewType vk.ImageViewType
+	Format   vk.Format
+	Range    vk.ImageSubresourceRange
+
+	logicalDevice vk.Device
+	view          vk.ImageView
+}
+
+// NewImageView creates a view of any image, including swapchain images.
+func NewImageView(d *Device, image vk.Image, viewType vk.ImageViewType, format vk.Format, subresources vk.ImageSubresourceRange) (*ImageView, error) {
+	v := ImageView{
+		ViewType:      viewType,
+		Format:        format,
+		Range:         subresources,
+		logicalDevice: d.Handle(),
+	}
+
+	var err error
+	if v.view, err = createImageView(v.logicalDevice, image, viewType, format, subresources); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func createImageView(d vk.Device, image vk.Image, viewType vk.ImageViewType, format vk.Format, subresources vk.ImageSubresourceRange) (vk.ImageView, error) {
+	imageViewCreateInfo := vk.ImageViewCreateInfo{
+		SType:    vk.StructureTypeImageViewCreateInfo,
+		Image:    image,
+		ViewType: viewType,
+		Format:   format,
+		Components: vk.ComponentMapping{
+			R: vk.ComponentSwizzleIdentity,
+			G: vk.ComponentSwizzleIdentity,
+			B: vk.ComponentSwizzleIdentity,
+			A: vk.ComponentSwizzleIdentity,
+		},
+		SubresourceRange: subresources,
+	}
+	var view vk.ImageView
+	if result := vk.CreateImageView(d, &imageViewCreateInfo, nil, &view); result != vk.Success {
+		return vk.NullImageView, errors.Wrap(vk.Error(result), "create image view")
+	}
+	return view, nil
+}
+
+// NewView creates a view of the whole image, as a cube, array or plain 2D
+// view depending on its layers.
+func (img *Image) NewView() (*ImageView, error) {
+	viewType := vk.ImageViewType2d
+	switch {
+	case img.Cube && img.Layers > 6:
+		viewType = vk.ImageViewTypeCubeArray
+	case img.Cube:
+		viewType = vk.ImageViewTypeCube
+	case img.Layers > 1:
+		viewType = vk.ImageViewType2dArray
+	}
+	return NewImageView(img.allocator.device, img.image, viewType, img.Format, img.Range())
+}
+
+func (v *ImageView) Destroy() {
+	if v.view != vk.NullImageView {
+		vk.DestroyImageView(v.logicalDevice, v.view, nil)
+		v.view = vk.NullImageView
+	}
+}
+
+func (v *ImageView) Handle() vk.ImageView {
+	return v.view
+}
+
+// ImageSubresourceData is the tightly packed texel data of one mip level of
+// one layer.
+type ImageSubresourceData struct {
+	MipLevel uint32
+	Layer    uint32
+	Data     []byte
+}
+
+// Upload copies subresources through a staging buffer and leaves the image
+// in ShaderReadOnlyOptimal, ready for sampling. queue has to support
+// graphics, blocks until the upload is done. Formats with both depth and
+// stencil are not supported.
+func (img *Image) Upload(pool *CommandPool, queue *Queue, subresources []ImageSubresourceData) error {
+	// A copy names a single aspect, the data of both would have to be
+	// split up.
+	aspect := img.Aspect()
+	if aspect == vk.ImageAspectDepthBit|vk.ImageAspectStencilBit {
+		return errors.Errorf("upload image: can not upload depth and stencil of %s at once", FormatName(img.Format))
+	}
+	// Buffer offsets have to be a multiple of both the texel block size
+	// and 4.
+	blockSize := uint64(FormatBlockSize(img.Format))
+	if blockSize == 0 {
+		return errors.Errorf("upload image: unknown texel block size of %s", FormatName(img.Format))
+	}
+	offsetAlignment := blockSize * 4 / gcd(blockSize, 4)
+
+	size := uint64(0)
+	for _, subresource := range subresources {
+		if subresource.MipLevel >= img.MipLevels || subresource.Layer >= img.Layers {
+			return errors.Errorf("upload image: no mip level %d of layer %d", subresource.MipLevel, subresource.Layer)
+		}
+		size = alignUp(size, offsetAlignment) + uint64(len(subresource.Data))
+	}
+	if size == 0 {
+		return nil
+	}
+
+	staging, err := NewHostBuffer(img.allocator, size, vk.BufferUsageTransferSrcBit)
+	if err != nil {
+		return errors.Wrap(err, "upload image")
+	}
+	defer staging.Destroy()
+
+	regions := make([]vk.BufferImageCopy, 0, len(subresources))
+	offset := uint64(0)
+	for _, subresource := range subresources {
+		offset = alignUp(offset, offsetAlignment)
+		if err := staging.Write(offset, subresource.Data); err != nil {
+			return errors.Wrap(err, "upload image")
+		}
+
+		extent := img.MipExtent(subresource.MipLevel)
+		regions = append(regions, vk.BufferImageCopy{
+			BufferOffset: vk.DeviceSize(offset),
+			ImageSubresource: vk.ImageSubresourceLayers{
+				AspectMask:     vk.ImageAspectFlags(aspect),
+				MipLevel:       subresource.MipLevel,
+				BaseArrayLayer: subresource.Layer,
+				LayerCount:     1,
+			},
+			ImageExtent: vk.Extent3D{
+				Width:  extent.Width,
+				Height: extent.Height,
+				Depth:  1,
+			},
+		})
+		offset += uint64(len(subresource.Data))
+	}
+
+	layout := img.Layout
+	err = pool.OneTimeSubmit(queue, func(cmd *CommandBuffer) {
+		// Whatever was in the image before is overwritten, skip preserving it.
+		img.Layout = vk.ImageLayoutUndefined
+		img.Transition(cmd, vk.ImageLayoutTransferDstOptimal)
+		cmd.CopyBufferToImage(staging.Handle(), img.image, vk.ImageLayoutTransferDstOptimal, regions...)
+		img.Transition(cmd, vk.ImageLayoutShaderReadOnlyOptimal)
+	})
+	if err != nil {
+		img.Layout = layout
+		return errors.Wrap(err, "upload image")
+	}
+	return nil
+}
+
+// FormatAspect returns the aspects a view of format covers.
+func FormatAspect(format vk.Format) vk.ImageAspectFlagBits {
+	switch format {
+	case vk.FormatD16Unorm, vk.FormatX8D24UnormPack32, vk.FormatD32Sfloat:
+		return vk.ImageAspectDepthBit
+	case vk.FormatS8Uint:
+		return vk.ImageAspectStencilBit
+	case vk.FormatD16UnormS8Uint, vk.FormatD24UnormS8Uint, vk.FormatD32SfloatS8Uint:
+		return vk.ImageAspectDepthBit | vk.ImageAspectStencilBit
+	default:
+		return vk.ImageAspectColorBit
+	}
+}
+
+func IsDepthFormat(format vk.Format) bool {
+	return FormatAspect(format)&vk.ImageAspectDepthBit != 0
+}
+
+func HasStencil(format vk.Format) bool {
+	return FormatAspect(format)&vk.ImageAspectStencilBit != 0
+}
+
+// FindDepthFormat returns the first of candidates usable as an optimally
+// tiled depth/stencil attachment, by default the common depth formats from
+// most to least precise.
+func FindDepthFormat(g *GPU, candidates ...vk.Format) (vk.Format, error) {
+	if len(candidates) == 0 {
+		candidates = []vk.Format{
+			vk.FormatD32Sfloat,
+			vk.FormatD32SfloatS8Uint,
+			vk.FormatD24UnormS8Uint,
+			vk.FormatD16Unorm,
+		}
+	}
+	for _, format := range candidates {
+		if g.FormatSupported(format, false, vk.FormatFeatureDepthStencilAttachmentBit) {
+			return format, nil
+		}
+	}
+	return vk.FormatUndefined, errors.New("no supported depth format")
+}
+
+// layoutUsage maps a layout onto the accesses and stages that typically
+// touch an image in it. src tells whether the layout is being left.
+func layoutUsage(layout vk.ImageLayout, src bool) (vk.AccessFlagBits, vk.PipelineStageFlagBits) {
+	switch layout {
+	case vk.ImageLayoutUndefined:
+		return 0, vk.PipelineStageTopOfPipeBit
+	case vk.ImageLayoutGeneral:
+		return vk.AccessMemoryReadBit | vk.AccessMemoryWriteBit, vk.PipelineStageAllCommandsBit
+	case vk.ImageLayoutColorAttachmentOptimal:
+		return vk.AccessColorAttachmentReadBit | vk.AccessColorAttachmentWriteBit, vk.PipelineStageColorAttachmentOutputBit
+	case vk.ImageLayoutDepthStencilAttachmentOptimal:
+		return vk.AccessDepthStencilAttachmentReadBit | vk.AccessDepthStencilAttachmentWriteBit,
+			vk.PipelineStageEarlyFragmentTestsBit | vk.PipelineStageLateFragmentTestsBit
+	case vk.ImageLayoutDepthStencilReadOnlyOptimal:
+		return vk.AccessDepthStencilAttachmentReadBit | vk.AccessShaderReadBit,
+			vk.PipelineStageEarlyFragmentTestsBit | vk.PipelineStageFragmentShaderBit
+	case vk.ImageLayoutShaderReadOnlyOptimal:
+		return vk.AccessShaderReadBit, vk.PipelineStageVertexShaderBit | vk.PipelineStageFragmentShaderBit | vk.PipelineStageComputeShaderBit
+	case vk.ImageLayoutTransferSrcOptimal:
+		return vk.AccessTransferReadBit, vk.PipelineStageTransferBit
+	case vk.ImageLayoutTransferDstOptimal:
+		return vk.AccessTransferWriteBit, vk.PipelineStageTransferBit
+	case vk.ImageLayoutPreinitialized:
+		return vk.AccessHostWriteBit, vk.PipelineStageHostBit
+	case vk.ImageLayoutPresentSrc:
+		// Presentation is synchronized through semaphores, waiting on
+		// acquire happens at the color output stage.
+		if src {
+			return 0, vk.PipelineStageColorAttachmentOutputBit
+		}
+		return 0, vk.PipelineStageBottomOfPipeBit
+	default:
+		return vk.AccessMemoryReadBit | vk.AccessMemoryWriteBit, vk.PipelineStageAllCommandsBit
+	}
+}
+
+// TransitionBarrier builds the barrier and stages for moving subresources
+// of image from oldLayout to newLayout, for images not wrapped in Image such
+// as the swapchain's.
+func TransitionBarrier(image vk.Image, subresources vk.ImageSubresourceRange, oldLayout, newLayout vk.ImageLayout) (srcStage, dstStage vk.PipelineStageFlags, barrier vk.ImageMemoryBarrier) {
+	srcAccess, src := layoutUsage(oldLayout, true)
+	dstAccess, dst := layoutUsage(newLayout, false)
+
+	barrier = vk.ImageMemoryBarrier{
+		SType:               vk.StructureTypeImageMemoryBarrier,
+		SrcAccessMask:       vk.AccessFlags(srcAccess),
+		DstAccessMask:       vk.AccessFlags(dstAccess),
+		OldLayout:           oldLayout,
+		NewLayout:           newLayout,
+		SrcQueueFamilyIndex: vk.QueueFamilyIgnored,
+		DstQueueFamilyIndex: vk.QueueFamilyIgnored,
+		Image:               image,
+		SubresourceRange:    subresources,
+	}
+	return vk.PipelineStageFlags(src), vk.PipelineStageFlags(dst), barrier
+}
@@ -1,74 +1,182 @@
 package pompeii
 
+/*
+#include "ext.h"
+*/
+import "C"
+
 import (
-	"fmt"
-	"unsafe"
+	"strings"
 
 	"github.com/pkg/errors"
 	vk "github.com/vulkan-go/vulkan"
 )
 
+type InstanceOptions struct {
+	AppName       string
+	AppVersion    uint32
+	EngineName    string
+	EngineVersion uint32
+	// APIVersion is the highest version the application will use, clamped
+	// to what the loader supports. Zero asks for 1.0.
+	APIVersion uint32
+
+	RequiredLayers []string
+	// OptionalLayers are enabled when available.
+	OptionalLayers     []string
+	RequiredExtensions []string
+	// OptionalExtensions are enabled when available.
+	OptionalExtensions []string
+
+	// Validation enables the validation layer when set and installed,
+	// extra checks the layer does not support are left off.
+	Validation *ValidationOptions
+}
+
+// MissingInstanceSupportError lists every required layer and extension that
+// is not available.
+type MissingInstanceSupportError struct {
+	Layers     []string
+	Extensions []string
+}
+
+func (e *MissingInstanceSupportError) Error() string {
+	missing := []string{}
+	if len(e.Layers) > 0 {
+		missing = append(missing, "layers "+strings.Join(e.Layers, ", "))
+	}
+	if len(e.Extensions) > 0 {
+		missing = append(missing, "extensions "+strings.Join(e.Extensions, ", "))
+	}
+	return "instance is missing " + strings.Join(missing, " and ")
+}
+
 type Instance struct {
+	// APIVersion, Layers and Extensions that were actually enabled.
+	APIVersion uint32
+	Layers     []string
+	Extensions []string
+	// ValidationLayer is empty when validation is off, Validation holds the
+	// checks that were enabled.
+	ValidationLayer string
+	Validation      ValidationOptions
+
 	instance vk.Instance
-	dbg      vk.DebugReportCallback
 }
 
-// TODO: Version
-func NewInstance(appName, engineName string, layers, extensions []string) (*Instance, error) {
+// InstanceVersion returns the highest API version the loader supports, 1.0
+// loaders lack vkEnumerateInstanceVersion altogether.
+func InstanceVersion() uint32 {
+	fn := instanceProc(nil, "vkEnumerateInstanceVersion")
+	if fn == nil {
+		return vk.ApiVersion10
+	}
+	var version C.uint32_t
+	if result := vk.Result(C.pompeiiEnumerateInstanceVersion(fn, &version)); result != vk.Success {
+		return vk.ApiVersion10
+	}
+	return uint32(version)
+}
+
+// enableNames picks the required and available optional names, reporting the
+// required ones that are missing.
+func enableNames(available, required, optional []string) (enabled, missing []string) {
+	for _, name := range required {
+		if !inStringSlice(available, name) {
+			missing = append(missing, name)
+		} else if !inStringSlice(enabled, name) {
+			enabled = append(enabled, name)
+		}
+	}
+	for _, name := range optional {
+		if inStringSlice(available, name) && !inStringSlice(enabled, name) {
+			enabled = append(enabled, name)
+		}
+	}
+	return enabled, missing
+}
+
+func NewInstance(options InstanceOptions) (*Instance, error) {
 	i := Instance{
-		dbg: vk.NullDebugReportCallback,
+		APIVersion: options.APIVersion,
+	}
+	if i.APIVersion == 0 {
+		i.APIVersion = vk.ApiVersion10
+	}
+	if supported := InstanceVersion(); i.APIVersion > supported {
+		i.APIVersion = supported
 	}
 
-	activeLayers := []string{}
-	if layers != nil {
+	missing := MissingInstanceSupportError{}
+	if len(options.RequiredLayers) > 0 || len(options.OptionalLayers) > 0 {
 		available, err := getAvailableInstanceLayers()
 		if err != nil {
 			return nil, errors.Wrap(err, "could not get layers")
 		}
-		for _, name := range layers {
-			if inStringSlice(available, name) {
-				activeLayers = append(activeLayers, vkString(name))
-			} else {
-				fmt.Println("missing layer", name)
-			}
-		}
+		i.Layers, missing.Layers = enableNames(available, options.RequiredLayers, options.OptionalLayers)
 	}
-
-	debug := false
-	// activeExtensions := vk.GetRequiredInstanceExtensions()
-	activeExtensions := make([]string, 0, 10)
-	if extensions != nil {
-		available, err := getAvailableInstanceExtensions()
+	if len(options.RequiredExtensions) > 0 || len(options.OptionalExtensions) > 0 {
+		available, err := getAvailableInstanceExtensions("")
 		if err != nil {
 			return nil, errors.Wrap(err, "could not get instance extensions")
 		}
-		for _, name := range extensions {
-			if inStringSlice(available, name) {
-				if name == "VK_EXT_debug_report" {
-					debug = true
+		i.Extensions, missing.Extensions = enableNames(available, options.RequiredExtensions, options.OptionalExtensions)
+	}
+	if len(missing.Layers) > 0 || len(missing.Extensions) > 0 {
+		return nil, &missing
+	}
+
+	var features *validationFeatures
+	if options.Validation != nil {
+		if options.Validation.GPUAssisted && options.Validation.DebugPrintf {
+			return nil, errors.New("create instance: gpu-assisted validation and debug printf are exclusive")
+		}
+		if layer, err := ValidationLayer(); err == nil {
+			i.ValidationLayer = layer
+			if !inStringSlice(i.Layers, layer) {
+				i.Layers = append(i.Layers, layer)
+			}
+			if len(options.Validation.enables()) > 0 {
+				layerExtensions, err := getAvailableInstanceExtensions(layer)
+				if err == nil && inStringSlice(layerExtensions, "VK_EXT_validation_features") {
+					i.Validation = *options.Validation
+					if !inStringSlice(i.Extensions, "VK_EXT_validation_features") {
+						i.Extensions = append(i.Extensions, "VK_EXT_validation_features")
+					}
+					features = newValidationFeatures(i.Validation)
+					defer features.free()
 				}
-				activeExtensions = append(activeExtensions, vkString(name))
-			} else {
-				fmt.Println("missing extension", name)
 			}
 		}
 	}
 
+	activeLayers := make([]string, len(i.Layers))
+	for t, name := range i.Layers {
+		activeLayers[t] = vkString(name)
+	}
+	activeExtensions := make([]string, len(i.Extensions))
+	for t, name := range i.Extensions {
+		activeExtensions[t] = vkString(name)
+	}
+
 	instanceInfo := vk.InstanceCreateInfo{
 		SType: vk.StructureTypeInstanceCreateInfo,
 		PApplicationInfo: &vk.ApplicationInfo{
 			SType:              vk.StructureTypeApplicationInfo,
-			PApplicationName:   vkString(appName),
-			ApplicationVersion: vk.MakeVersion(1, 0, 0),
-			PEngineName:        vkString(engineName),
-			EngineVersion:      vk.MakeVersion(0, 0, 1),
-			ApiVersion:         vk.ApiVersion11,
+			PApplicationName:   vkString(options.AppName),
+			ApplicationVersion: options.AppVersion,
+			PEngineName:        vkString(options.EngineName),
+			EngineVersion:      options.EngineVersion,
+			ApiVersion:         i.APIVersion,
 		},
 		EnabledLayerCount:       uint32(len(activeLayers)),
 		PpEnabledLayerNames:     activeLayers,
 		EnabledExtensionCount:   uint32(len(activeExtensions)),
 		PpEnabledExtensionNames: activeExtensions,
 	}
+	if features != nil {
+		instanceInfo.PNext = features.pointer()
+	}
 
 	if result := vk.CreateInstance(&instanceInfo, nil, &i.instance); result != vk.Success {
 		return nil, errors.Wrap(vk.Error(result), "could not create instance")
@@ -76,46 +184,13 @@ func NewInstance(appName, engineName string, layers, extensions []string) (*Inst
 
 	vk.InitInstance(i.instance)
 
-	fmt.Printf("instance created;\n\tlayers: %v\n\texts: %v\n", activeLayers, activeExtensions)
-
-	// +Debug
-	if debug {
-		debugCreateInfo := vk.DebugReportCallbackCreateInfo{
-			SType:       vk.StructureTypeDebugReportCallbackCreateInfo,
-			Flags:       vk.DebugReportFlags(vk.DebugReportErrorBit | vk.DebugReportWarningBit),
-			PfnCallback: debugReportCallback,
-		}
-		if result := vk.CreateDebugReportCallback(i.instance, &debugCreateInfo, nil, &i.dbg); result != vk.Success {
-			return nil, errors.Wrap(vk.Error(result), "creating debug report")
-		}
-	}
-	// -Debug
-
 	return &i, nil
 }
 
 func (i *Instance) Destroy() {
-	if i.dbg != vk.NullDebugReportCallback {
-		vk.DestroyDebugReportCallback(i.instance, i.dbg, nil)
-	}
-
 	vk.DestroyInstance(i.instance, nil)
 }
 
-func debugReportCallback(flags vk.DebugReportFlags, objectType vk.DebugReportObjectType,
-	object uint64, location uint, messageCode int32, pLayerPrefix string,
-	pMessage string, pUserData unsafe.Pointer) vk.Bool32 {
-	switch {
-	case flags&vk.DebugReportFlags(vk.DebugReportErrorBit) != 0:
-		fmt.Printf("[VK DBG ERR %d] %s on layer %s", messageCode, pMessage, pLayerPrefix)
-	case flags&vk.DebugReportFlags(vk.DebugReportWarningBit) != 0:
-		fmt.Printf("[VK DBG WARN %d] %s on layer %s", messageCode, pMessage, pLayerPrefix)
-	default:
-		fmt.Printf("[VK DBG UNK] unknown debug message %d (layer %s)", messageCode, pLayerPrefix)
-	}
-	return vk.Bool32(vk.False)
-}
-
 func (i *Instance) EnumerateGPUs() ([]GPU, error) {
 	var gpuCount uint32
 	if result := vk.EnumeratePhysicalDevices(i.instance, &gpuCount, nil); result != vk.Success {
@@ -129,14 +204,19 @@ func (i *Instance) EnumerateGPUs() ([]GPU, error) {
 		return nil, errors.Wrap(vk.Error(result), "could not enumerate gpus")
 	}
 
+	properties2KHR := i.HasExtension("VK_KHR_get_physical_device_properties2")
 	gpus := make([]GPU, gpuCount)
 	for t, gpu := range vkGPUs {
-		gpus[t] = newGPU(gpu)
+		gpus[t] = newGPU(i.instance, i.APIVersion, properties2KHR, gpu)
 	}
 
 	return gpus, nil
 }
 
+func (i *Instance) HasExtension(name string) bool {
+	return inStringSlice(i.Extensions, name)
+}
+
 func (i *Instance) Handle() vk.Instance {
 	return i.instance
 }
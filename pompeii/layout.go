@@ -0,0 +1,127 @@
+package pompeii
+
+import (
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+
+	"github.com/perlw/abyssal_drifter/spirv"
+)
+
+type PipelineLayout struct {
+	Description *spirv.PipelineLayout
+	// Sets holds one layout per set, owned by the cache it came from.
+	Sets []*DescriptorSetLayout
+
+	cache         *DescriptorLayoutCache
+	ownsCache     bool
+	logicalDevice vk.Device
+	layout        vk.PipelineLayout
+}
+
+// NewPipelineLayout creates the pipeline layout described, typically by
+// spirv.MergeLayouts. Set layouts come from cache so they can be shared,
+// without one the pipeline layout keeps its own.
+func NewPipelineLayout(d *Device, cache *DescriptorLayoutCache, description *spirv.PipelineLayout) (*PipelineLayout, error) {
+	l := PipelineLayout{
+		Description:   description,
+		cache:         cache,
+		logicalDevice: d.Handle(),
+	}
+	if l.cache == nil {
+		l.cache = NewDescriptorLayoutCache(d)
+		l.ownsCache = true
+	}
+
+	setLayouts := make([]vk.DescriptorSetLayout, len(description.Sets))
+	for t, set := range description.Sets {
+		bindings := make([]DescriptorBinding, len(set.Bindings))
+		for i, binding := range set.Bindings {
+			if binding.Count == 0 {
+				l.Destroy()
+				return nil, errors.Errorf("create pipeline layout: set %d binding %d is a runtime array", set.Set, binding.Binding)
+			}
+			bindings[i] = DescriptorBinding{
+				Binding: binding.Binding,
+				Type:    vk.DescriptorType(binding.Type),
+				Count:   binding.Count,
+				Stages:  vk.ShaderStageFlagBits(binding.Stages),
+			}
+		}
+
+		setLayout, err := l.cache.Get(bindings...)
+		if err != nil {
+			l.Destroy()
+			return nil, errors.Wrapf(err, "create pipeline layout set %d", set.Set)
+		}
+		l.Sets = append(l.Sets, setLayout)
+		setLayouts[t] = setLayout.Handle()
+	}
+
+	pushConstantRanges := make([]vk.PushConstantRange, len(description.PushConstants))
+	for t, r := range description.PushConstants {
+		pushConstantRanges[t] = vk.PushConstantRange{
+			StageFlags: vk.ShaderStageFlags(r.Stages),
+			Offset:     r.Offset,
+			Size:       r.Size,
+		}
+	}
+
+	layoutCreateInfo := vk.PipelineLayoutCreateInfo{
+		SType:                  vk.StructureTypePipelineLayoutCreateInfo,
+		SetLayoutCount:         uint32(len(setLayouts)),
+		PSetLayouts:            setLayouts,
+		PushConstantRangeCount: uint32(len(pushConstantRanges)),
+		PPushConstantRanges:    pushConstantRanges,
+	}
+	if result := vk.CreatePipelineLayout(l.logicalDevice, &layoutCreateInfo, nil, &l.layout); result != vk.Success {
+		l.Destroy()
+		return nil, errors.Wrap(vk.Error(result), "create pipeline layout")
+	}
+
+	return &l, nil
+}
+
+// NewReflectedPipelineLayout derives the layout from the shader stages it
+// will be used with.
+func NewReflectedPipelineLayout(d *Device, cache *DescriptorLayoutCache, stages ...*ShaderModule) (*PipelineLayout, error) {
+	modules := make([]*spirv.Module, len(stages))
+	for t, stage := range stages {
+		var err error
+		if modules[t], err = stage.Reflect(); err != nil {
+			return nil, errors.Wrap(err, "reflect pipeline layout")
+		}
+	}
+	description, err := spirv.MergeLayouts(modules...)
+	if err != nil {
+		return nil, errors.Wrap(err, "reflect pipeline layout")
+	}
+	return NewPipelineLayout(d, cache, description)
+}
+
+func (l *PipelineLayout) Destroy() {
+	if l.layout != vk.NullPipelineLayout {
+		vk.DestroyPipelineLayout(l.logicalDevice, l.layout, nil)
+		l.layout = vk.NullPipelineLayout
+	}
+	if l.ownsCache {
+		l.cache.Destroy()
+	}
+	l.Sets = nil
+}
+
+// Allocate allocates a set for the layout's set index from a.
+func (l *PipelineLayout) Allocate(a *DescriptorAllocator, set int) (*DescriptorSet, error) {
+	if set < 0 || set >= len(l.Sets) {
+		return nil, errors.Errorf("allocate descriptor set: pipeline layout has no set %d", set)
+	}
+	return a.Allocate(l.Sets[set])
+}
+
+// Bind binds sets starting at firstSet for the pipelines of bindPoint.
+func (l *PipelineLayout) Bind(cmd *CommandBuffer, bindPoint vk.PipelineBindPoint, firstSet uint32, sets []*DescriptorSet, dynamicOffsets ...uint32) {
+	cmd.BindDescriptorSets(bindPoint, l.layout, firstSet, DescriptorSetHandles(sets...), dynamicOffsets)
+}
+
+func (l *PipelineLayout) Handle() vk.PipelineLayout {
+	return l.layout
+}
@@ -0,0 +1,528 @@
+package pompeii
+
+import (
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+
+	"github.com/perlw/abyssal_drifter/spirv"
+)
+
+const (
+	maxVertexBindings   = 8
+	maxVertexAttributes = 16
+	maxColorAttachments = 8
+)
+
+type BlendMode int
+
+const (
+	BlendOpaque BlendMode = iota
+	// BlendAlpha is classic straight alpha blending.
+	BlendAlpha
+	// BlendPremultiplied expects colors premultiplied by alpha.
+	BlendPremultiplied
+	BlendAdditive
+)
+
+// DynamicStates is a set of the core vk.DynamicState values.
+type DynamicStates uint32
+
+// Dynamic builds a DynamicStates set.
+func Dynamic(states ...vk.DynamicState) DynamicStates {
+	var set DynamicStates
+	for _, state := range states {
+		set |= 1 << uint(state)
+	}
+	return set
+}
+
+func (s DynamicStates) states() []vk.DynamicState {
+	states := []vk.DynamicState{}
+	for state := vk.DynamicStateBeginRange; state <= vk.DynamicStateEndRange; state++ {
+		if s&(1<<uint(state)) != 0 {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+func (s DynamicStates) has(state vk.DynamicState) bool {
+	return s&(1<<uint(state)) != 0
+}
+
+type VertexBinding struct {
+	Stride    uint32
+	Instanced bool
+}
+
+type VertexAttribute struct {
+	Location uint32
+	Binding  uint32
+	Format   vk.Format
+	Offset   uint32
+}
+
+// GraphicsPipelineDescription holds everything a graphics pipeline is built
+// from except render pass and layout. It only contains comparable fields, so
+// it can be used as a map key for caching.
+type GraphicsPipelineDescription struct {
+	VertexShader   vk.ShaderModule
+	VertexEntry    string
+	FragmentShader vk.ShaderModule
+	FragmentEntry  string
+
+	VertexBindingCount   int
+	VertexBindings       [maxVertexBindings]VertexBinding
+	VertexAttributeCount int
+	VertexAttributes     [maxVertexAttributes]VertexAttribute
+
+	Topology         vk.PrimitiveTopology
+	PrimitiveRestart bool
+
+	PolygonMode vk.PolygonMode
+	CullMode    vk.CullModeFlagBits
+	FrontFace   vk.FrontFace
+	LineWidth   float32
+	DepthClamp  bool
+
+	Samples vk.SampleCountFlagBits
+
+	DepthTest    bool
+	DepthWrite   bool
+	DepthCompare vk.CompareOp
+
+	ColorAttachmentCount int
+	Blend                [maxColorAttachments]BlendMode
+
+	Dynamic DynamicStates
+	// Viewport is baked into the pipeline unless viewport and scissor are
+	// dynamic.
+	Viewport vk.Extent2D
+}
+
+// GraphicsPipelineBuilder starts out with a single opaque color attachment,
+// back face culling, no depth test and dynamic viewport and scissor. Errors
+// from the builder methods are returned by Build.
+type GraphicsPipelineBuilder struct {
+	Description GraphicsPipelineDescription
+
+	vertexShader *ShaderModule
+	cache        *PipelineCache
+	err          error
+}
+
+func NewGraphicsPipelineBuilder() *GraphicsPipelineBuilder {
+	return &GraphicsPipelineBuilder{
+		Description: GraphicsPipelineDescription{
+			VertexEntry:          "main",
+			FragmentEntry:        "main",
+			Topology:             vk.PrimitiveTopologyTriangleList,
+			PolygonMode:          vk.PolygonModeFill,
+			CullMode:             vk.CullModeBackBit,
+			FrontFace:            vk.FrontFaceCounterClockwise,
+			LineWidth:            1.0,
+			Samples:              vk.SampleCount1Bit,
+			DepthCompare:         vk.CompareOpLessOrEqual,
+			ColorAttachmentCount: 1,
+			Dynamic:              Dynamic(vk.DynamicStateViewport, vk.DynamicStateScissor),
+		},
+	}
+}
+
+func (b *GraphicsPipelineBuilder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Shaders sets the stages, fragment may be nil for depth only pipelines,
+// which also clears the color attachments.
+func (b *GraphicsPipelineBuilder) Shaders(vertex, fragment *ShaderModule) *GraphicsPipelineBuilder {
+	b.vertexShader = vertex
+	b.Description.VertexShader = vertex.Handle()
+	b.Description.FragmentShader = vk.NullShaderModule
+	if fragment != nil {
+		b.Description.FragmentShader = fragment.Handle()
+	} else {
+		b.Blend()
+	}
+	return b
+}
+
+// Cache makes Build go through cache, nil disables caching.
+func (b *GraphicsPipelineBuilder) Cache(cache *PipelineCache) *GraphicsPipelineBuilder {
+	b.cache = cache
+	return b
+}
+
+// EntryPoints overrides the default "main" entry points.
+func (b *GraphicsPipelineBuilder) EntryPoints(vertex, fragment string) *GraphicsPipelineBuilder {
+	b.Description.VertexEntry = vertex
+	b.Description.FragmentEntry = fragment
+	return b
+}
+
+func (b *GraphicsPipelineBuilder) Topology(topology vk.PrimitiveTopology, primitiveRestart bool) *GraphicsPipelineBuilder {
+	b.Description.Topology = topology
+	b.Description.PrimitiveRestart = primitiveRestart
+	return b
+}
+
+func (b *GraphicsPipelineBuilder) CullMode(mode vk.CullModeFlagBits, frontFace vk.FrontFace) *GraphicsPipelineBuilder {
+	b.Description.CullMode = mode
+	b.Description.FrontFace = frontFace
+	return b
+}
+
+func (b *GraphicsPipelineBuilder) PolygonMode(mode vk.PolygonMode, lineWidth float32) *GraphicsPipelineBuilder {
+	b.Description.PolygonMode = mode
+	b.Description.LineWidth = lineWidth
+	return b
+}
+
+func (b *GraphicsPipelineBuilder) Samples(samples vk.SampleCountFlagBits) *GraphicsPipelineBuilder {
+	b.Description.Samples = samples
+	return b
+}
+
+// Blend sets one mode per color attachment, which also sets the number of
+// color attachments.
+func (b *GraphicsPipelineBuilder) Blend(modes ...BlendMode) *GraphicsPipelineBuilder {
+	if len(modes) > maxColorAttachments {
+		b.fail(errors.Errorf("pipeline builder: %d color attachments, at most %d supported", len(modes), maxColorAttachments))
+		return b
+	}
+	b.Description.ColorAttachmentCount = len(modes)
+	b.Description.Blend = [maxColorAttachments]BlendMode{}
+	copy(b.Description.Blend[:], modes)
+	return b
+}
+
+// DepthTest enables depth testing, and writing if write is set.
+func (b *GraphicsPipelineBuilder) DepthTest(write bool, compare vk.CompareOp) *GraphicsPipelineBuilder {
+	b.Description.DepthTest = true
+	b.Description.DepthWrite = write
+	b.Description.DepthCompare = compare
+	return b
+}
+
+// VertexBinding adds the next binding with its attributes, their Binding
+// field is filled in.
+func (b *GraphicsPipelineBuilder) VertexBinding(stride uint32, instanced bool, attributes ...VertexAttribute) *GraphicsPipelineBuilder {
+	d := &b.Description
+	if d.VertexBindingCount == maxVertexBindings || d.VertexAttributeCount+len(attributes) > maxVertexAttributes {
+		b.fail(errors.Errorf("pipeline builder: at most %d vertex bindings and %d attributes supported", maxVertexBindings, maxVertexAttributes))
+		return b
+	}
+
+	binding := uint32(d.VertexBindingCount)
+	d.VertexBindings[binding] = VertexBinding{
+		Stride:    stride,
+		Instanced: instanced,
+	}
+	d.VertexBindingCount++
+	for _, attribute := range attributes {
+		attribute.Binding = binding
+		d.VertexAttributes[d.VertexAttributeCount] = attribute
+		d.VertexAttributeCount++
+	}
+	return b
+}
+
+// VertexInputFromShader adds a single binding with the vertex shader's
+// inputs tightly interleaved in location order. Needs Shaders first.
+func (b *GraphicsPipelineBuilder) VertexInputFromShader() *GraphicsPipelineBuilder {
+	if b.vertexShader == nil {
+		b.fail(errors.New("pipeline builder: no vertex shader to reflect"))
+		return b
+	}
+	module, err := b.vertexShader.Reflect()
+	if err != nil {
+		b.fail(errors.Wrap(err, "pipeline builder"))
+		return b
+	}
+	entryPoint, ok := module.EntryPoint(b.Description.VertexEntry)
+	if !ok {
+		b.fail(errors.Errorf("pipeline builder: no entry point %q", b.Description.VertexEntry))
+		return b
+	}
+	if len(entryPoint.Inputs) == 0 {
+		return b
+	}
+
+	attributes := []VertexAttribute{}
+	stride := uint32(0)
+	for _, input := range entryPoint.Inputs {
+		size := vertexFormatSize(input.Format)
+		if size == 0 {
+			b.fail(errors.Errorf("pipeline builder: unsupported format %d for vertex input %q", input.Format, input.Name))
+			return b
+		}
+		for location := uint32(0); location < input.Locations; location++ {
+			attributes = append(attributes, VertexAttribute{
+				Location: input.Location + location,
+				Format:   vk.Format(input.Format),
+				Offset:   stride,
+			})
+			stride += size
+		}
+	}
+	return b.VertexBinding(stride, false, attributes...)
+}
+
+// vertexFormatSize covers the formats spirv reflection produces.
+func vertexFormatSize(format spirv.Format) uint32 {
+	switch {
+	case format >= 70 && format <= 97:
+		return 2 * ((uint32(format)-70)/7 + 1)
+	case format >= 98 && format <= 109:
+		return 4 * ((uint32(format)-98)/3 + 1)
+	case format >= 110 && format <= 121:
+		return 8 * ((uint32(format)-110)/3 + 1)
+	default:
+		return 0
+	}
+}
+
+// Dynamic replaces the set of dynamic states.
+func (b *GraphicsPipelineBuilder) Dynamic(states DynamicStates) *GraphicsPipelineBuilder {
+	b.Description.Dynamic = states
+	return b
+}
+
+// Viewport bakes a fixed viewport and scissor into the pipeline.
+func (b *GraphicsPipelineBuilder) Viewport(extent vk.Extent2D) *GraphicsPipelineBuilder {
+	b.Description.Viewport = extent
+	return b
+}
+
+func blendAttachment(mode BlendMode) vk.PipelineColorBlendAttachmentState {
+	state := vk.PipelineColorBlendAttachmentState{
+		BlendEnable:         vk.True,
+		SrcColorBlendFactor: vk.BlendFactorSrcAlpha,
+		DstColorBlendFactor: vk.BlendFactorOneMinusSrcAlpha,
+		ColorBlendOp:        vk.BlendOpAdd,
+		SrcAlphaBlendFactor: vk.BlendFactorOne,
+		DstAlphaBlendFactor: vk.BlendFactorOneMinusSrcAlpha,
+		AlphaBlendOp:        vk.BlendOpAdd,
+		ColorWriteMask:      vk.ColorComponentFlags(vk.ColorComponentRBit | vk.ColorComponentGBit | vk.ColorComponentBBit | vk.ColorComponentABit),
+	}
+	switch mode {
+	case BlendOpaque:
+		state.BlendEnable = vk.False
+		state.SrcColorBlendFactor = vk.BlendFactorOne
+		state.DstColorBlendFactor = vk.BlendFactorZero
+		state.DstAlphaBlendFactor = vk.BlendFactorZero
+	case BlendPremultiplied:
+		state.SrcColorBlendFactor = vk.BlendFactorOne
+	case BlendAdditive:
+		state.SrcColorBlendFactor = vk.BlendFactorSrcAlpha
+		state.DstColorBlendFactor = vk.BlendFactorOne
+		state.DstAlphaBlendFactor = vk.BlendFactorOne
+	}
+	return state
+}
+
+func vkBool(value bool) vk.Bool32 {
+	if value {
+		return vk.True
+	}
+	return vk.False
+}
+
+// Build creates the pipeline for subpass of renderPass, whose color
+// attachment count and samples the description has to match.
+func (b *GraphicsPipelineBuilder) Build(d *Device, renderPass *RenderPass, subpass uint32, layout *PipelineLayout) (*Pipeline, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if int(subpass) >= renderPass.Subpasses {
+		return nil, errors.Errorf("build pipeline: render pass has no subpass %d", subpass)
+	}
+	desc := b.Description
+	if desc.VertexShader == vk.NullShaderModule {
+		return nil, errors.New("build pipeline: no vertex shader")
+	}
+	info := renderPass.subpassInfos[subpass]
+	if desc.ColorAttachmentCount != info.colors {
+		return nil, errors.Errorf("build pipeline: %d color attachments, subpass %d has %d", desc.ColorAttachmentCount, subpass, info.colors)
+	}
+	if info.samples != 0 && desc.Samples != info.samples {
+		return nil, errors.Errorf("build pipeline: %d samples, subpass %d has %d", desc.Samples, subpass, info.samples)
+	}
+	baked := !desc.Dynamic.has(vk.DynamicStateViewport) || !desc.Dynamic.has(vk.DynamicStateScissor)
+	if baked && (desc.Viewport.Width == 0 || desc.Viewport.Height == 0) {
+		return nil, errors.New("build pipeline: empty viewport baked in")
+	}
+
+	shaderStageCreateInfos := []vk.PipelineShaderStageCreateInfo{
+		{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  vk.ShaderStageVertexBit,
+			Module: desc.VertexShader,
+			PName:  vkString(desc.VertexEntry),
+		},
+	}
+	if desc.FragmentShader != vk.NullShaderModule {
+		shaderStageCreateInfos = append(shaderStageCreateInfos, vk.PipelineShaderStageCreateInfo{
+			SType:  vk.StructureTypePipelineShaderStageCreateInfo,
+			Stage:  vk.ShaderStageFragmentBit,
+			Module: desc.FragmentShader,
+			PName:  vkString(desc.FragmentEntry),
+		})
+	}
+
+	bindings := make([]vk.VertexInputBindingDescription, desc.VertexBindingCount)
+	for t := range bindings {
+		inputRate := vk.VertexInputRateVertex
+		if desc.VertexBindings[t].Instanced {
+			inputRate = vk.VertexInputRateInstance
+		}
+		bindings[t] = vk.VertexInputBindingDescription{
+			Binding:   uint32(t),
+			Stride:    desc.VertexBindings[t].Stride,
+			InputRate: inputRate,
+		}
+	}
+	attributes := make([]vk.VertexInputAttributeDescription, desc.VertexAttributeCount)
+	for t := range attributes {
+		attribute := desc.VertexAttributes[t]
+		attributes[t] = vk.VertexInputAttributeDescription{
+			Location: attribute.Location,
+			Binding:  attribute.Binding,
+			Format:   attribute.Format,
+			Offset:   attribute.Offset,
+		}
+	}
+	vertexInputStateCreateInfo := vk.PipelineVertexInputStateCreateInfo{
+		SType:                           vk.StructureTypePipelineVertexInputStateCreateInfo,
+		VertexBindingDescriptionCount:   uint32(len(bindings)),
+		PVertexBindingDescriptions:      bindings,
+		VertexAttributeDescriptionCount: uint32(len(attributes)),
+		PVertexAttributeDescriptions:    attributes,
+	}
+
+	inputAssemblyStateCreateInfo := vk.PipelineInputAssemblyStateCreateInfo{
+		SType:                  vk.StructureTypePipelineInputAssemblyStateCreateInfo,
+		Topology:               desc.Topology,
+		PrimitiveRestartEnable: vkBool(desc.PrimitiveRestart),
+	}
+
+	viewportStateCreateInfo := vk.PipelineViewportStateCreateInfo{
+		SType:         vk.StructureTypePipelineViewportStateCreateInfo,
+		ViewportCount: 1,
+		ScissorCount:  1,
+	}
+	if !desc.Dynamic.has(vk.DynamicStateViewport) {
+		viewportStateCreateInfo.PViewports = []vk.Viewport{
+			{
+				Width:    float32(desc.Viewport.Width),
+				Height:   float32(desc.Viewport.Height),
+				MinDepth: 0.0,
+				MaxDepth: 1.0,
+			},
+		}
+	}
+	if !desc.Dynamic.has(vk.DynamicStateScissor) {
+		viewportStateCreateInfo.PScissors = []vk.Rect2D{
+			{
+				Extent: desc.Viewport,
+			},
+		}
+	}
+
+	rasterStateCreateInfo := vk.PipelineRasterizationStateCreateInfo{
+		SType:            vk.StructureTypePipelineRasterizationStateCreateInfo,
+		DepthClampEnable: vkBool(desc.DepthClamp),
+		PolygonMode:      desc.PolygonMode,
+		CullMode:         vk.CullModeFlags(desc.CullMode),
+		FrontFace:        desc.FrontFace,
+		LineWidth:        desc.LineWidth,
+	}
+
+	multisampleStateCreateInfo := vk.PipelineMultisampleStateCreateInfo{
+		SType:                vk.StructureTypePipelineMultisampleStateCreateInfo,
+		RasterizationSamples: desc.Samples,
+		MinSampleShading:     1.0,
+	}
+
+	depthStencilStateCreateInfo := vk.PipelineDepthStencilStateCreateInfo{
+		SType:            vk.StructureTypePipelineDepthStencilStateCreateInfo,
+		DepthTestEnable:  vkBool(desc.DepthTest),
+		DepthWriteEnable: vkBool(desc.DepthTest && desc.DepthWrite),
+		DepthCompareOp:   desc.DepthCompare,
+		MaxDepthBounds:   1.0,
+	}
+
+	blendAttachments := make([]vk.PipelineColorBlendAttachmentState, desc.ColorAttachmentCount)
+	for t := range blendAttachments {
+		blendAttachments[t] = blendAttachment(desc.Blend[t])
+	}
+	colorBlendStateCreateInfo := vk.PipelineColorBlendStateCreateInfo{
+		SType:           vk.StructureTypePipelineColorBlendStateCreateInfo,
+		LogicOp:         vk.LogicOpCopy,
+		AttachmentCount: uint32(len(blendAttachments)),
+		PAttachments:    blendAttachments,
+	}
+
+	dynamicStates := desc.Dynamic.states()
+	dynamicStateCreateInfo := vk.PipelineDynamicStateCreateInfo{
+		SType:             vk.StructureTypePipelineDynamicStateCreateInfo,
+		DynamicStateCount: uint32(len(dynamicStates)),
+		PDynamicStates:    dynamicStates,
+	}
+
+	pipelineCreateInfo := []vk.GraphicsPipelineCreateInfo{
+		{
+			SType:               vk.StructureTypeGraphicsPipelineCreateInfo,
+			StageCount:          uint32(len(shaderStageCreateInfos)),
+			PStages:             shaderStageCreateInfos,
+			PVertexInputState:   &vertexInputStateCreateInfo,
+			PInputAssemblyState: &inputAssemblyStateCreateInfo,
+			PViewportState:      &viewportStateCreateInfo,
+			PRasterizationState: &rasterStateCreateInfo,
+			PMultisampleState:   &multisampleStateCreateInfo,
+			PDepthStencilState:  &depthStencilStateCreateInfo,
+			PColorBlendState:    &colorBlendStateCreateInfo,
+			PDynamicState:       &dynamicStateCreateInfo,
+			Layout:              layout.Handle(),
+			RenderPass:          renderPass.Handle(),
+			Subpass:             subpass,
+		},
+	}
+
+	p := Pipeline{
+		Description:   desc,
+		Layout:        layout,
+		logicalDevice: d.Handle(),
+	}
+	pipelines := make([]vk.Pipeline, 1)
+	unlock := b.cache.lockShared()
+	result := vk.CreateGraphicsPipelines(p.logicalDevice, b.cache.Handle(), 1, pipelineCreateInfo, nil, pipelines)
+	unlock()
+	if result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "create graphics pipeline")
+	}
+	p.pipeline = pipelines[0]
+
+	return &p, nil
+}
+
+type Pipeline struct {
+	Description GraphicsPipelineDescription
+	Layout      *PipelineLayout
+
+	logicalDevice vk.Device
+	pipeline      vk.Pipeline
+}
+
+func (p *Pipeline) Destroy() {
+	if p.pipeline != vk.NullPipeline {
+		vk.DestroyPipeline(p.logicalDevice, p.pipeline, nil)
+		p.pipeline = vk.NullPipeline
+	}
+}
+
+func (p *Pipeline) Handle() vk.Pipeline {
+	return p.pipeline
+}
@@ -30,13 +30,18 @@ func Init() error {
 	return nil
 }
 
-func getAvailableInstanceExtensions() ([]string, error) {
+// getAvailableInstanceExtensions lists the extensions of the implementation,
+// or those provided by layer if not empty.
+func getAvailableInstanceExtensions(layer string) ([]string, error) {
+	if layer != "" {
+		layer = vkString(layer)
+	}
 	var count uint32
-	if result := vk.EnumerateInstanceExtensionProperties("", &count, nil); result != vk.Success {
+	if result := vk.EnumerateInstanceExtensionProperties(layer, &count, nil); result != vk.Success {
 		return nil, errors.New("could not count instance extensions")
 	}
 	extensions := make([]vk.ExtensionProperties, count)
-	if result := vk.EnumerateInstanceExtensionProperties("", &count, extensions); result != vk.Success {
+	if result := vk.EnumerateInstanceExtensionProperties(layer, &count, extensions); result != vk.Success {
 		return nil, errors.New("could not get instance extensions")
 	}
 
@@ -65,3 +70,13 @@ func getAvailableInstanceLayers() ([]string, error) {
 	}
 	return names, nil
 }
+
+func clampUint32(val, min, max uint32) uint32 {
+	if val < min {
+		return min
+	}
+	if val > max {
+		return max
+	}
+	return val
+}
@@ -0,0 +1,227 @@
+package pompeii
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+type SurfaceCapabilities struct {
+	MinImageCount uint32
+	// MaxImageCount is zero when there is no limit.
+	MaxImageCount uint32
+	// CurrentExtent has a width of vk.MaxUint32 when the surface leaves the
+	// extent up to the swapchain.
+	CurrentExtent  vk.Extent2D
+	MinImageExtent vk.Extent2D
+	MaxImageExtent vk.Extent2D
+
+	MaxImageArrayLayers     uint32
+	SupportedTransforms     vk.SurfaceTransformFlagBits
+	CurrentTransform        vk.SurfaceTransformFlagBits
+	SupportedCompositeAlpha vk.CompositeAlphaFlagBits
+	SupportedUsage          vk.ImageUsageFlagBits
+}
+
+// ClampImageCount fits count into the supported image counts, zero asks for
+// one more than the minimum so acquiring rarely has to wait.
+func (c SurfaceCapabilities) ClampImageCount(count uint32) uint32 {
+	if count == 0 {
+		count = c.MinImageCount + 1
+	}
+	if count < c.MinImageCount {
+		count = c.MinImageCount
+	}
+	if c.MaxImageCount > 0 && count > c.MaxImageCount {
+		count = c.MaxImageCount
+	}
+	return count
+}
+
+// ClampExtent returns the extent the surface dictates, or width and height
+// fitted into the supported extents when it leaves the choice to us.
+func (c SurfaceCapabilities) ClampExtent(width, height uint32) vk.Extent2D {
+	if c.CurrentExtent.Width != vk.MaxUint32 {
+		return c.CurrentExtent
+	}
+	return vk.Extent2D{
+		Width:  clampUint32(width, c.MinImageExtent.Width, c.MaxImageExtent.Width),
+		Height: clampUint32(height, c.MinImageExtent.Height, c.MaxImageExtent.Height),
+	}
+}
+
+type SurfaceFormat struct {
+	Format     vk.Format
+	ColorSpace vk.ColorSpace
+}
+
+func (f SurfaceFormat) String() string {
+	if f.ColorSpace == vk.ColorSpaceSrgbNonlinear {
+		return FormatName(f.Format) + " SRGB_NONLINEAR"
+	}
+	return fmt.Sprintf("%s colorspace %d", FormatName(f.Format), f.ColorSpace)
+}
+
+// DefaultSurfaceFormats prefers sRGB formats, so shaders can write linear
+// colors and have them encoded on store.
+var DefaultSurfaceFormats = []SurfaceFormat{
+	{vk.FormatB8g8r8a8Srgb, vk.ColorSpaceSrgbNonlinear},
+	{vk.FormatR8g8b8a8Srgb, vk.ColorSpaceSrgbNonlinear},
+	{vk.FormatB8g8r8a8Unorm, vk.ColorSpaceSrgbNonlinear},
+	{vk.FormatR8g8b8a8Unorm, vk.ColorSpaceSrgbNonlinear},
+}
+
+// PresentPreference trades tearing against latency when picking a present
+// mode.
+type PresentPreference int
+
+const (
+	// PresentVSync waits for vertical blank, FIFO is always supported.
+	PresentVSync PresentPreference = iota
+	// PresentAdaptive waits for vertical blank unless the frame is late,
+	// which then tears instead of stuttering.
+	PresentAdaptive
+	// PresentLowLatency never tears but replaces queued frames rather than
+	// blocking, falling back to tearing and then to vsync.
+	PresentLowLatency
+	// PresentNoVSync presents immediately and tears, falling back to
+	// mailbox and then to vsync.
+	PresentNoVSync
+)
+
+var presentModeOrder = map[PresentPreference][]vk.PresentMode{
+	PresentVSync:      {vk.PresentModeFifo},
+	PresentAdaptive:   {vk.PresentModeFifoRelaxed, vk.PresentModeFifo},
+	PresentLowLatency: {vk.PresentModeMailbox, vk.PresentModeImmediate, vk.PresentModeFifo},
+	PresentNoVSync:    {vk.PresentModeImmediate, vk.PresentModeMailbox, vk.PresentModeFifo},
+}
+
+func PresentModeName(mode vk.PresentMode) string {
+	switch mode {
+	case vk.PresentModeImmediate:
+		return "Immediate"
+	case vk.PresentModeMailbox:
+		return "Mailbox"
+	case vk.PresentModeFifo:
+		return "FIFO"
+	case vk.PresentModeFifoRelaxed:
+		return "FIFORelaxed"
+	default:
+		return fmt.Sprintf("PresentMode(%d)", mode)
+	}
+}
+
+// SurfaceSupport is what a GPU can do with a surface.
+type SurfaceSupport struct {
+	Capabilities SurfaceCapabilities
+	Formats      []SurfaceFormat
+	PresentModes []vk.PresentMode
+}
+
+// ChooseFormat picks the first of preferred the surface supports, falling
+// back to the first format it lists. Preferring nothing uses
+// DefaultSurfaceFormats.
+func (s *SurfaceSupport) ChooseFormat(preferred []SurfaceFormat) SurfaceFormat {
+	if len(preferred) == 0 {
+		preferred = DefaultSurfaceFormats
+	}
+	// A lone undefined format means anything goes.
+	if len(s.Formats) == 1 && s.Formats[0].Format == vk.FormatUndefined {
+		return preferred[0]
+	}
+	for _, want := range preferred {
+		for _, format := range s.Formats {
+			if format == want {
+				return format
+			}
+		}
+	}
+	return s.Formats[0]
+}
+
+func (s *SurfaceSupport) ChoosePresentMode(preference PresentPreference) vk.PresentMode {
+	for _, want := range presentModeOrder[preference] {
+		for _, mode := range s.PresentModes {
+			if mode == want {
+				return mode
+			}
+		}
+	}
+	return vk.PresentModeFifo
+}
+
+func (g *GPU) SurfaceCapabilities(s Surface) (SurfaceCapabilities, error) {
+	var caps vk.SurfaceCapabilities
+	if result := vk.GetPhysicalDeviceSurfaceCapabilities(g.physicalDevice, s.Handle(), &caps); result != vk.Success {
+		return SurfaceCapabilities{}, errors.Wrap(vk.Error(result), "get surface capabilities")
+	}
+	caps.Deref()
+	caps.CurrentExtent.Deref()
+	caps.MinImageExtent.Deref()
+	caps.MaxImageExtent.Deref()
+
+	return SurfaceCapabilities{
+		MinImageCount:           caps.MinImageCount,
+		MaxImageCount:           caps.MaxImageCount,
+		CurrentExtent:           caps.CurrentExtent,
+		MinImageExtent:          caps.MinImageExtent,
+		MaxImageExtent:          caps.MaxImageExtent,
+		MaxImageArrayLayers:     caps.MaxImageArrayLayers,
+		SupportedTransforms:     vk.SurfaceTransformFlagBits(caps.SupportedTransforms),
+		CurrentTransform:        caps.CurrentTransform,
+		SupportedCompositeAlpha: vk.CompositeAlphaFlagBits(caps.SupportedCompositeAlpha),
+		SupportedUsage:          vk.ImageUsageFlagBits(caps.SupportedUsageFlags),
+	}, nil
+}
+
+func (g *GPU) SurfaceFormats(s Surface) ([]SurfaceFormat, error) {
+	var count uint32
+	if result := vk.GetPhysicalDeviceSurfaceFormats(g.physicalDevice, s.Handle(), &count, nil); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "count surface formats")
+	}
+	if count == 0 {
+		return nil, errors.New("no surface formats")
+	}
+	vkFormats := make([]vk.SurfaceFormat, count)
+	if result := vk.GetPhysicalDeviceSurfaceFormats(g.physicalDevice, s.Handle(), &count, vkFormats); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "get surface formats")
+	}
+
+	formats := make([]SurfaceFormat, count)
+	for t, format := range vkFormats {
+		format.Deref()
+		formats[t] = SurfaceFormat{
+			Format:     format.Format,
+			ColorSpace: format.ColorSpace,
+		}
+	}
+	return formats, nil
+}
+
+func (g *GPU) PresentModes(s Surface) ([]vk.PresentMode, error) {
+	var count uint32
+	if result := vk.GetPhysicalDeviceSurfacePresentModes(g.physicalDevice, s.Handle(), &count, nil); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "count present modes")
+	}
+	modes := make([]vk.PresentMode, count)
+	if result := vk.GetPhysicalDeviceSurfacePresentModes(g.physicalDevice, s.Handle(), &count, modes); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "get present modes")
+	}
+	return modes, nil
+}
+
+func (g *GPU) SurfaceSupport(s Surface) (*SurfaceSupport, error) {
+	var support SurfaceSupport
+	var err error
+	if support.Capabilities, err = g.SurfaceCapabilities(s); err != nil {
+		return nil, err
+	}
+	if support.Formats, err = g.SurfaceFormats(s); err != nil {
+		return nil, err
+	}
+	if support.PresentModes, err = g.PresentModes(s); err != nil {
+		return nil, err
+	}
+	return &support, nil
+}
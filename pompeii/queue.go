@@ -0,0 +1,322 @@
+package pompeii
+
+/*
+#include <stdlib.h>
+#include "ext.h"
+*/
+import "C"
+
+import (
+	"sort"
+	"sync"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+type QueueRequest struct {
+	// Count of queues wanted, at least one is always planned. Capped to what
+	// the family offers.
+	Count int
+	// Priorities per queue, missing entries default to 1.0.
+	Priorities []float32
+}
+
+func (r QueueRequest) count() int {
+	if r.Count < 1 {
+		return 1
+	}
+	return r.Count
+}
+
+func (r QueueRequest) priority(t int) float32 {
+	if t < len(r.Priorities) {
+		return r.Priorities[t]
+	}
+	return 1.0
+}
+
+type QueuePlanOptions struct {
+	// Surface, if set, gets a present queue planned for it.
+	Surface Surface
+
+	Graphics QueueRequest
+	Compute  QueueRequest
+	Transfer QueueRequest
+}
+
+// QueueSlot addresses a single queue within a family.
+type QueueSlot struct {
+	Family int
+	Index  int
+}
+
+// QueuePlan maps every role onto queue family slots. Compute and transfer
+// fall back to the graphics queue when the GPU has no dedicated family for
+// them. Present is Family -1 when no surface was given.
+type QueuePlan struct {
+	Graphics []QueueSlot
+	Present  QueueSlot
+	Compute  []QueueSlot
+	Transfer []QueueSlot
+
+	DedicatedCompute  bool
+	DedicatedTransfer bool
+
+	priorities map[int][]float32
+}
+
+func PlanQueues(families []QueueFamily, options QueuePlanOptions) (*QueuePlan, error) {
+	p := QueuePlan{
+		Present:    QueueSlot{Family: -1},
+		priorities: map[int][]float32{},
+	}
+
+	present := func(family *QueueFamily) bool {
+		return options.Surface != nil && family.SurfacePresentSupport(options.Surface)
+	}
+
+	graphics := -1
+	for t := range families {
+		if !families[t].Graphics {
+			continue
+		}
+		if graphics == -1 || (options.Surface != nil && present(&families[t]) && !present(&families[graphics])) {
+			graphics = t
+		}
+	}
+	if graphics == -1 {
+		return nil, errors.New("no graphics queue family")
+	}
+	p.Graphics = p.allocate(&families[graphics], options.Graphics)
+
+	if options.Surface != nil {
+		if present(&families[graphics]) {
+			p.Present = p.Graphics[0]
+		} else {
+			for t := range families {
+				if present(&families[t]) {
+					p.Present = p.allocate(&families[t], QueueRequest{})[0]
+					break
+				}
+			}
+		}
+		if p.Present.Family == -1 {
+			return nil, errors.New("no queue family can present to surface")
+		}
+	}
+
+	compute := -1
+	for t := range families {
+		if families[t].Compute && !families[t].Graphics {
+			compute = t
+			break
+		}
+	}
+	if compute != -1 {
+		p.DedicatedCompute = true
+		p.Compute = p.allocate(&families[compute], options.Compute)
+	} else {
+		p.Compute = p.Graphics[:1]
+	}
+
+	// Prefer transfer-only families (usually DMA engines), then anything
+	// without graphics that isn't already used for compute.
+	transfer := -1
+	for t := range families {
+		if families[t].Transfer && !families[t].Graphics && !families[t].Compute {
+			transfer = t
+			break
+		}
+	}
+	if transfer == -1 {
+		for t := range families {
+			if families[t].Transfer && !families[t].Graphics && t != compute {
+				transfer = t
+				break
+			}
+		}
+	}
+	if transfer != -1 {
+		p.DedicatedTransfer = true
+		p.Transfer = p.allocate(&families[transfer], options.Transfer)
+	} else {
+		p.Transfer = p.Compute[:1]
+	}
+
+	return &p, nil
+}
+
+// allocate reserves queues in family on top of the ones already planned,
+// reusing the last queue once the family runs out.
+func (p *QueuePlan) allocate(family *QueueFamily, request QueueRequest) []QueueSlot {
+	slots := make([]QueueSlot, 0, request.count())
+	for t := 0; t < request.count(); t++ {
+		index := len(p.priorities[family.Index])
+		if index >= family.Count {
+			slots = append(slots, QueueSlot{Family: family.Index, Index: family.Count - 1})
+			continue
+		}
+		p.priorities[family.Index] = append(p.priorities[family.Index], request.priority(t))
+		slots = append(slots, QueueSlot{Family: family.Index, Index: index})
+	}
+	return slots
+}
+
+// Families lists the unique families used by the plan.
+func (p *QueuePlan) Families() []int {
+	families := make([]int, 0, len(p.priorities))
+	for family := range p.priorities {
+		families = append(families, family)
+	}
+	sort.Ints(families)
+	return families
+}
+
+func (p *QueuePlan) createInfos() []vk.DeviceQueueCreateInfo {
+	infos := []vk.DeviceQueueCreateInfo{}
+	for _, family := range p.Families() {
+		priorities := p.priorities[family]
+		infos = append(infos, vk.DeviceQueueCreateInfo{
+			SType:            vk.StructureTypeDeviceQueueCreateInfo,
+			QueueFamilyIndex: uint32(family),
+			QueueCount:       uint32(len(priorities)),
+			PQueuePriorities: priorities,
+		})
+	}
+	return infos
+}
+
+// Queue serializes access to a vk.Queue, submissions from several goroutines
+// to the same queue are safe.
+type Queue struct {
+	Family int
+	Index  int
+
+	mutex      sync.Mutex
+	queue      vk.Queue
+	debugUtils *debugUtils
+}
+
+func newQueue(d vk.Device, slot QueueSlot, utils *debugUtils) *Queue {
+	q := Queue{
+		Family:     slot.Family,
+		Index:      slot.Index,
+		debugUtils: utils,
+	}
+	vk.GetDeviceQueue(d, uint32(slot.Family), uint32(slot.Index), &q.queue)
+	return &q
+}
+
+// Submit signals fence, if non-nil, once all submits have completed.
+func (q *Queue) Submit(submits []vk.SubmitInfo, fence *Fence) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	vkFence := vk.NullFence
+	if fence != nil {
+		vkFence = fence.Handle()
+	}
+	if result := vk.QueueSubmit(q.queue, uint32(len(submits)), submits, vkFence); result != vk.Success {
+		return errors.Wrap(vk.Error(result), "queue submit")
+	}
+	return nil
+}
+
+type SemaphoreWait struct {
+	Semaphore *Semaphore
+	// Value to wait for, only used for timeline semaphores.
+	Value uint64
+	Stage vk.PipelineStageFlagBits
+}
+
+type SemaphoreSignal struct {
+	Semaphore *Semaphore
+	// Value to signal, only used for timeline semaphores.
+	Value uint64
+}
+
+// SubmitBatch is a single submission, binary and timeline semaphores may be
+// mixed freely.
+type SubmitBatch struct {
+	Waits          []SemaphoreWait
+	CommandBuffers []*CommandBuffer
+	Signals        []SemaphoreSignal
+}
+
+// SubmitBatches is Submit with the timeline semaphore values filled in.
+func (q *Queue) SubmitBatches(batches []SubmitBatch, fence *Fence) error {
+	submits := make([]vk.SubmitInfo, len(batches))
+	for t, batch := range batches {
+		timeline := false
+		submit := vk.SubmitInfo{
+			SType:                vk.StructureTypeSubmitInfo,
+			WaitSemaphoreCount:   uint32(len(batch.Waits)),
+			PWaitSemaphores:      make([]vk.Semaphore, len(batch.Waits)),
+			PWaitDstStageMask:    make([]vk.PipelineStageFlags, len(batch.Waits)),
+			CommandBufferCount:   uint32(len(batch.CommandBuffers)),
+			PCommandBuffers:      commandBufferHandles(batch.CommandBuffers),
+			SignalSemaphoreCount: uint32(len(batch.Signals)),
+			PSignalSemaphores:    make([]vk.Semaphore, len(batch.Signals)),
+		}
+		for w, wait := range batch.Waits {
+			submit.PWaitSemaphores[w] = wait.Semaphore.Handle()
+			submit.PWaitDstStageMask[w] = vk.PipelineStageFlags(wait.Stage)
+			timeline = timeline || wait.Semaphore.Timeline()
+		}
+		for s, signal := range batch.Signals {
+			submit.PSignalSemaphores[s] = signal.Semaphore.Handle()
+			timeline = timeline || signal.Semaphore.Timeline()
+		}
+
+		if timeline {
+			waitValues := newUint64Array(len(batch.Waits))
+			defer waitValues.free()
+			for w, wait := range batch.Waits {
+				waitValues.set(w, wait.Value)
+			}
+			signalValues := newUint64Array(len(batch.Signals))
+			defer signalValues.free()
+			for s, signal := range batch.Signals {
+				signalValues.set(s, signal.Value)
+			}
+
+			timelineInfo := (*C.pompeiiTimelineSemaphoreSubmitInfo)(C.calloc(1, C.sizeof_pompeiiTimelineSemaphoreSubmitInfo))
+			defer C.free(unsafe.Pointer(timelineInfo))
+			timelineInfo.sType = structureTypeTimelineSemaphoreSubmitInfo
+			timelineInfo.waitSemaphoreValueCount = C.uint32_t(len(batch.Waits))
+			timelineInfo.pWaitSemaphoreValues = waitValues.ptr
+			timelineInfo.signalSemaphoreValueCount = C.uint32_t(len(batch.Signals))
+			timelineInfo.pSignalSemaphoreValues = signalValues.ptr
+			submit.PNext = unsafe.Pointer(timelineInfo)
+		}
+
+		submits[t] = submit
+	}
+
+	return q.Submit(submits, fence)
+}
+
+// Present returns the raw result, Suboptimal and ErrorOutOfDate are for the
+// swapchain to deal with.
+func (q *Queue) Present(presentInfo *vk.PresentInfo) vk.Result {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return vk.QueuePresent(q.queue, presentInfo)
+}
+
+func (q *Queue) WaitIdle() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if result := vk.QueueWaitIdle(q.queue); result != vk.Success {
+		return errors.Wrap(vk.Error(result), "queue wait idle")
+	}
+	return nil
+}
+
+func (q *Queue) Handle() vk.Queue {
+	return q.queue
+}
@@ -0,0 +1,329 @@
+package pompeii
+
+import (
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+type subpassAttachments struct {
+	colors       []vk.AttachmentReference
+	resolves     []vk.AttachmentReference
+	inputs       []vk.AttachmentReference
+	depthStencil *vk.AttachmentReference
+}
+
+// subpassInfo is what pipelines built for a subpass have to agree with.
+type subpassInfo struct {
+	colors int
+	// samples of the color and depth attachments, 0 without any.
+	samples vk.SampleCountFlagBits
+}
+
+// RenderPassBuilder describes attachments in the order they are added,
+// subpasses refer to them by that index. Subpass-scoped methods (Depth,
+// Inputs, Resolve) apply to the last added subpass. Errors are returned by
+// Build.
+type RenderPassBuilder struct {
+	attachments  []vk.AttachmentDescription
+	subpasses    []subpassAttachments
+	dependencies []vk.SubpassDependency
+	err          error
+}
+
+func NewRenderPassBuilder() *RenderPassBuilder {
+	return &RenderPassBuilder{}
+}
+
+func (b *RenderPassBuilder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Attachment adds a fully described attachment.
+func (b *RenderPassBuilder) Attachment(description vk.AttachmentDescription) *RenderPassBuilder {
+	b.attachments = append(b.attachments, description)
+	return b
+}
+
+// ColorAttachment adds a color attachment whose previous contents are only
+// kept with vk.AttachmentLoadOpLoad.
+func (b *RenderPassBuilder) ColorAttachment(format vk.Format, samples vk.SampleCountFlagBits, loadOp vk.AttachmentLoadOp, storeOp vk.AttachmentStoreOp, finalLayout vk.ImageLayout) *RenderPassBuilder {
+	initialLayout := vk.ImageLayoutUndefined
+	if loadOp == vk.AttachmentLoadOpLoad {
+		initialLayout = finalLayout
+	}
+	return b.Attachment(vk.AttachmentDescription{
+		Format:         format,
+		Samples:        samples,
+		LoadOp:         loadOp,
+		StoreOp:        storeOp,
+		StencilLoadOp:  vk.AttachmentLoadOpDontCare,
+		StencilStoreOp: vk.AttachmentStoreOpDontCare,
+		InitialLayout:  initialLayout,
+		FinalLayout:    finalLayout,
+	})
+}
+
+// PresentAttachment adds a cleared single sampled color attachment that ends
+// up ready for presentation.
+func (b *RenderPassBuilder) PresentAttachment(format vk.Format) *RenderPassBuilder {
+	return b.ColorAttachment(format, vk.SampleCount1Bit, vk.AttachmentLoadOpClear, vk.AttachmentStoreOpStore, vk.ImageLayoutPresentSrc)
+}
+
+// DepthAttachment adds a cleared depth/stencil attachment, stored only when
+// store is set. The stencil aspect, if any, is treated the same.
+func (b *RenderPassBuilder) DepthAttachment(format vk.Format, samples vk.SampleCountFlagBits, store bool) *RenderPassBuilder {
+	storeOp := vk.AttachmentStoreOpDontCare
+	finalLayout := vk.ImageLayoutDepthStencilAttachmentOptimal
+	if store {
+		storeOp = vk.AttachmentStoreOpStore
+		finalLayout = vk.ImageLayoutDepthStencilReadOnlyOptimal
+	}
+	description := vk.AttachmentDescription{
+		Format:         format,
+		Samples:        samples,
+		LoadOp:         vk.AttachmentLoadOpClear,
+		StoreOp:        storeOp,
+		StencilLoadOp:  vk.AttachmentLoadOpDontCare,
+		StencilStoreOp: vk.AttachmentStoreOpDontCare,
+		InitialLayout:  vk.ImageLayoutUndefined,
+		FinalLayout:    finalLayout,
+	}
+	if HasStencil(format) {
+		description.StencilLoadOp = description.LoadOp
+		description.StencilStoreOp = description.StoreOp
+	}
+	return b.Attachment(description)
+}
+
+func (b *RenderPassBuilder) reference(attachment uint32, layout vk.ImageLayout) vk.AttachmentReference {
+	if attachment != vk.AttachmentUnused && int(attachment) >= len(b.attachments) {
+		b.fail(errors.Errorf("render pass builder: no attachment %d", attachment))
+	}
+	return vk.AttachmentReference{
+		Attachment: attachment,
+		Layout:     layout,
+	}
+}
+
+func (b *RenderPassBuilder) current() *subpassAttachments {
+	if len(b.subpasses) == 0 {
+		b.fail(errors.New("render pass builder: no subpass added"))
+		return &subpassAttachments{}
+	}
+	return &b.subpasses[len(b.subpasses)-1]
+}
+
+// Subpass adds the next graphics subpass writing to colors.
+func (b *RenderPassBuilder) Subpass(colors ...uint32) *RenderPassBuilder {
+	subpass := subpassAttachments{}
+	for _, color := range colors {
+		subpass.colors = append(subpass.colors, b.reference(color, vk.ImageLayoutColorAttachmentOptimal))
+	}
+	b.subpasses = append(b.subpasses, subpass)
+	return b
+}
+
+// Depth sets the depth/stencil attachment of the current subpass, read only
+// if write is not set.
+func (b *RenderPassBuilder) Depth(attachment uint32, write bool) *RenderPassBuilder {
+	layout := vk.ImageLayoutDepthStencilReadOnlyOptimal
+	if write {
+		layout = vk.ImageLayoutDepthStencilAttachmentOptimal
+	}
+	reference := b.reference(attachment, layout)
+	b.current().depthStencil = &reference
+	return b
+}
+
+// Inputs sets the input attachments of the current subpass.
+func (b *RenderPassBuilder) Inputs(attachments ...uint32) *RenderPassBuilder {
+	subpass := b.current()
+	subpass.inputs = nil
+	for _, attachment := range attachments {
+		layout := vk.ImageLayoutShaderReadOnlyOptimal
+		if int(attachment) < len(b.attachments) && IsDepthFormat(b.attachments[attachment].Format) {
+			layout = vk.ImageLayoutDepthStencilReadOnlyOptimal
+		}
+		subpass.inputs = append(subpass.inputs, b.reference(attachment, layout))
+	}
+	return b
+}
+
+// Resolve sets one resolve target per color attachment of the current
+// subpass, vk.AttachmentUnused skips one.
+func (b *RenderPassBuilder) Resolve(attachments ...uint32) *RenderPassBuilder {
+	subpass := b.current()
+	if len(attachments) != len(subpass.colors) {
+		b.fail(errors.Errorf("render pass builder: %d resolve attachments for %d color attachments", len(attachments), len(subpass.colors)))
+		return b
+	}
+	subpass.resolves = nil
+	for _, attachment := range attachments {
+		subpass.resolves = append(subpass.resolves, b.reference(attachment, vk.ImageLayoutColorAttachmentOptimal))
+	}
+	return b
+}
+
+// Dependency adds an execution and memory dependency between subpasses,
+// vk.SubpassExternal stands for what comes before or after the render pass.
+// Dependencies between two subpasses are by region.
+func (b *RenderPassBuilder) Dependency(src, dst uint32, srcStage, dstStage vk.PipelineStageFlagBits, srcAccess, dstAccess vk.AccessFlagBits) *RenderPassBuilder {
+	var flags vk.DependencyFlagBits
+	if src != vk.SubpassExternal && dst != vk.SubpassExternal {
+		flags = vk.DependencyByRegionBit
+	}
+	b.dependencies = append(b.dependencies, vk.SubpassDependency{
+		SrcSubpass:      src,
+		DstSubpass:      dst,
+		SrcStageMask:    vk.PipelineStageFlags(srcStage),
+		DstStageMask:    vk.PipelineStageFlags(dstStage),
+		SrcAccessMask:   vk.AccessFlags(srcAccess),
+		DstAccessMask:   vk.AccessFlags(dstAccess),
+		DependencyFlags: vk.DependencyFlags(flags),
+	})
+	return b
+}
+
+// Build creates the render pass. Without any explicit dependencies the
+// first subpass waits for earlier attachment writes to be available, which
+// also orders it after a swapchain acquire waited on at the color output
+// stage and after the previous frame's writes to a reused depth buffer.
+func (b *RenderPassBuilder) Build(d *Device) (*RenderPass, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.subpasses) == 0 {
+		return nil, errors.New("build render pass: no subpasses")
+	}
+
+	dependencies := b.dependencies
+	if len(dependencies) == 0 {
+		stages := vk.PipelineStageColorAttachmentOutputBit | vk.PipelineStageEarlyFragmentTestsBit | vk.PipelineStageLateFragmentTestsBit
+		dependencies = []vk.SubpassDependency{
+			{
+				SrcSubpass:    vk.SubpassExternal,
+				DstSubpass:    0,
+				SrcStageMask:  vk.PipelineStageFlags(stages),
+				DstStageMask:  vk.PipelineStageFlags(stages),
+				SrcAccessMask: vk.AccessFlags(vk.AccessColorAttachmentWriteBit | vk.AccessDepthStencilAttachmentWriteBit),
+				DstAccessMask: vk.AccessFlags(vk.AccessColorAttachmentWriteBit | vk.AccessDepthStencilAttachmentWriteBit),
+			},
+		}
+	}
+
+	rp := RenderPass{
+		Attachments:   b.attachments,
+		Usage:         make([]vk.ImageUsageFlagBits, len(b.attachments)),
+		Subpasses:     len(b.subpasses),
+		subpassInfos:  make([]subpassInfo, len(b.subpasses)),
+		logicalDevice: d.Handle(),
+	}
+	for t, attachment := range b.attachments {
+		rp.Usage[t] = attachmentUsage(attachment)
+	}
+
+	subpassDescriptions := make([]vk.SubpassDescription, len(b.subpasses))
+	for t, subpass := range b.subpasses {
+		for _, reference := range subpass.colors {
+			rp.use(reference, vk.ImageUsageColorAttachmentBit)
+		}
+		for _, reference := range subpass.resolves {
+			rp.use(reference, vk.ImageUsageColorAttachmentBit)
+		}
+		for _, reference := range subpass.inputs {
+			rp.use(reference, vk.ImageUsageInputAttachmentBit)
+		}
+		if subpass.depthStencil != nil {
+			rp.use(*subpass.depthStencil, vk.ImageUsageDepthStencilAttachmentBit)
+		}
+
+		info := subpassInfo{
+			colors: len(subpass.colors),
+		}
+		rasterized := subpass.colors
+		if subpass.depthStencil != nil {
+			rasterized = append(rasterized[:len(rasterized):len(rasterized)], *subpass.depthStencil)
+		}
+		for _, reference := range rasterized {
+			if reference.Attachment != vk.AttachmentUnused {
+				info.samples = b.attachments[reference.Attachment].Samples
+				break
+			}
+		}
+		rp.subpassInfos[t] = info
+
+		subpassDescriptions[t] = vk.SubpassDescription{
+			PipelineBindPoint:       vk.PipelineBindPointGraphics,
+			InputAttachmentCount:    uint32(len(subpass.inputs)),
+			PInputAttachments:       subpass.inputs,
+			ColorAttachmentCount:    uint32(len(subpass.colors)),
+			PColorAttachments:       subpass.colors,
+			PResolveAttachments:     subpass.resolves,
+			PDepthStencilAttachment: subpass.depthStencil,
+		}
+	}
+
+	renderPassCreateInfo := vk.RenderPassCreateInfo{
+		SType:           vk.StructureTypeRenderPassCreateInfo,
+		AttachmentCount: uint32(len(b.attachments)),
+		PAttachments:    b.attachments,
+		SubpassCount:    uint32(len(subpassDescriptions)),
+		PSubpasses:      subpassDescriptions,
+		DependencyCount: uint32(len(dependencies)),
+		PDependencies:   dependencies,
+	}
+	if result := vk.CreateRenderPass(rp.logicalDevice, &renderPassCreateInfo, nil, &rp.renderPass); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "create render pass")
+	}
+
+	return &rp, nil
+}
+
+// attachmentUsage is what an attachment needs beyond its use in subpasses,
+// judging by the layout it is left in.
+func attachmentUsage(attachment vk.AttachmentDescription) vk.ImageUsageFlagBits {
+	var usage vk.ImageUsageFlagBits
+	switch attachment.FinalLayout {
+	case vk.ImageLayoutShaderReadOnlyOptimal, vk.ImageLayoutDepthStencilReadOnlyOptimal:
+		if attachment.StoreOp == vk.AttachmentStoreOpStore {
+			usage |= vk.ImageUsageSampledBit
+		}
+	case vk.ImageLayoutTransferSrcOptimal:
+		usage |= vk.ImageUsageTransferSrcBit
+	}
+	if attachment.LoadOp != vk.AttachmentLoadOpLoad && attachment.StoreOp == vk.AttachmentStoreOpDontCare &&
+		attachment.StencilLoadOp != vk.AttachmentLoadOpLoad && attachment.StencilStoreOp == vk.AttachmentStoreOpDontCare {
+		usage |= vk.ImageUsageTransientAttachmentBit
+	}
+	return usage
+}
+
+type RenderPass struct {
+	Attachments []vk.AttachmentDescription
+	// Usage is the image usage each attachment needs for this render pass.
+	Usage     []vk.ImageUsageFlagBits
+	Subpasses int
+
+	subpassInfos  []subpassInfo
+	logicalDevice vk.Device
+	renderPass    vk.RenderPass
+}
+
+func (rp *RenderPass) use(reference vk.AttachmentReference, usage vk.ImageUsageFlagBits) {
+	if reference.Attachment != vk.AttachmentUnused {
+		rp.Usage[reference.Attachment] |= usage
+	}
+}
+
+func (rp *RenderPass) Destroy() {
+	if rp.renderPass != vk.NullRenderPass {
+		vk.DestroyRenderPass(rp.logicalDevice, rp.renderPass, nil)
+		rp.renderPass = vk.NullRenderPass
+	}
+}
+
+func (rp *RenderPass) Handle() vk.RenderPass {
+	return rp.renderPass
+}
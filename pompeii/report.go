@@ -0,0 +1,346 @@
+package pompeii
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// ReportField is a named value of a report section.
+type ReportField struct {
+	Name  string
+	Value interface{}
+}
+
+// ReportFields keeps the fields of a Vulkan struct in declaration order,
+// marshalling to a JSON object in that order.
+type ReportFields []ReportField
+
+func (f ReportFields) MarshalJSON() ([]byte, error) {
+	buffer := bytes.Buffer{}
+	buffer.WriteByte('{')
+	for t, field := range f {
+		if t > 0 {
+			buffer.WriteByte(',')
+		}
+		name, err := json.Marshal(field.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "marshal %s", field.Name)
+		}
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+// reportFields collects the exported fields of the struct v, Bool32 fields
+// become bools.
+func reportFields(prefix string, v reflect.Value) ReportFields {
+	fields := ReportFields{}
+	for t := 0; t < v.NumField(); t++ {
+		field := v.Type().Field(t)
+		if field.PkgPath != "" {
+			continue
+		}
+		var value interface{}
+		if field.Type == bool32Type {
+			value = v.Field(t).Uint() != 0
+		} else {
+			value = v.Field(t).Interface()
+		}
+		fields = append(fields, ReportField{
+			Name:  prefix + field.Name,
+			Value: value,
+		})
+	}
+	return fields
+}
+
+type flagName struct {
+	bit  uint32
+	name string
+}
+
+func flagNames(flags uint32, names []flagName) []string {
+	set := []string{}
+	for _, flag := range names {
+		if flags&flag.bit != 0 {
+			set = append(set, flag.name)
+		}
+	}
+	return set
+}
+
+var memoryPropertyNames = []flagName{
+	{uint32(vk.MemoryPropertyDeviceLocalBit), "DeviceLocal"},
+	{uint32(vk.MemoryPropertyHostVisibleBit), "HostVisible"},
+	{uint32(vk.MemoryPropertyHostCoherentBit), "HostCoherent"},
+	{uint32(vk.MemoryPropertyHostCachedBit), "HostCached"},
+	{uint32(vk.MemoryPropertyLazilyAllocatedBit), "LazilyAllocated"},
+	{uint32(vk.MemoryPropertyProtectedBit), "Protected"},
+}
+
+var memoryHeapNames = []flagName{
+	{uint32(vk.MemoryHeapDeviceLocalBit), "DeviceLocal"},
+	{uint32(vk.MemoryHeapMultiInstanceBit), "MultiInstance"},
+}
+
+var queueFlagNames = []flagName{
+	{uint32(vk.QueueGraphicsBit), "Graphics"},
+	{uint32(vk.QueueComputeBit), "Compute"},
+	{uint32(vk.QueueTransferBit), "Transfer"},
+	{uint32(vk.QueueSparseBindingBit), "SparseBinding"},
+	{uint32(vk.QueueProtectedBit), "Protected"},
+}
+
+var formatFeatureNames = []flagName{
+	{uint32(vk.FormatFeatureSampledImageBit), "SampledImage"},
+	{uint32(vk.FormatFeatureStorageImageBit), "StorageImage"},
+	{uint32(vk.FormatFeatureStorageImageAtomicBit), "StorageImageAtomic"},
+	{uint32(vk.FormatFeatureUniformTexelBufferBit), "UniformTexelBuffer"},
+	{uint32(vk.FormatFeatureStorageTexelBufferBit), "StorageTexelBuffer"},
+	{uint32(vk.FormatFeatureStorageTexelBufferAtomicBit), "StorageTexelBufferAtomic"},
+	{uint32(vk.FormatFeatureVertexBufferBit), "VertexBuffer"},
+	{uint32(vk.FormatFeatureColorAttachmentBit), "ColorAttachment"},
+	{uint32(vk.FormatFeatureColorAttachmentBlendBit), "ColorAttachmentBlend"},
+	{uint32(vk.FormatFeatureDepthStencilAttachmentBit), "DepthStencilAttachment"},
+	{uint32(vk.FormatFeatureBlitSrcBit), "BlitSrc"},
+	{uint32(vk.FormatFeatureBlitDstBit), "BlitDst"},
+	{uint32(vk.FormatFeatureSampledImageFilterLinearBit), "SampledImageFilterLinear"},
+	{uint32(vk.FormatFeatureTransferSrcBit), "TransferSrc"},
+	{uint32(vk.FormatFeatureTransferDstBit), "TransferDst"},
+}
+
+type MemoryHeapReport struct {
+	Index int
+	Size  uint64
+	Flags []string
+}
+
+type MemoryTypeReport struct {
+	Index int
+	Heap  int
+	Flags []string
+}
+
+type QueueFamilyReport struct {
+	Index                       int
+	Count                       int
+	Flags                       []string
+	TimestampValidBits          uint32
+	MinImageTransferGranularity [3]uint32
+}
+
+type ExtensionReport struct {
+	Name    string
+	Version uint32
+}
+
+// FormatReport lists the features of a format for each tiling and for
+// buffers.
+type FormatReport struct {
+	Format  string
+	Linear  []string
+	Optimal []string
+	Buffer  []string
+}
+
+// GPUReport is everything the GPU reports about itself, for bug reports and
+// triage. Features include the Vulkan 1.1 and 1.2 ones only when the driver
+// was asked for them, named like DeviceFeatures.Missing does. Through
+// VK_KHR_timeline_semaphore that is Vulkan12.TimelineSemaphore alone.
+type GPUReport struct {
+	Name               string
+	Type               string
+	Vendor             string
+	VendorID           uint32
+	DeviceID           uint32
+	APIVersion         string
+	DriverVersion      string
+	DriverName         string
+	DriverInfo         string
+	ConformanceVersion string
+	PipelineCacheUUID  string
+
+	Limits        ReportFields
+	Sparse        ReportFields
+	Features      ReportFields
+	MemoryHeaps   []MemoryHeapReport
+	MemoryTypes   []MemoryTypeReport
+	QueueFamilies []QueueFamilyReport
+	Extensions    []ExtensionReport
+	// Formats lists the core formats with any support at all.
+	Formats []FormatReport
+}
+
+func (g *GPU) Report() (*GPUReport, error) {
+	r := GPUReport{
+		Name:               g.Name,
+		Type:               g.Type.String(),
+		Vendor:             g.Vendor.String(),
+		VendorID:           g.props.VendorID,
+		DeviceID:           g.props.DeviceID,
+		APIVersion:         vk.Version(g.props.ApiVersion).String(),
+		DriverVersion:      g.DriverVersion(),
+		DriverName:         g.DriverName,
+		DriverInfo:         g.DriverInfo,
+		ConformanceVersion: g.ConformanceVersion,
+		PipelineCacheUUID:  fmt.Sprintf("%x", g.props.PipelineCacheUUID),
+		Limits:             reportFields("", reflect.ValueOf(g.props.Limits)),
+		Sparse:             reportFields("", reflect.ValueOf(g.props.SparseProperties)),
+	}
+
+	r.Features = append(r.Features, reportFields("", reflect.ValueOf(g.supported.Core))...)
+	if g.queriedVulkan12 {
+		r.Features = append(r.Features, reportFields("Vulkan11.", reflect.ValueOf(g.supported.Vulkan11))...)
+		r.Features = append(r.Features, reportFields("Vulkan12.", reflect.ValueOf(g.supported.Vulkan12))...)
+	} else if g.queriedTimelineKHR {
+		r.Features = append(r.Features, ReportField{
+			Name:  "Vulkan12.TimelineSemaphore",
+			Value: g.supported.Vulkan12.TimelineSemaphore != 0,
+		})
+	}
+
+	for t := uint32(0); t < g.memProps.MemoryHeapCount; t++ {
+		heap := g.memProps.MemoryHeaps[t]
+		heap.Deref()
+		r.MemoryHeaps = append(r.MemoryHeaps, MemoryHeapReport{
+			Index: int(t),
+			Size:  uint64(heap.Size),
+			Flags: flagNames(uint32(heap.Flags), memoryHeapNames),
+		})
+	}
+	for t := uint32(0); t < g.memProps.MemoryTypeCount; t++ {
+		memoryType := g.memProps.MemoryTypes[t]
+		memoryType.Deref()
+		r.MemoryTypes = append(r.MemoryTypes, MemoryTypeReport{
+			Index: int(t),
+			Heap:  int(memoryType.HeapIndex),
+			Flags: flagNames(uint32(memoryType.PropertyFlags), memoryPropertyNames),
+		})
+	}
+
+	var queueFamilyCount uint32
+	vk.GetPhysicalDeviceQueueFamilyProperties(g.physicalDevice, &queueFamilyCount, nil)
+	queueFamilies := make([]vk.QueueFamilyProperties, queueFamilyCount)
+	vk.GetPhysicalDeviceQueueFamilyProperties(g.physicalDevice, &queueFamilyCount, queueFamilies)
+	for t, family := range queueFamilies {
+		family.Deref()
+		family.MinImageTransferGranularity.Deref()
+		granularity := family.MinImageTransferGranularity
+		r.QueueFamilies = append(r.QueueFamilies, QueueFamilyReport{
+			Index:                       t,
+			Count:                       int(family.QueueCount),
+			Flags:                       flagNames(uint32(family.QueueFlags), queueFlagNames),
+			TimestampValidBits:          family.TimestampValidBits,
+			MinImageTransferGranularity: [3]uint32{granularity.Width, granularity.Height, granularity.Depth},
+		})
+	}
+
+	var count uint32
+	if result := vk.EnumerateDeviceExtensionProperties(g.physicalDevice, "", &count, nil); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "count device extensions")
+	}
+	extensions := make([]vk.ExtensionProperties, count)
+	if result := vk.EnumerateDeviceExtensionProperties(g.physicalDevice, "", &count, extensions); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "get device extensions")
+	}
+	for _, extension := range extensions {
+		extension.Deref()
+		r.Extensions = append(r.Extensions, ExtensionReport{
+			Name:    vk.ToString(extension.ExtensionName[:]),
+			Version: extension.SpecVersion,
+		})
+	}
+
+	for format := vk.Format(1); format < coreFormatCount; format++ {
+		var props vk.FormatProperties
+		vk.GetPhysicalDeviceFormatProperties(g.physicalDevice, format, &props)
+		props.Deref()
+		if props.LinearTilingFeatures == 0 && props.OptimalTilingFeatures == 0 && props.BufferFeatures == 0 {
+			continue
+		}
+		r.Formats = append(r.Formats, FormatReport{
+			Format:  FormatName(format),
+			Linear:  flagNames(uint32(props.LinearTilingFeatures), formatFeatureNames),
+			Optimal: flagNames(uint32(props.OptimalTilingFeatures), formatFeatureNames),
+			Buffer:  flagNames(uint32(props.BufferFeatures), formatFeatureNames),
+		})
+	}
+
+	return &r, nil
+}
+
+func writeReportFields(buffer *bytes.Buffer, fields ReportFields) {
+	for _, field := range fields {
+		buffer.WriteString(fmt.Sprintf("%s: %v\n", field.Name, field.Value))
+	}
+}
+
+func (r *GPUReport) String() string {
+	buffer := bytes.Buffer{}
+
+	buffer.WriteString(fmt.Sprintf("# %s\n", r.Name))
+	buffer.WriteString(fmt.Sprintf("Type: %s\n", r.Type))
+	buffer.WriteString(fmt.Sprintf("Vendor: %s (0x%04x)\n", r.Vendor, r.VendorID))
+	buffer.WriteString(fmt.Sprintf("Device: 0x%04x\n", r.DeviceID))
+	buffer.WriteString(fmt.Sprintf("Vulkan v%s\n", r.APIVersion))
+	buffer.WriteString(fmt.Sprintf("Driver v%s\n", r.DriverVersion))
+	if r.DriverName != "" {
+		buffer.WriteString(fmt.Sprintf("Driver: %s %s (conformance %s)\n", r.DriverName, r.DriverInfo, r.ConformanceVersion))
+	}
+	buffer.WriteString(fmt.Sprintf("Pipeline cache UUID: %s\n", r.PipelineCacheUUID))
+
+	buffer.WriteString("## Limits\n")
+	writeReportFields(&buffer, r.Limits)
+	buffer.WriteString("## Sparse\n")
+	writeReportFields(&buffer, r.Sparse)
+	buffer.WriteString("## Features\n")
+	writeReportFields(&buffer, r.Features)
+
+	buffer.WriteString("## Memory\n")
+	for _, heap := range r.MemoryHeaps {
+		buffer.WriteString(fmt.Sprintf("Heap %d: %d MiB %s\n", heap.Index, heap.Size>>20, strings.Join(heap.Flags, "|")))
+	}
+	for _, memoryType := range r.MemoryTypes {
+		buffer.WriteString(fmt.Sprintf("Type %d: heap %d %s\n", memoryType.Index, memoryType.Heap, strings.Join(memoryType.Flags, "|")))
+	}
+
+	buffer.WriteString("## Queue families\n")
+	for _, family := range r.QueueFamilies {
+		buffer.WriteString(fmt.Sprintf("Family %d: %d queues %s, timestamp bits %d, transfer granularity %v\n",
+			family.Index, family.Count, strings.Join(family.Flags, "|"), family.TimestampValidBits, family.MinImageTransferGranularity))
+	}
+
+	buffer.WriteString("## Extensions\n")
+	for _, extension := range r.Extensions {
+		buffer.WriteString(fmt.Sprintf("%s v%d\n", extension.Name, extension.Version))
+	}
+
+	buffer.WriteString("## Formats\n")
+	for _, format := range r.Formats {
+		buffer.WriteString(format.Format + "\n")
+		if len(format.Linear) > 0 {
+			buffer.WriteString(fmt.Sprintf("\tlinear: %s\n", strings.Join(format.Linear, "|")))
+		}
+		if len(format.Optimal) > 0 {
+			buffer.WriteString(fmt.Sprintf("\toptimal: %s\n", strings.Join(format.Optimal, "|")))
+		}
+		if len(format.Buffer) > 0 {
+			buffer.WriteString(fmt.Sprintf("\tbuffer: %s\n", strings.Join(format.Buffer, "|")))
+		}
+	}
+
+	return buffer.String()
+}
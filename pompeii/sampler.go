@@ -0,0 +1,96 @@
+package pompeii
+
+import (
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+type SamplerOptions struct {
+	MagFilter   vk.Filter
+	MinFilter   vk.Filter
+	MipmapMode  vk.SamplerMipmapMode
+	AddressMode vk.SamplerAddressMode
+	BorderColor vk.BorderColor
+
+	// MaxAnisotropy above 1 enables anisotropic filtering, clamped to what
+	// the GPU supports. Needs the SamplerAnisotropy feature.
+	MaxAnisotropy float32
+	// MaxLod limits the mip levels used, zero means all of them.
+	MaxLod float32
+	// CompareOp enables depth comparison when not vk.CompareOpNever, for
+	// shadow map samplers.
+	CompareOp vk.CompareOp
+}
+
+var (
+	// LinearSampler filters linearly between texels and mip levels.
+	LinearSampler = SamplerOptions{
+		MagFilter:   vk.FilterLinear,
+		MinFilter:   vk.FilterLinear,
+		MipmapMode:  vk.SamplerMipmapModeLinear,
+		AddressMode: vk.SamplerAddressModeRepeat,
+	}
+	// NearestSampler picks the closest texel, for pixel art and lookups.
+	NearestSampler = SamplerOptions{
+		MagFilter:   vk.FilterNearest,
+		MinFilter:   vk.FilterNearest,
+		MipmapMode:  vk.SamplerMipmapModeNearest,
+		AddressMode: vk.SamplerAddressModeClampToEdge,
+	}
+)
+
+type Sampler struct {
+	logicalDevice vk.Device
+	sampler       vk.Sampler
+}
+
+func NewSampler(d *Device, options SamplerOptions) (*Sampler, error) {
+	s := Sampler{
+		logicalDevice: d.Handle(),
+	}
+
+	samplerCreateInfo := vk.SamplerCreateInfo{
+		SType:        vk.StructureTypeSamplerCreateInfo,
+		MagFilter:    options.MagFilter,
+		MinFilter:    options.MinFilter,
+		MipmapMode:   options.MipmapMode,
+		AddressModeU: options.AddressMode,
+		AddressModeV: options.AddressMode,
+		AddressModeW: options.AddressMode,
+		MaxLod:       options.MaxLod,
+		BorderColor:  options.BorderColor,
+	}
+	if options.MaxLod == 0 {
+		samplerCreateInfo.MaxLod = vk.LodClampNone
+	}
+	if options.MaxAnisotropy > 1 {
+		if d.Features.Core.SamplerAnisotropy != vk.True {
+			return nil, errors.New("create sampler: sampler anisotropy not enabled")
+		}
+		samplerCreateInfo.AnisotropyEnable = vk.True
+		samplerCreateInfo.MaxAnisotropy = options.MaxAnisotropy
+		if max := d.limits.MaxSamplerAnisotropy; samplerCreateInfo.MaxAnisotropy > max {
+			samplerCreateInfo.MaxAnisotropy = max
+		}
+	}
+	if options.CompareOp != vk.CompareOpNever {
+		samplerCreateInfo.CompareEnable = vk.True
+		samplerCreateInfo.CompareOp = options.CompareOp
+	}
+	if result := vk.CreateSampler(d.Handle(), &samplerCreateInfo, nil, &s.sampler); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "create sampler")
+	}
+
+	return &s, nil
+}
+
+func (s *Sampler) Destroy() {
+	if s.sampler != vk.NullSampler {
+		vk.DestroySampler(s.logicalDevice, s.sampler, nil)
+		s.sampler = vk.NullSampler
+	}
+}
+
+func (s *Sampler) Handle() vk.Sampler {
+	return s.sampler
+}
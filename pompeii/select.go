@@ -0,0 +1,187 @@
+package pompeii
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultGPUTypePreference ranks dedicated hardware above everything else.
+var DefaultGPUTypePreference = []GPUType{
+	GPUTypeDiscrete,
+	GPUTypeIntegrated,
+	GPUTypeVirtual,
+	GPUTypeCPU,
+	GPUTypeOther,
+}
+
+// GPUPolicy describes what a usable GPU looks like and how to rank the ones
+// that qualify. The zero value accepts any GPU and prefers discrete ones.
+type GPUPolicy struct {
+	// Types in order of preference, types not listed are still accepted but
+	// rank below all listed ones. Defaults to DefaultGPUTypePreference.
+	PreferredTypes []GPUType
+
+	RequiredExtensions []string
+	// Only the fields set to vk.True are required.
+	RequiredFeatures DeviceFeatures
+
+	MinImageDimension2D uint32
+	MinViewportWidth    uint32
+	MinViewportHeight   uint32
+	// MinDeviceLocalMemory in bytes, summed over all device local heaps.
+	MinDeviceLocalMemory uint64
+
+	// PresentSurface, if set, requires a queue family that can present to it.
+	PresentSurface Surface
+
+	// Override, if set, forces a specific GPU and rejects all others.
+	Override *GPUOverride
+
+	// Check is run last for any additional requirements, a non-nil error
+	// rejects the GPU with the error as reason.
+	Check func(g *GPU) error
+}
+
+// GPUOverride picks a GPU by name, matched case insensitively on a substring
+// of the device name, or by its index in the enumeration when Name is empty.
+type GPUOverride struct {
+	Name  string
+	Index int
+}
+
+type GPUCandidate struct {
+	GPU        *GPU
+	Index      int
+	Score      uint64
+	Rejections []string
+}
+
+func (c GPUCandidate) Rejected() bool {
+	return len(c.Rejections) > 0
+}
+
+func (c GPUCandidate) String() string {
+	if c.Rejected() {
+		return fmt.Sprintf("GPU %d (%s) rejected: %s", c.Index, c.GPU.Name, strings.Join(c.Rejections, "; "))
+	}
+	return fmt.Sprintf("GPU %d (%s) accepted, score %d", c.Index, c.GPU.Name, c.Score)
+}
+
+// RankGPUs scores every GPU against the policy. Accepted GPUs come first,
+// best score first, followed by the rejected ones in enumeration order.
+func RankGPUs(gpus []GPU, policy GPUPolicy) []GPUCandidate {
+	candidates := make([]GPUCandidate, len(gpus))
+	for t := range gpus {
+		candidates[t] = policy.evaluate(&gpus[t], t)
+	}
+
+	sort.SliceStable(candidates, func(a, b int) bool {
+		if candidates[a].Rejected() != candidates[b].Rejected() {
+			return !candidates[a].Rejected()
+		}
+		return candidates[a].Score > candidates[b].Score
+	})
+
+	return candidates
+}
+
+// SelectGPU returns the best GPU according to the policy along with the full
+// ranking, so callers can log why the others were passed over.
+func SelectGPU(gpus []GPU, policy GPUPolicy) (*GPU, []GPUCandidate, error) {
+	candidates := RankGPUs(gpus, policy)
+	if len(candidates) == 0 || candidates[0].Rejected() {
+		return nil, candidates, errors.New("no matching GPU")
+	}
+	return candidates[0].GPU, candidates, nil
+}
+
+func (p GPUPolicy) evaluate(g *GPU, index int) GPUCandidate {
+	c := GPUCandidate{
+		GPU:   g,
+		Index: index,
+	}
+	reject := func(format string, a ...interface{}) {
+		c.Rejections = append(c.Rejections, fmt.Sprintf(format, a...))
+	}
+
+	if o := p.Override; o != nil {
+		if o.Name != "" {
+			if !strings.Contains(strings.ToLower(g.Name), strings.ToLower(o.Name)) {
+				reject("name does not match override %q", o.Name)
+			}
+		} else if o.Index != index {
+			reject("not the override GPU %d", o.Index)
+		}
+	}
+
+	if len(p.RequiredExtensions) > 0 {
+		available, err := g.Extensions()
+		if err != nil {
+			reject("could not get extensions, %s", err.Error())
+		}
+		for _, name := range p.RequiredExtensions {
+			if err == nil && !inStringSlice(available, name) {
+				reject("missing extension %s", name)
+			}
+		}
+	}
+
+	for _, name := range p.RequiredFeatures.Missing(g.supported) {
+		reject("missing feature %s", name)
+	}
+
+	limits := g.props.Limits
+	if limits.MaxImageDimension2D < p.MinImageDimension2D {
+		reject("max image dimension %d < %d", limits.MaxImageDimension2D, p.MinImageDimension2D)
+	}
+	if limits.MaxViewportDimensions[0] < p.MinViewportWidth || limits.MaxViewportDimensions[1] < p.MinViewportHeight {
+		reject("max viewport %dx%d < %dx%d", limits.MaxViewportDimensions[0], limits.MaxViewportDimensions[1], p.MinViewportWidth, p.MinViewportHeight)
+	}
+
+	vram := g.DeviceLocalMemory()
+	if vram < p.MinDeviceLocalMemory {
+		reject("device local memory %d MiB < %d MiB", vram>>20, p.MinDeviceLocalMemory>>20)
+	}
+
+	if p.PresentSurface != nil {
+		families, err := g.QueueFamilies()
+		if err != nil {
+			reject("could not get queue families, %s", err.Error())
+		}
+		present := false
+		for t := range families {
+			if families[t].SurfacePresentSupport(p.PresentSurface) {
+				present = true
+				break
+			}
+		}
+		if err == nil && !present {
+			reject("no queue family can present to surface")
+		}
+	}
+
+	if p.Check != nil {
+		if err := p.Check(g); err != nil {
+			reject("%s", err.Error())
+		}
+	}
+
+	// Type preference dominates, device local memory breaks ties.
+	preferred := p.PreferredTypes
+	if preferred == nil {
+		preferred = DefaultGPUTypePreference
+	}
+	typeRank := uint64(0)
+	for t, gpuType := range preferred {
+		if gpuType == g.Type {
+			typeRank = uint64(len(preferred) - t)
+			break
+		}
+	}
+	c.Score = typeRank<<32 | (vram >> 20)
+
+	return c
+}
@@ -1,18 +1,41 @@
 package pompeii
 
+/*
+#include <stdlib.h>
+#include "ext.h"
+*/
+import "C"
+
 import (
+	"time"
+	"unsafe"
+
 	"github.com/pkg/errors"
 	vk "github.com/vulkan-go/vulkan"
 )
 
+const (
+	structureTypeSemaphoreTypeCreateInfo     = 1000207002
+	structureTypeTimelineSemaphoreSubmitInfo = 1000207003
+	structureTypeSemaphoreWaitInfo           = 1000207004
+	structureTypeSemaphoreSignalInfo         = 1000207005
+	semaphoreTypeTimeline                    = 1
+	semaphoreWaitAnyBit                      = 0x1
+)
+
+// ErrSemaphoreTimeout is returned when a timeline semaphore wait runs out of
+// time.
+var ErrSemaphoreTimeout = errors.New("semaphore wait timed out")
+
 type Semaphore struct {
-	logicalDevice vk.Device
-	semaphore     vk.Semaphore
+	device    *Device
+	semaphore vk.Semaphore
+	timeline  bool
 }
 
 func NewSemaphore(d *Device) (*Semaphore, error) {
 	s := Semaphore{
-		logicalDevice: d.Handle(),
+		device: d,
 	}
 
 	semaphoreCreateInfo := vk.SemaphoreCreateInfo{
@@ -25,12 +48,174 @@ func NewSemaphore(d *Device) (*Semaphore, error) {
 	return &s, nil
 }
 
+// NewTimelineSemaphore needs the Vulkan12.TimelineSemaphore feature enabled
+// on the device.
+func NewTimelineSemaphore(d *Device, initialValue uint64) (*Semaphore, error) {
+	if d.Features.Vulkan12.TimelineSemaphore != vk.True {
+		return nil, errors.New("create timeline semaphore: timeline semaphores not enabled")
+	}
+
+	s := Semaphore{
+		device:   d,
+		timeline: true,
+	}
+
+	typeCreateInfo := (*C.pompeiiSemaphoreTypeCreateInfo)(C.calloc(1, C.sizeof_pompeiiSemaphoreTypeCreateInfo))
+	defer C.free(unsafe.Pointer(typeCreateInfo))
+	typeCreateInfo.sType = structureTypeSemaphoreTypeCreateInfo
+	typeCreateInfo.semaphoreType = semaphoreTypeTimeline
+	typeCreateInfo.initialValue = C.uint64_t(initialValue)
+
+	semaphoreCreateInfo := vk.SemaphoreCreateInfo{
+		SType: vk.StructureTypeSemaphoreCreateInfo,
+		PNext: unsafe.Pointer(typeCreateInfo),
+	}
+	if result := vk.CreateSemaphore(d.Handle(), &semaphoreCreateInfo, nil, &s.semaphore); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "create timeline semaphore")
+	}
+
+	return &s, nil
+}
+
 func (s *Semaphore) Destroy() {
 	if s.semaphore != vk.NullSemaphore {
-		vk.DestroySemaphore(s.logicalDevice, s.semaphore, nil)
+		vk.DestroySemaphore(s.device.Handle(), s.semaphore, nil)
+	}
+}
+
+func (s *Semaphore) Timeline() bool {
+	return s.timeline
+}
+
+// Signal sets the counter of a timeline semaphore from the host.
+func (s *Semaphore) Signal(value uint64) error {
+	if !s.timeline {
+		return errors.New("signal semaphore: not a timeline semaphore")
+	}
+	fn, err := s.device.timelineProc("vkSignalSemaphore")
+	if err != nil {
+		return errors.Wrap(err, "signal semaphore")
+	}
+
+	signalInfo := (*C.pompeiiSemaphoreSignalInfo)(C.calloc(1, C.sizeof_pompeiiSemaphoreSignalInfo))
+	defer C.free(unsafe.Pointer(signalInfo))
+	signalInfo.sType = structureTypeSemaphoreSignalInfo
+	signalInfo.semaphore = C.uint64_t(semaphoreToUint64(s.semaphore))
+	signalInfo.value = C.uint64_t(value)
+
+	if result := vk.Result(C.pompeiiSignalSemaphore(fn, unsafe.Pointer(s.device.Handle()), signalInfo)); result != vk.Success {
+		return errors.Wrap(vk.Error(result), "signal semaphore")
+	}
+	return nil
+}
+
+// Wait blocks until the timeline semaphore reaches value, see WaitSemaphores.
+func (s *Semaphore) Wait(value uint64, timeout time.Duration) error {
+	return WaitSemaphores(s.device, []*Semaphore{s}, []uint64{value}, false, timeout)
+}
+
+func (s *Semaphore) CounterValue() (uint64, error) {
+	if !s.timeline {
+		return 0, errors.New("get semaphore counter: not a timeline semaphore")
+	}
+	fn, err := s.device.timelineProc("vkGetSemaphoreCounterValue")
+	if err != nil {
+		return 0, errors.Wrap(err, "get semaphore counter")
+	}
+
+	var value C.uint64_t
+	if result := vk.Result(C.pompeiiGetSemaphoreCounterValue(fn, unsafe.Pointer(s.device.Handle()), C.uint64_t(semaphoreToUint64(s.semaphore)), &value)); result != vk.Success {
+		return 0, errors.Wrap(vk.Error(result), "get semaphore counter")
 	}
+	return uint64(value), nil
 }
 
 func (s *Semaphore) Handle() vk.Semaphore {
 	return s.semaphore
 }
+
+// WaitSemaphores blocks until the timeline semaphores reach their values, or
+// only one of them if any is set. A negative timeout waits forever.
+func WaitSemaphores(d *Device, semaphores []*Semaphore, values []uint64, any bool, timeout time.Duration) error {
+	if len(semaphores) != len(values) {
+		return errors.New("wait semaphores: need one value per semaphore")
+	}
+	for _, s := range semaphores {
+		if !s.timeline {
+			return errors.New("wait semaphores: not a timeline semaphore")
+		}
+	}
+	fn, err := d.timelineProc("vkWaitSemaphores")
+	if err != nil {
+		return errors.Wrap(err, "wait semaphores")
+	}
+
+	handles := newUint64Array(len(semaphores))
+	defer handles.free()
+	valueArray := newUint64Array(len(values))
+	defer valueArray.free()
+	for t, s := range semaphores {
+		handles.set(t, semaphoreToUint64(s.semaphore))
+		valueArray.set(t, values[t])
+	}
+
+	waitInfo := (*C.pompeiiSemaphoreWaitInfo)(C.calloc(1, C.sizeof_pompeiiSemaphoreWaitInfo))
+	defer C.free(unsafe.Pointer(waitInfo))
+	waitInfo.sType = structureTypeSemaphoreWaitInfo
+	if any {
+		waitInfo.flags = semaphoreWaitAnyBit
+	}
+	waitInfo.semaphoreCount = C.uint32_t(len(semaphores))
+	waitInfo.pSemaphores = handles.ptr
+	waitInfo.pValues = valueArray.ptr
+
+	nanos := vk.MaxUint64
+	if timeout >= 0 {
+		nanos = uint64(timeout.Nanoseconds())
+	}
+
+	switch result := vk.Result(C.pompeiiWaitSemaphores(fn, unsafe.Pointer(d.Handle()), waitInfo, C.uint64_t(nanos))); result {
+	case vk.Success:
+		return nil
+	case vk.Timeout:
+		return ErrSemaphoreTimeout
+	default:
+		return errors.Wrap(vk.Error(result), "wait semaphores")
+	}
+}
+
+// timelineProc loads a timeline semaphore command by its core name on 1.2
+// devices, and by its VK_KHR_timeline_semaphore name before that.
+func (d *Device) timelineProc(name string) (unsafe.Pointer, error) {
+	if !d.vulkan12 {
+		name += "KHR"
+	}
+	return d.proc(name)
+}
+
+// uint64Array is a C allocated array, for value lists referenced from
+// structs that are passed through pNext.
+type uint64Array struct {
+	ptr *C.uint64_t
+	len int
+}
+
+func newUint64Array(n int) uint64Array {
+	if n == 0 {
+		return uint64Array{}
+	}
+	return uint64Array{
+		ptr: (*C.uint64_t)(C.calloc(C.size_t(n), C.sizeof_uint64_t)),
+		len: n,
+	}
+}
+
+func (a uint64Array) set(t int, value uint64) {
+	(*[1 << 26]C.uint64_t)(unsafe.Pointer(a.ptr))[:a.len:a.len][t] = C.uint64_t(value)
+}
+
+func (a uint64Array) free() {
+	if a.ptr != nil {
+		C.free(unsafe.Pointer(a.ptr))
+	}
+}
@@ -0,0 +1,102 @@
+package pompeii
+
+import (
+	"io"
+	"io/fs"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+
+	"github.com/perlw/abyssal_drifter/spirv"
+)
+
+type ShaderModule struct {
+	Header spirv.Header
+
+	logicalDevice vk.Device
+	code          []uint32
+	module        vk.ShaderModule
+}
+
+// NewShaderModule creates a module from words in host order.
+func NewShaderModule(d *Device, code []uint32) (*ShaderModule, error) {
+	header, err := spirv.Validate(code)
+	if err != nil {
+		return nil, errors.Wrap(err, "create shader module")
+	}
+
+	s := ShaderModule{
+		Header:        header,
+		logicalDevice: d.Handle(),
+		code:          code,
+	}
+
+	shaderModuleCreateInfo := vk.ShaderModuleCreateInfo{
+		SType:    vk.StructureTypeShaderModuleCreateInfo,
+		CodeSize: uint(len(code) * 4),
+		PCode:    code,
+	}
+	if result := vk.CreateShaderModule(s.logicalDevice, &shaderModuleCreateInfo, nil, &s.module); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "create shader module")
+	}
+
+	return &s, nil
+}
+
+// NewShaderModuleFromBytes accepts little and big-endian modules.
+func NewShaderModuleFromBytes(d *Device, data []byte) (*ShaderModule, error) {
+	code, err := spirv.Words(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "create shader module")
+	}
+	return NewShaderModule(d, code)
+}
+
+func NewShaderModuleFromReader(d *Device, r io.Reader) (*ShaderModule, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "read shader module")
+	}
+	return NewShaderModuleFromBytes(d, data)
+}
+
+func NewShaderModuleFromFile(d *Device, path string) (*ShaderModule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read shader module")
+	}
+	s, err := NewShaderModuleFromBytes(d, data)
+	return s, errors.Wrap(err, path)
+}
+
+// NewShaderModuleFromFS reads name from fsys, e.g. an embed.FS.
+func NewShaderModuleFromFS(d *Device, fsys fs.FS, name string) (*ShaderModule, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "read shader module")
+	}
+	s, err := NewShaderModuleFromBytes(d, data)
+	return s, errors.Wrap(err, name)
+}
+
+func (s *ShaderModule) Destroy() {
+	if s.module != vk.NullShaderModule {
+		vk.DestroyShaderModule(s.logicalDevice, s.module, nil)
+		s.module = vk.NullShaderModule
+	}
+}
+
+// Code returns the module's words in host order.
+func (s *ShaderModule) Code() []uint32 {
+	return s.code
+}
+
+// Reflect parses the module's entry points and resources.
+func (s *ShaderModule) Reflect() (*spirv.Module, error) {
+	return spirv.Reflect(s.code)
+}
+
+func (s *ShaderModule) Handle() vk.ShaderModule {
+	return s.module
+}
@@ -0,0 +1,253 @@
+package pompeii
+
+// AllocationStrategy decides how a memory block is carved up.
+type AllocationStrategy int
+
+const (
+	// StrategyFreeList keeps a sorted list of free ranges, allocations can be
+	// freed in any order. The default.
+	StrategyFreeList AllocationStrategy = iota
+	// StrategyLinear bumps an offset, freed space is only reclaimed from the
+	// end or once the whole block is empty. Suited for per-frame data.
+	StrategyLinear
+)
+
+func (s AllocationStrategy) String() string {
+	switch s {
+	case StrategyFreeList:
+		return "FreeList"
+	case StrategyLinear:
+		return "Linear"
+	default:
+		return "Unknown"
+	}
+}
+
+// ResourceKind tells buffers and linear images apart from optimally tiled
+// images, which may not share a bufferImageGranularity page.
+type ResourceKind int
+
+const (
+	ResourceLinear ResourceKind = iota
+	ResourceOptimal
+)
+
+// subAllocator hands out ranges of a single block. It only does the
+// bookkeeping, no Vulkan calls.
+type subAllocator interface {
+	alloc(size, alignment uint64, kind ResourceKind) (offset uint64, ok bool)
+	free(offset uint64)
+	used() uint64
+	count() int
+}
+
+func newSubAllocator(strategy AllocationStrategy, size, granularity uint64) subAllocator {
+	if granularity == 0 {
+		granularity = 1
+	}
+	if strategy == StrategyLinear {
+		return &linearAllocator{
+			size:        size,
+			granularity: granularity,
+		}
+	}
+	return &freeListAllocator{
+		size:        size,
+		granularity: granularity,
+		regions: []region{
+			{
+				size: size,
+				free: true,
+			},
+		},
+	}
+}
+
+func alignUp(value, alignment uint64) uint64 {
+	if alignment <= 1 {
+		return value
+	}
+	return (value + alignment - 1) / alignment * alignment
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func alignDown(value, alignment uint64) uint64 {
+	if alignment <= 1 {
+		return value
+	}
+	return value / alignment * alignment
+}
+
+// samePage reports whether the last byte of a range ending at end and the
+// first byte of one starting at start fall into the same granularity page.
+func samePage(end, start, granularity uint64) bool {
+	if end == 0 {
+		return false
+	}
+	return alignDown(end-1, granularity) == alignDown(start, granularity)
+}
+
+type region struct {
+	offset uint64
+	size   uint64
+	free   bool
+	kind   ResourceKind
+}
+
+// freeListAllocator keeps the whole block as a sorted list of regions, free
+// neighbours are merged on free.
+type freeListAllocator struct {
+	size        uint64
+	granularity uint64
+	regions     []region
+	usedBytes   uint64
+	allocations int
+}
+
+func (f *freeListAllocator) alloc(size, alignment uint64, kind ResourceKind) (uint64, bool) {
+	if size == 0 {
+		return 0, false
+	}
+
+	for t, r := range f.regions {
+		if !r.free || r.size < size {
+			continue
+		}
+
+		offset := alignUp(r.offset, alignment)
+		if t > 0 {
+			prev := f.regions[t-1]
+			if !prev.free && prev.kind != kind && samePage(prev.offset+prev.size, offset, f.granularity) {
+				offset = alignUp(offset, f.granularity)
+			}
+		}
+		end := offset + size
+		if end > r.offset+r.size {
+			continue
+		}
+		if t+1 < len(f.regions) {
+			next := f.regions[t+1]
+			if !next.free && next.kind != kind && samePage(end, next.offset, f.granularity) {
+				continue
+			}
+		}
+
+		split := make([]region, 0, 3)
+		if offset > r.offset {
+			split = append(split, region{offset: r.offset, size: offset - r.offset, free: true})
+		}
+		split = append(split, region{offset: offset, size: size, kind: kind})
+		if end < r.offset+r.size {
+			split = append(split, region{offset: end, size: r.offset + r.size - end, free: true})
+		}
+
+		regions := make([]region, 0, len(f.regions)+2)
+		regions = append(regions, f.regions[:t]...)
+		regions = append(regions, split...)
+		regions = append(regions, f.regions[t+1:]...)
+		f.regions = regions
+
+		f.usedBytes += size
+		f.allocations++
+		return offset, true
+	}
+
+	return 0, false
+}
+
+func (f *freeListAllocator) free(offset uint64) {
+	for t := range f.regions {
+		if f.regions[t].offset != offset || f.regions[t].free {
+			continue
+		}
+
+		f.usedBytes -= f.regions[t].size
+		f.allocations--
+		f.regions[t].free = true
+
+		// Merge with the following, then the preceding free region.
+		if t+1 < len(f.regions) && f.regions[t+1].free {
+			f.regions[t].size += f.regions[t+1].size
+			f.regions = append(f.regions[:t+1], f.regions[t+2:]...)
+		}
+		if t > 0 && f.regions[t-1].free {
+			f.regions[t-1].size += f.regions[t].size
+			f.regions = append(f.regions[:t], f.regions[t+1:]...)
+		}
+		return
+	}
+}
+
+func (f *freeListAllocator) used() uint64 {
+	return f.usedBytes
+}
+
+func (f *freeListAllocator) count() int {
+	return f.allocations
+}
+
+// linearAllocator stacks allocations on top of each other.
+type linearAllocator struct {
+	size        uint64
+	granularity uint64
+	regions     []region
+	usedBytes   uint64
+}
+
+func (l *linearAllocator) alloc(size, alignment uint64, kind ResourceKind) (uint64, bool) {
+	if size == 0 {
+		return 0, false
+	}
+
+	var offset uint64
+	if len(l.regions) > 0 {
+		top := l.regions[len(l.regions)-1]
+		offset = alignUp(top.offset+top.size, alignment)
+		if top.kind != kind && samePage(top.offset+top.size, offset, l.granularity) {
+			offset = alignUp(offset, l.granularity)
+		}
+	}
+	if offset+size > l.size {
+		return 0, false
+	}
+
+	l.regions = append(l.regions, region{offset: offset, size: size, kind: kind})
+	l.usedBytes += size
+	return offset, true
+}
+
+func (l *linearAllocator) free(offset uint64) {
+	for t := range l.regions {
+		if l.regions[t].offset != offset || l.regions[t].free {
+			continue
+		}
+		l.usedBytes -= l.regions[t].size
+		l.regions[t].free = true
+		break
+	}
+
+	// Reclaim freed space at the top of the stack.
+	for len(l.regions) > 0 && l.regions[len(l.regions)-1].free {
+		l.regions = l.regions[:len(l.regions)-1]
+	}
+}
+
+func (l *linearAllocator) used() uint64 {
+	return l.usedBytes
+}
+
+func (l *linearAllocator) count() int {
+	count := 0
+	for _, r := range l.regions {
+		if !r.free {
+			count++
+		}
+	}
+	return count
+}
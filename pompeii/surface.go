@@ -1,6 +1,14 @@
 package pompeii
 
+/*
+#include <stdlib.h>
+#include "ext.h"
+*/
+import "C"
+
 import (
+	"unsafe"
+
 	"github.com/pkg/errors"
 	"github.com/vulkan-go/glfw/v3.3/glfw"
 	vk "github.com/vulkan-go/vulkan"
@@ -17,6 +25,7 @@ type windowSurfaceVk struct {
 
 type WindowSurface struct {
 	instance *Instance
+	window   *glfw.Window
 
 	vk *windowSurfaceVk
 }
@@ -24,6 +33,7 @@ type WindowSurface struct {
 func NewWindowSurface(instance *Instance, window *glfw.Window) (*WindowSurface, error) {
 	w := WindowSurface{
 		instance: instance,
+		window:   window,
 		vk: &windowSurfaceVk{
 			surface: vk.NullSurface,
 		},
@@ -50,3 +60,77 @@ func (w *WindowSurface) Destroy() {
 func (w *WindowSurface) Handle() vk.Surface {
 	return w.vk.surface
 }
+
+func (w *WindowSurface) Size() (uint32, uint32) {
+	width, height := w.window.GetFramebufferSize()
+	return uint32(width), uint32(height)
+}
+
+const structureTypeHeadlessSurfaceCreateInfo = 1000256000
+
+// HeadlessInstanceExtensions lists the instance extensions NewHeadlessSurface
+// depends on.
+func HeadlessInstanceExtensions() []string {
+	return []string{
+		"VK_KHR_surface",
+		"VK_EXT_headless_surface",
+	}
+}
+
+type headlessSurfaceVk struct {
+	surface vk.Surface
+}
+
+// HeadlessSurface is a surface without a display, backed by
+// VK_EXT_headless_surface. Its size is whatever the application says it is.
+type HeadlessSurface struct {
+	Width  uint32
+	Height uint32
+
+	instance *Instance
+
+	vk *headlessSurfaceVk
+}
+
+func NewHeadlessSurface(instance *Instance, width, height uint32) (*HeadlessSurface, error) {
+	h := HeadlessSurface{
+		Width:    width,
+		Height:   height,
+		instance: instance,
+		vk: &headlessSurfaceVk{
+			surface: vk.NullSurface,
+		},
+	}
+
+	createFn, err := instance.proc("vkCreateHeadlessSurfaceEXT")
+	if err != nil {
+		return nil, errors.Wrap(err, "create headless surface")
+	}
+
+	createInfo := (*C.pompeiiHeadlessSurfaceCreateInfo)(C.calloc(1, C.sizeof_pompeiiHeadlessSurfaceCreateInfo))
+	defer C.free(unsafe.Pointer(createInfo))
+	createInfo.sType = structureTypeHeadlessSurfaceCreateInfo
+
+	var surface C.uint64_t
+	if result := vk.Result(C.pompeiiCreateHeadlessSurface(createFn, unsafe.Pointer(instance.Handle()), createInfo, &surface)); result != vk.Success {
+		return nil, errors.Wrap(vk.Error(result), "create headless surface")
+	}
+	h.vk.surface = surfaceFromUint64(uint64(surface))
+
+	return &h, nil
+}
+
+func (h *HeadlessSurface) Destroy() {
+	if h.vk.surface != vk.NullSurface {
+		vk.DestroySurface(h.instance.Handle(), h.vk.surface, nil)
+	}
+}
+
+func (h *HeadlessSurface) Handle() vk.Surface {
+	return h.vk.surface
+}
+
+// Size reports the requested size, the surface itself has no extent.
+func (h *HeadlessSurface) Size() (uint32, uint32) {
+	return h.Width, h.Height
+}
@@ -0,0 +1,273 @@
+package pompeii
+
+import (
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// ErrSwapchainSuspended is returned by Acquire while the surface has a zero
+// extent, e.g. when the window is minimized. Skip the frame and try again.
+var ErrSwapchainSuspended = errors.New("swapchain suspended")
+
+// surfaceSizer is implemented by surfaces that can report their own size,
+// used when the surface leaves the swapchain extent up to the application.
+type surfaceSizer interface {
+	Size() (width, height uint32)
+}
+
+// SwapchainOptions steer the format, present mode and image count picked
+// from what the surface supports, the zero value prefers sRGB and vsync.
+type SwapchainOptions struct {
+	// Formats in order of preference, DefaultSurfaceFormats when empty.
+	Formats []SurfaceFormat
+	Present PresentPreference
+	// ImageCount is clamped to what the surface supports, zero picks one
+	// more than the minimum.
+	ImageCount uint32
+}
+
+type Swapchain struct {
+	Format      vk.Format
+	ColorSpace  vk.ColorSpace
+	PresentMode vk.PresentMode
+	Extent      vk.Extent2D
+	Images      []vk.Image
+	ImageViews  []vk.ImageView
+
+	gpu        *GPU
+	device     *Device
+	surface    Surface
+	options    SwapchainOptions
+	swapchain  vk.Swapchain
+	outdated   bool
+	generation int
+}
+
+func NewSwapchain(g *GPU, d *Device, s Surface, options SwapchainOptions) (*Swapchain, error) {
+	sc := Swapchain{
+		gpu:       g,
+		device:    d,
+		surface:   s,
+		options:   options,
+		swapchain: vk.NullSwapchain,
+	}
+
+	if err := sc.recreate(); err != nil && err != ErrSwapchainSuspended {
+		return nil, err
+	}
+
+	return &sc, nil
+}
+
+func (sc *Swapchain) Destroy() {
+	sc.destroyImageViews()
+	if sc.swapchain != vk.NullSwapchain {
+		vk.DestroySwapchain(sc.device.Handle(), sc.swapchain, nil)
+		sc.swapchain = vk.NullSwapchain
+	}
+}
+
+// Generation is bumped every time the swapchain is recreated. Anything built
+// on top of the images (framebuffers, recorded command buffers) has to be
+// rebuilt when it changes.
+func (sc *Swapchain) Generation() int {
+	return sc.generation
+}
+
+// Invalidate forces the swapchain to be recreated on the next Acquire, for
+// example after a window resize event.
+func (sc *Swapchain) Invalidate() {
+	sc.outdated = true
+}
+
+// Acquire returns the index of the next image to render to, signaling
+// semaphore once it is available. An outdated swapchain is recreated
+// transparently before acquiring.
+func (sc *Swapchain) Acquire(semaphore *Semaphore) (uint32, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		if sc.outdated || sc.swapchain == vk.NullSwapchain {
+			if err := sc.recreate(); err != nil {
+				return 0, err
+			}
+		}
+
+		var imageIndex uint32
+		result := vk.AcquireNextImage(sc.device.Handle(), sc.swapchain, vk.MaxUint64, semaphore.Handle(), vk.NullFence, &imageIndex)
+		switch result {
+		case vk.Success:
+			return imageIndex, nil
+		case vk.Suboptimal:
+			sc.outdated = true
+			return imageIndex, nil
+		case vk.ErrorOutOfDate:
+			sc.outdated = true
+		default:
+			return 0, errors.Wrap(vk.Error(result), "acquire image")
+		}
+	}
+
+	return 0, errors.Wrap(vk.Error(vk.ErrorOutOfDate), "acquire image")
+}
+
+// Present queues imageIndex for presentation once wait is signaled. A
+// suboptimal or outdated swapchain is not an error, it is recreated on the
+// next Acquire.
+func (sc *Swapchain) Present(queue *Queue, imageIndex uint32, wait *Semaphore) error {
+	presentInfo := vk.PresentInfo{
+		SType:          vk.StructureTypePresentInfo,
+		SwapchainCount: 1,
+		PSwapchains: []vk.Swapchain{
+			sc.swapchain,
+		},
+		PImageIndices: []uint32{
+			imageIndex,
+		},
+	}
+	if wait != nil {
+		presentInfo.WaitSemaphoreCount = 1
+		presentInfo.PWaitSemaphores = []vk.Semaphore{
+			wait.Handle(),
+		}
+	}
+
+	result := queue.Present(&presentInfo)
+	switch result {
+	case vk.Success:
+		return nil
+	case vk.Suboptimal, vk.ErrorOutOfDate:
+		sc.outdated = true
+		return nil
+	default:
+		return errors.Wrap(vk.Error(result), "present image")
+	}
+}
+
+func (sc *Swapchain) Handle() vk.Swapchain {
+	return sc.swapchain
+}
+
+func (sc *Swapchain) recreate() error {
+	deviceHandle := sc.device.Handle()
+	surfaceHandle := sc.surface.Handle()
+
+	support, err := sc.gpu.SurfaceSupport(sc.surface)
+	if err != nil {
+		return err
+	}
+	caps := support.Capabilities
+
+	var width, height uint32
+	if sizer, ok := sc.surface.(surfaceSizer); ok {
+		width, height = sizer.Size()
+	}
+	extent := caps.ClampExtent(width, height)
+	if extent.Width == 0 || extent.Height == 0 {
+		sc.outdated = true
+		return ErrSwapchainSuspended
+	}
+
+	format := support.ChooseFormat(sc.options.Formats)
+	presentMode := support.ChoosePresentMode(sc.options.Present)
+	imageCount := caps.ClampImageCount(sc.options.ImageCount)
+
+	compositeAlpha := vk.CompositeAlphaOpaqueBit
+	for _, alpha := range []vk.CompositeAlphaFlagBits{
+		vk.CompositeAlphaOpaqueBit,
+		vk.CompositeAlphaInheritBit,
+		vk.CompositeAlphaPreMultipliedBit,
+		vk.CompositeAlphaPostMultipliedBit,
+	} {
+		if caps.SupportedCompositeAlpha&alpha != 0 {
+			compositeAlpha = alpha
+			break
+		}
+	}
+
+	oldSwapchain := sc.swapchain
+	swapchainCreateInfo := vk.SwapchainCreateInfo{
+		SType:            vk.StructureTypeSwapchainCreateInfo,
+		Surface:          surfaceHandle,
+		MinImageCount:    imageCount,
+		ImageFormat:      format.Format,
+		ImageColorSpace:  format.ColorSpace,
+		ImageExtent:      extent,
+		ImageArrayLayers: 1,
+		ImageUsage:       vk.ImageUsageFlags(vk.ImageUsageColorAttachmentBit | vk.ImageUsageTransferDstBit),
+		ImageSharingMode: vk.SharingModeExclusive,
+		PreTransform:     caps.CurrentTransform,
+		CompositeAlpha:   compositeAlpha,
+		PresentMode:      presentMode,
+		Clipped:          vk.True,
+		OldSwapchain:     oldSwapchain,
+	}
+	if sc.device.PresentIndex != -1 && sc.device.GraphicsIndex != sc.device.PresentIndex {
+		swapchainCreateInfo.ImageSharingMode = vk.SharingModeConcurrent
+		swapchainCreateInfo.QueueFamilyIndexCount = 2
+		swapchainCreateInfo.PQueueFamilyIndices = []uint32{
+			uint32(sc.device.GraphicsIndex),
+			uint32(sc.device.PresentIndex),
+		}
+	}
+
+	// Images of the old swapchain may still be in flight.
+	sc.device.WaitIdle()
+
+	var swapchain vk.Swapchain
+	if result := vk.CreateSwapchain(deviceHandle, &swapchainCreateInfo, nil, &swapchain); result != vk.Success {
+		return errors.Wrap(vk.Error(result), "create swapchain")
+	}
+	sc.destroyImageViews()
+	if oldSwapchain != vk.NullSwapchain {
+		vk.DestroySwapchain(deviceHandle, oldSwapchain, nil)
+	}
+	sc.swapchain = swapchain
+	sc.Format = format.Format
+	sc.ColorSpace = format.ColorSpace
+	sc.Extent = extent
+	sc.PresentMode = presentMode
+
+	if err := sc.createImageViews(); err != nil {
+		return err
+	}
+
+	sc.outdated = false
+	sc.generation++
+
+	return nil
+}
+
+func (sc *Swapchain) createImageViews() error {
+	deviceHandle := sc.device.Handle()
+
+	var imageCount uint32
+	if result := vk.GetSwapchainImages(deviceHandle, sc.swapchain, &imageCount, nil); result != vk.Success {
+		return errors.Wrap(vk.Error(result), "count swapchain images")
+	}
+	sc.Images = make([]vk.Image, imageCount)
+	if result := vk.GetSwapchainImages(deviceHandle, sc.swapchain, &imageCount, sc.Images); result != vk.Success {
+		return errors.Wrap(vk.Error(result), "get swapchain images")
+	}
+
+	sc.ImageViews = make([]vk.ImageView, 0, imageCount)
+	for _, image := range sc.Images {
+		view, err := createImageView(deviceHandle, image, vk.ImageViewType2d, sc.Format, vk.ImageSubresourceRange{
+			AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+			LevelCount: 1,
+			LayerCount: 1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "create swapchain image view")
+		}
+		sc.ImageViews = append(sc.ImageViews, view)
+	}
+
+	return nil
+}
+
+func (sc *Swapchain) destroyImageViews() {
+	for _, view := range sc.ImageViews {
+		vk.DestroyImageView(sc.device.Handle(), view, nil)
+	}
+	sc.ImageViews = nil
+	sc.Images = nil
+}
@@ -0,0 +1,40 @@
+package pompeii
+
+import (
+	"github.com/pkg/errors"
+	vk "github.com/vulkan-go/vulkan"
+
+	"github.com/perlw/abyssal_drifter/loader"
+)
+
+// NewTexture creates a sampled image from a decoded texture and uploads all
+// of its subresources, see Image.Upload.
+func NewTexture(a *Allocator, pool *CommandPool, queue *Queue, t *loader.Texture, usage vk.ImageUsageFlagBits) (*Image, error) {
+	img, err := NewImage(a, ImageOptions{
+		Format:    vk.Format(t.Format),
+		Width:     t.Width,
+		Height:    t.Height,
+		MipLevels: t.MipLevels,
+		Layers:    t.ImageLayers(),
+		Cube:      t.Cube,
+		Usage:     usage | vk.ImageUsageSampledBit | vk.ImageUsageTransferDstBit,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "create texture")
+	}
+
+	subresources := make([]ImageSubresourceData, len(t.Subresources))
+	for i, subresource := range t.Subresources {
+		subresources[i] = ImageSubresourceData{
+			MipLevel: subresource.MipLevel,
+			Layer:    t.ImageLayer(subresource),
+			Data:     subresource.Data,
+		}
+	}
+	if err := img.Upload(pool, queue, subresources); err != nil {
+		img.Destroy()
+		return nil, errors.Wrap(err, "create texture")
+	}
+
+	return img, nil
+}
@@ -0,0 +1,123 @@
+package pompeii
+
+/*
+#include <stdlib.h>
+#include "ext.h"
+*/
+import "C"
+
+import (
+	"strings"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	structureTypeValidationFeatures = 1000247000
+
+	validationFeatureEnableGPUAssisted                   = 0
+	validationFeatureEnableGPUAssistedReserveBindingSlot = 1
+	validationFeatureEnableBestPractices                 = 2
+	validationFeatureEnableDebugPrintf                   = 3
+	validationFeatureEnableSynchronizationValidation     = 4
+)
+
+// validationLayers in order of preference, SDKs before 1.1.106 only shipped
+// the LunarG meta layer.
+var validationLayers = []string{
+	"VK_LAYER_KHRONOS_validation",
+	"VK_LAYER_LUNARG_standard_validation",
+}
+
+// ValidationOptions turns on the validation layer, the zero value runs the
+// core checks only. The extra checks need VK_EXT_validation_features from
+// the layer.
+type ValidationOptions struct {
+	GPUAssisted bool
+	// Synchronization reports missing and misplaced barriers.
+	Synchronization bool
+	BestPractices   bool
+	// DebugPrintf delivers debugPrintfEXT output from shaders as info
+	// messages, it can not be combined with GPUAssisted.
+	DebugPrintf bool
+}
+
+func (o ValidationOptions) String() string {
+	names := []string{"core"}
+	if o.GPUAssisted {
+		names = append(names, "gpu-assisted")
+	}
+	if o.Synchronization {
+		names = append(names, "synchronization")
+	}
+	if o.BestPractices {
+		names = append(names, "best-practices")
+	}
+	if o.DebugPrintf {
+		names = append(names, "debug-printf")
+	}
+	return strings.Join(names, ", ")
+}
+
+func (o ValidationOptions) enables() []C.int32_t {
+	enables := []C.int32_t{}
+	if o.GPUAssisted {
+		enables = append(enables, validationFeatureEnableGPUAssisted, validationFeatureEnableGPUAssistedReserveBindingSlot)
+	}
+	if o.Synchronization {
+		enables = append(enables, validationFeatureEnableSynchronizationValidation)
+	}
+	if o.BestPractices {
+		enables = append(enables, validationFeatureEnableBestPractices)
+	}
+	if o.DebugPrintf {
+		enables = append(enables, validationFeatureEnableDebugPrintf)
+	}
+	return enables
+}
+
+// ValidationLayer returns the preferred validation layer that is installed.
+func ValidationLayer() (string, error) {
+	available, err := getAvailableInstanceLayers()
+	if err != nil {
+		return "", errors.Wrap(err, "could not get layers")
+	}
+	for _, name := range validationLayers {
+		if inStringSlice(available, name) {
+			return name, nil
+		}
+	}
+	return "", errors.New("no validation layer installed")
+}
+
+// validationFeatures is the VkValidationFeaturesEXT chained into instance
+// creation, it lives in C memory as the driver keeps no Go pointers.
+type validationFeatures struct {
+	features *C.pompeiiValidationFeatures
+	enables  *C.int32_t
+}
+
+func newValidationFeatures(options ValidationOptions) *validationFeatures {
+	enables := options.enables()
+	v := validationFeatures{
+		features: (*C.pompeiiValidationFeatures)(C.calloc(1, C.sizeof_pompeiiValidationFeatures)),
+		enables:  (*C.int32_t)(C.calloc(C.size_t(len(enables)), C.sizeof_int32_t)),
+	}
+	for t, enable := range enables {
+		(*[8]C.int32_t)(unsafe.Pointer(v.enables))[t] = enable
+	}
+	v.features.sType = structureTypeValidationFeatures
+	v.features.enabledValidationFeatureCount = C.uint32_t(len(enables))
+	v.features.pEnabledValidationFeatures = v.enables
+	return &v
+}
+
+func (v *validationFeatures) pointer() unsafe.Pointer {
+	return unsafe.Pointer(v.features)
+}
+
+func (v *validationFeatures) free() {
+	C.free(unsafe.Pointer(v.enables))
+	C.free(unsafe.Pointer(v.features))
+}
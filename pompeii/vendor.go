@@ -0,0 +1,98 @@
+package pompeii
+
+/*
+#include <stdlib.h>
+#include "ext.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Vendor is the PCI vendor ID, or a Khronos assigned one for vendors without.
+type Vendor uint32
+
+const (
+	VendorAMD      Vendor = 0x1002
+	VendorNVIDIA   Vendor = 0x10de
+	VendorIntel    Vendor = 0x8086
+	VendorARM      Vendor = 0x13b5
+	VendorQualcomm Vendor = 0x5143
+	VendorApple    Vendor = 0x106b
+	// VendorMesa covers Mesa's software renderers such as lavapipe.
+	VendorMesa Vendor = 0x10005
+)
+
+func (v Vendor) String() string {
+	switch v {
+	case VendorAMD:
+		return "AMD"
+	case VendorNVIDIA:
+		return "NVIDIA"
+	case VendorIntel:
+		return "Intel"
+	case VendorARM:
+		return "ARM"
+	case VendorQualcomm:
+		return "Qualcomm"
+	case VendorApple:
+		return "Apple"
+	case VendorMesa:
+		return "Mesa"
+	default:
+		return fmt.Sprintf("0x%04x", uint32(v))
+	}
+}
+
+// DriverVersion decodes a driver version the way the vendor packs it, most
+// use the Vulkan major.minor.patch layout.
+func (v Vendor) DriverVersion(version uint32) string {
+	switch {
+	case v == VendorNVIDIA:
+		return fmt.Sprintf("%d.%d.%d.%d", version>>22, (version>>14)&0xff, (version>>6)&0xff, version&0x3f)
+	// Only the Windows driver, Mesa's ANV uses the Vulkan layout.
+	case v == VendorIntel && runtime.GOOS == "windows":
+		return fmt.Sprintf("%d.%d", version>>14, version&0x3fff)
+	// MoltenVK reports its own version as major*10000+minor*100+patch.
+	case v == VendorApple:
+		return fmt.Sprintf("%d.%d.%d", version/10000, version/100%100, version%100)
+	default:
+		return vk.Version(version).String()
+	}
+}
+
+const structureTypePhysicalDeviceDriverProperties = 1000196000
+
+// queryDriverProperties fills in the driver name, info and conformance
+// version, which needs Vulkan 1.2 or VK_KHR_driver_properties.
+func queryDriverProperties(g *GPU) {
+	if !g.apiVersionAtLeast(1, 2) {
+		extensions, err := g.Extensions()
+		if err != nil || !inStringSlice(extensions, "VK_KHR_driver_properties") {
+			return
+		}
+	}
+	fn := g.properties2Proc("vkGetPhysicalDeviceProperties2")
+	if fn == nil {
+		return
+	}
+
+	driver := (*C.pompeiiDriverProperties)(C.calloc(1, C.sizeof_pompeiiDriverProperties))
+	defer C.free(unsafe.Pointer(driver))
+	driver.sType = structureTypePhysicalDeviceDriverProperties
+	C.pompeiiGetPhysicalDeviceDriverProperties(fn, unsafe.Pointer(g.physicalDevice), driver)
+
+	g.DriverName = C.GoString(&driver.driverName[0])
+	g.DriverInfo = C.GoString(&driver.driverInfo[0])
+	g.ConformanceVersion = fmt.Sprintf("%d.%d.%d.%d",
+		driver.conformanceVersion[0],
+		driver.conformanceVersion[1],
+		driver.conformanceVersion[2],
+		driver.conformanceVersion[3],
+	)
+}
@@ -0,0 +1,95 @@
+package spirv
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// DescriptorSetLayout describes the bindings of one set.
+type DescriptorSetLayout struct {
+	Set      uint32
+	Bindings []DescriptorBinding
+}
+
+type PushConstantRange struct {
+	Stages ShaderStage
+	Offset uint32
+	Size   uint32
+}
+
+// PipelineLayout describes a layout covering a set of shader stages. Sets
+// are contiguous from 0, sets no stage uses are left empty.
+type PipelineLayout struct {
+	Sets          []DescriptorSetLayout
+	PushConstants []PushConstantRange
+}
+
+// MergeLayouts combines the resources of modules into a single pipeline
+// layout. Bindings shared between stages must agree on type and count.
+func MergeLayouts(modules ...*Module) (*PipelineLayout, error) {
+	layout := PipelineLayout{}
+
+	type slot struct {
+		set, binding uint32
+	}
+	bindings := map[slot]DescriptorBinding{}
+	maxSet := -1
+	for _, m := range modules {
+		for _, binding := range m.Descriptors {
+			key := slot{binding.Set, binding.Binding}
+			existing, ok := bindings[key]
+			if !ok {
+				bindings[key] = binding
+				if int(binding.Set) > maxSet {
+					maxSet = int(binding.Set)
+				}
+				continue
+			}
+			if existing.Type != binding.Type || existing.Count != binding.Count {
+				return nil, errors.Errorf("spirv: set %d binding %d is %s[%d] in one stage and %s[%d] in another",
+					binding.Set, binding.Binding, existing.Type, existing.Count, binding.Type, binding.Count)
+			}
+			existing.Stages |= binding.Stages
+			bindings[key] = existing
+		}
+
+		for _, block := range m.PushConstants {
+			if block.Size == 0 {
+				continue
+			}
+			layout.addPushConstants(PushConstantRange{
+				Stages: block.Stages,
+				Offset: block.Offset,
+				Size:   block.Size,
+			})
+		}
+	}
+
+	layout.Sets = make([]DescriptorSetLayout, maxSet+1)
+	for t := range layout.Sets {
+		layout.Sets[t].Set = uint32(t)
+	}
+	for _, binding := range bindings {
+		set := &layout.Sets[binding.Set]
+		set.Bindings = append(set.Bindings, binding)
+	}
+	for _, set := range layout.Sets {
+		sort.Slice(set.Bindings, func(i, j int) bool {
+			return set.Bindings[i].Binding < set.Bindings[j].Binding
+		})
+	}
+
+	return &layout, nil
+}
+
+// addPushConstants folds identical ranges of different stages together.
+func (l *PipelineLayout) addPushConstants(r PushConstantRange) {
+	for t, existing := range l.PushConstants {
+		if existing.Offset == r.Offset && existing.Size == r.Size {
+			l.PushConstants[t].Stages |= r.Stages
+			return
+		}
+	}
+	l.PushConstants = append(l.PushConstants, r)
+}
@@ -0,0 +1,771 @@
+package spirv
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+type ExecutionModel uint32
+
+const (
+	ExecutionModelVertex                 ExecutionModel = 0
+	ExecutionModelTessellationControl    ExecutionModel = 1
+	ExecutionModelTessellationEvaluation ExecutionModel = 2
+	ExecutionModelGeometry               ExecutionModel = 3
+	ExecutionModelFragment               ExecutionModel = 4
+	ExecutionModelGLCompute              ExecutionModel = 5
+	ExecutionModelKernel                 ExecutionModel = 6
+)
+
+func (m ExecutionModel) String() string {
+	switch m {
+	case ExecutionModelVertex:
+		return "Vertex"
+	case ExecutionModelTessellationControl:
+		return "TessellationControl"
+	case ExecutionModelTessellationEvaluation:
+		return "TessellationEvaluation"
+	case ExecutionModelGeometry:
+		return "Geometry"
+	case ExecutionModelFragment:
+		return "Fragment"
+	case ExecutionModelGLCompute:
+		return "GLCompute"
+	case ExecutionModelKernel:
+		return "Kernel"
+	default:
+		return "Unknown"
+	}
+}
+
+// ShaderStage values match vk.ShaderStageFlagBits.
+type ShaderStage uint32
+
+const (
+	ShaderStageVertex                 ShaderStage = 0x1
+	ShaderStageTessellationControl    ShaderStage = 0x2
+	ShaderStageTessellationEvaluation ShaderStage = 0x4
+	ShaderStageGeometry               ShaderStage = 0x8
+	ShaderStageFragment               ShaderStage = 0x10
+	ShaderStageCompute                ShaderStage = 0x20
+)
+
+// Stage returns the shader stage the model runs in, zero if it has none.
+func (m ExecutionModel) Stage() ShaderStage {
+	switch m {
+	case ExecutionModelVertex:
+		return ShaderStageVertex
+	case ExecutionModelTessellationControl:
+		return ShaderStageTessellationControl
+	case ExecutionModelTessellationEvaluation:
+		return ShaderStageTessellationEvaluation
+	case ExecutionModelGeometry:
+		return ShaderStageGeometry
+	case ExecutionModelFragment:
+		return ShaderStageFragment
+	case ExecutionModelGLCompute:
+		return ShaderStageCompute
+	default:
+		return 0
+	}
+}
+
+// DescriptorType values match vk.DescriptorType.
+type DescriptorType uint32
+
+const (
+	DescriptorTypeSampler               DescriptorType = 0
+	DescriptorTypeCombinedImageSampler  DescriptorType = 1
+	DescriptorTypeSampledImage          DescriptorType = 2
+	DescriptorTypeStorageImage          DescriptorType = 3
+	DescriptorTypeUniformTexelBuffer    DescriptorType = 4
+	DescriptorTypeStorageTexelBuffer    DescriptorType = 5
+	DescriptorTypeUniformBuffer         DescriptorType = 6
+	DescriptorTypeStorageBuffer         DescriptorType = 7
+	DescriptorTypeInputAttachment       DescriptorType = 10
+	DescriptorTypeAccelerationStructure DescriptorType = 1000150000
+)
+
+func (t DescriptorType) String() string {
+	switch t {
+	case DescriptorTypeSampler:
+		return "Sampler"
+	case DescriptorTypeCombinedImageSampler:
+		return "CombinedImageSampler"
+	case DescriptorTypeSampledImage:
+		return "SampledImage"
+	case DescriptorTypeStorageImage:
+		return "StorageImage"
+	case DescriptorTypeUniformTexelBuffer:
+		return "UniformTexelBuffer"
+	case DescriptorTypeStorageTexelBuffer:
+		return "StorageTexelBuffer"
+	case DescriptorTypeUniformBuffer:
+		return "UniformBuffer"
+	case DescriptorTypeStorageBuffer:
+		return "StorageBuffer"
+	case DescriptorTypeInputAttachment:
+		return "InputAttachment"
+	case DescriptorTypeAccelerationStructure:
+		return "AccelerationStructure"
+	default:
+		return "Unknown"
+	}
+}
+
+// Format values match vk.Format, FormatUndefined for types that have no
+// vertex or attachment format.
+type Format uint32
+
+const FormatUndefined Format = 0
+
+type EntryPoint struct {
+	Name  string
+	Model ExecutionModel
+	Stage ShaderStage
+	// LocalSize of compute entry points.
+	LocalSize [3]uint32
+
+	// Inputs and Outputs are the user defined interface variables sorted by
+	// location, built-ins are left out. The vertex inputs of vertex entry
+	// points and the color outputs of fragment ones.
+	Inputs  []InterfaceVariable
+	Outputs []InterfaceVariable
+}
+
+type InterfaceVariable struct {
+	Name      string
+	Location  uint32
+	Component uint32
+	Format    Format
+	// Locations taken, more than one for matrices and arrays.
+	Locations uint32
+}
+
+type DescriptorBinding struct {
+	Name    string
+	Set     uint32
+	Binding uint32
+	Type    DescriptorType
+	// Count is the array size, zero for runtime sized arrays.
+	Count  uint32
+	Stages ShaderStage
+}
+
+type PushConstantBlock struct {
+	Name   string
+	Stages ShaderStage
+	// Offset of the first member and Size up to the end of the last one.
+	Offset  uint32
+	Size    uint32
+	Members []BlockMember
+}
+
+type BlockMember struct {
+	Name   string
+	Offset uint32
+	Size   uint32
+}
+
+// Module is what reflection found in a module. Descriptors and push
+// constants are attributed to every entry point's stage.
+type Module struct {
+	Header      Header
+	EntryPoints []EntryPoint
+	Descriptors []DescriptorBinding
+	// PushConstants holds at most one block per module in practice.
+	PushConstants []PushConstantBlock
+}
+
+// Stages combines the stages of all entry points.
+func (m *Module) Stages() ShaderStage {
+	var stages ShaderStage
+	for _, entryPoint := range m.EntryPoints {
+		stages |= entryPoint.Stage
+	}
+	return stages
+}
+
+// EntryPoint looks up an entry point by name.
+func (m *Module) EntryPoint(name string) (*EntryPoint, bool) {
+	for t := range m.EntryPoints {
+		if m.EntryPoints[t].Name == name {
+			return &m.EntryPoints[t], true
+		}
+	}
+	return nil, false
+}
+
+const (
+	opName             = 5
+	opMemberName       = 6
+	opEntryPoint       = 15
+	opExecutionMode    = 16
+	opTypeVoid         = 19
+	opTypeBool         = 20
+	opTypeInt          = 21
+	opTypeFloat        = 22
+	opTypeVector       = 23
+	opTypeMatrix       = 24
+	opTypeImage        = 25
+	opTypeSampler      = 26
+	opTypeSampledImage = 27
+	opTypeArray        = 28
+	opTypeRuntimeArray = 29
+	opTypeStruct       = 30
+	opTypePointer      = 32
+	opTypeForwardPtr   = 39
+	opConstant         = 43
+	opSpecConstant     = 50
+	opVariable         = 59
+	opDecorate         = 71
+	opMemberDecorate   = 72
+	opTypeAccelStruct  = 5341
+
+	decorationBlock         = 2
+	decorationBufferBlock   = 3
+	decorationArrayStride   = 6
+	decorationMatrixStride  = 7
+	decorationBuiltIn       = 11
+	decorationLocation      = 30
+	decorationComponent     = 31
+	decorationBinding       = 33
+	decorationDescriptorSet = 34
+	decorationOffset        = 35
+
+	storageUniformConstant = 0
+	storageInput           = 1
+	storageUniform         = 2
+	storageOutput          = 3
+	storagePushConstant    = 9
+	storageStorageBuffer   = 12
+
+	dimBuffer      = 5
+	dimSubpassData = 6
+
+	executionModeLocalSize = 17
+)
+
+type spirvType struct {
+	op       uint32
+	operands []uint32
+}
+
+type decorations map[uint32][]uint32
+
+func (d decorations) has(decoration uint32) bool {
+	_, ok := d[decoration]
+	return ok
+}
+
+func (d decorations) value(decoration uint32) uint32 {
+	if literals := d[decoration]; len(literals) > 0 {
+		return literals[0]
+	}
+	return 0
+}
+
+type variable struct {
+	id      uint32
+	typeID  uint32
+	storage uint32
+}
+
+type reflector struct {
+	names             map[uint32]string
+	memberNames       map[uint32]map[uint32]string
+	decorations       map[uint32]decorations
+	memberDecorations map[uint32]map[uint32]decorations
+	types             map[uint32]spirvType
+	constants         map[uint32]uint32
+	variables         []variable
+	// structSizes memoizes size, structs shared by several members would
+	// otherwise be walked once per path to them.
+	structSizes map[uint32]uint32
+}
+
+func literalString(words []uint32) (string, int) {
+	bytes := []byte{}
+	for t, word := range words {
+		for shift := uint(0); shift < 32; shift += 8 {
+			b := byte(word >> shift)
+			if b == 0 {
+				return string(bytes), t + 1
+			}
+			bytes = append(bytes, b)
+		}
+	}
+	return string(bytes), len(words)
+}
+
+// ReflectBytes is Reflect on a module's bytes, see Words.
+func ReflectBytes(data []byte) (*Module, error) {
+	words, err := Words(data)
+	if err != nil {
+		return nil, err
+	}
+	return Reflect(words)
+}
+
+// Reflect parses a module in host order.
+func Reflect(words []uint32) (*Module, error) {
+	header, err := Validate(words)
+	if err != nil {
+		return nil, err
+	}
+
+	m := Module{
+		Header: header,
+	}
+	r := reflector{
+		names:             map[uint32]string{},
+		memberNames:       map[uint32]map[uint32]string{},
+		decorations:       map[uint32]decorations{},
+		memberDecorations: map[uint32]map[uint32]decorations{},
+		types:             map[uint32]spirvType{},
+		constants:         map[uint32]uint32{},
+		structSizes:       map[uint32]uint32{},
+	}
+	interfaces := [][]uint32{}
+	localSizes := map[uint32][3]uint32{}
+	entryIDs := []uint32{}
+
+	for offset := HeaderWords; offset < len(words); {
+		wordCount := int(words[offset] >> 16)
+		op := words[offset] & 0xffff
+		if wordCount == 0 || offset+wordCount > len(words) {
+			return nil, errors.Errorf("spirv: malformed instruction %d at word %d", op, offset)
+		}
+		operands := words[offset+1 : offset+wordCount]
+		offset += wordCount
+
+		need := func(n int) error {
+			if len(operands) < n {
+				return errors.Errorf("spirv: instruction %d has %d operands, need %d", op, len(operands), n)
+			}
+			return nil
+		}
+
+		switch op {
+		case opName:
+			if err := need(2); err != nil {
+				return nil, err
+			}
+			r.names[operands[0]], _ = literalString(operands[1:])
+		case opMemberName:
+			if err := need(3); err != nil {
+				return nil, err
+			}
+			if r.memberNames[operands[0]] == nil {
+				r.memberNames[operands[0]] = map[uint32]string{}
+			}
+			r.memberNames[operands[0]][operands[1]], _ = literalString(operands[2:])
+		case opEntryPoint:
+			if err := need(3); err != nil {
+				return nil, err
+			}
+			name, used := literalString(operands[2:])
+			model := ExecutionModel(operands[0])
+			m.EntryPoints = append(m.EntryPoints, EntryPoint{
+				Name:  name,
+				Model: model,
+				Stage: model.Stage(),
+			})
+			entryIDs = append(entryIDs, operands[1])
+			interfaces = append(interfaces, operands[2+used:])
+		case opExecutionMode:
+			if len(operands) >= 5 && operands[1] == executionModeLocalSize {
+				localSizes[operands[0]] = [3]uint32{operands[2], operands[3], operands[4]}
+			}
+		case opDecorate:
+			if err := need(2); err != nil {
+				return nil, err
+			}
+			if r.decorations[operands[0]] == nil {
+				r.decorations[operands[0]] = decorations{}
+			}
+			r.decorations[operands[0]][operands[1]] = operands[2:]
+		case opMemberDecorate:
+			if err := need(3); err != nil {
+				return nil, err
+			}
+			members := r.memberDecorations[operands[0]]
+			if members == nil {
+				members = map[uint32]decorations{}
+				r.memberDecorations[operands[0]] = members
+			}
+			if members[operands[1]] == nil {
+				members[operands[1]] = decorations{}
+			}
+			members[operands[1]][operands[2]] = operands[3:]
+		case opTypeVoid, opTypeBool, opTypeInt, opTypeFloat, opTypeVector, opTypeMatrix,
+			opTypeImage, opTypeSampler, opTypeSampledImage, opTypeArray, opTypeRuntimeArray,
+			opTypeStruct, opTypePointer, opTypeAccelStruct:
+			if err := need(1); err != nil {
+				return nil, err
+			}
+			if err := r.addType(op, operands); err != nil {
+				return nil, err
+			}
+		case opTypeForwardPtr:
+			if err := need(1); err != nil {
+				return nil, err
+			}
+			if _, ok := r.types[operands[0]]; !ok {
+				r.types[operands[0]] = spirvType{op: op}
+			}
+		case opConstant, opSpecConstant:
+			if err := need(3); err != nil {
+				return nil, err
+			}
+			r.constants[operands[1]] = operands[2]
+		case opVariable:
+			if err := need(3); err != nil {
+				return nil, err
+			}
+			r.variables = append(r.variables, variable{
+				id:      operands[1],
+				typeID:  operands[0],
+				storage: operands[2],
+			})
+		}
+	}
+	if len(m.EntryPoints) == 0 {
+		return nil, errors.New("spirv: no entry points")
+	}
+
+	stages := m.Stages()
+	for t := range m.EntryPoints {
+		entryPoint := &m.EntryPoints[t]
+		entryPoint.LocalSize = localSizes[entryIDs[t]]
+		for _, id := range interfaces[t] {
+			v, ok := r.variable(id)
+			if !ok || r.builtIn(v) {
+				continue
+			}
+			switch v.storage {
+			case storageInput:
+				entryPoint.Inputs = append(entryPoint.Inputs, r.interfaceVariable(v))
+			case storageOutput:
+				entryPoint.Outputs = append(entryPoint.Outputs, r.interfaceVariable(v))
+			}
+		}
+		sortInterface(entryPoint.Inputs)
+		sortInterface(entryPoint.Outputs)
+	}
+
+	for _, v := range r.variables {
+		switch v.storage {
+		case storageUniformConstant, storageUniform, storageStorageBuffer:
+			binding, err := r.descriptor(v)
+			if err != nil {
+				return nil, err
+			}
+			binding.Stages = stages
+			m.Descriptors = append(m.Descriptors, binding)
+		case storagePushConstant:
+			block := r.pushConstants(v)
+			block.Stages = stages
+			m.PushConstants = append(m.PushConstants, block)
+		}
+	}
+	sort.Slice(m.Descriptors, func(i, j int) bool {
+		a, b := m.Descriptors[i], m.Descriptors[j]
+		return a.Set < b.Set || (a.Set == b.Set && a.Binding < b.Binding)
+	})
+
+	return &m, nil
+}
+
+func sortInterface(variables []InterfaceVariable) {
+	sort.Slice(variables, func(i, j int) bool {
+		a, b := variables[i], variables[j]
+		return a.Location < b.Location || (a.Location == b.Location && a.Component < b.Component)
+	})
+}
+
+// addType records a type declaration. Element, component and member types
+// have to be declared first, which keeps the type walks below from cycling
+// on malformed modules. Pointers may refer ahead, and be declared ahead by
+// OpTypeForwardPointer, but are never followed past a variable.
+func (r *reflector) addType(op uint32, operands []uint32) error {
+	id := operands[0]
+	if existing, ok := r.types[id]; ok && (op != opTypePointer || existing.op != opTypeForwardPtr) {
+		return errors.Errorf("spirv: type %d declared twice", id)
+	}
+	var refs []uint32
+	switch op {
+	case opTypeVector, opTypeMatrix, opTypeArray, opTypeRuntimeArray:
+		if len(operands) >= 2 {
+			refs = operands[1:2]
+		}
+	case opTypeStruct:
+		refs = operands[1:]
+	}
+	for _, ref := range refs {
+		if _, ok := r.types[ref]; !ok {
+			return errors.Errorf("spirv: type %d refers to undeclared type %d", id, ref)
+		}
+	}
+	r.types[id] = spirvType{op: op, operands: operands[1:]}
+	return nil
+}
+
+func (r *reflector) variable(id uint32) (variable, bool) {
+	for _, v := range r.variables {
+		if v.id == id {
+			return v, true
+		}
+	}
+	return variable{}, false
+}
+
+// pointee strips the pointer off a variable's type.
+func (r *reflector) pointee(v variable) uint32 {
+	pointer := r.types[v.typeID]
+	if pointer.op == opTypePointer && len(pointer.operands) >= 2 {
+		return pointer.operands[1]
+	}
+	return v.typeID
+}
+
+// builtIn reports whether v is a built-in, or a block of built-ins such as
+// gl_PerVertex.
+func (r *reflector) builtIn(v variable) bool {
+	if r.decorations[v.id].has(decorationBuiltIn) {
+		return true
+	}
+	typeID := r.stripArrays(r.pointee(v))
+	for _, member := range r.memberDecorations[typeID] {
+		if member.has(decorationBuiltIn) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *reflector) stripArrays(typeID uint32) uint32 {
+	for {
+		t := r.types[typeID]
+		if (t.op != opTypeArray && t.op != opTypeRuntimeArray) || len(t.operands) == 0 {
+			return typeID
+		}
+		typeID = t.operands[0]
+	}
+}
+
+func (r *reflector) interfaceVariable(v variable) InterfaceVariable {
+	d := r.decorations[v.id]
+	typeID := r.pointee(v)
+
+	locations := uint32(1)
+	for {
+		t := r.types[typeID]
+		if t.op == opTypeArray && len(t.operands) >= 2 {
+			locations *= r.constants[t.operands[1]]
+			typeID = t.operands[0]
+			continue
+		}
+		if t.op == opTypeMatrix && len(t.operands) >= 2 {
+			locations *= t.operands[1]
+			typeID = t.operands[0]
+		}
+		break
+	}
+
+	return InterfaceVariable{
+		Name:      r.names[v.id],
+		Location:  d.value(decorationLocation),
+		Component: d.value(decorationComponent),
+		Format:    r.format(typeID),
+		Locations: locations,
+	}
+}
+
+// format maps scalar and vector types onto the matching R/RG/RGB/RGBA
+// format.
+func (r *reflector) format(typeID uint32) Format {
+	t := r.types[typeID]
+	components := uint32(1)
+	if t.op == opTypeVector && len(t.operands) >= 2 {
+		components = t.operands[1]
+		t = r.types[t.operands[0]]
+	}
+	if components < 1 || components > 4 || len(t.operands) < 1 {
+		return FormatUndefined
+	}
+
+	// Formats of one bit width are laid out as UINT, SINT, SFLOAT for R, RG,
+	// RGB and RGBA; 16 bit ones have extra normalized variants in between.
+	var base, stride Format
+	switch t.operands[0] {
+	case 16:
+		base, stride = 74, 7
+	case 32:
+		base, stride = 98, 3
+	case 64:
+		base, stride = 110, 3
+	default:
+		return FormatUndefined
+	}
+	var kind Format
+	switch {
+	case t.op == opTypeFloat:
+		kind = 2
+	case t.op == opTypeInt && len(t.operands) >= 2 && t.operands[1] == 1:
+		kind = 1
+	case t.op == opTypeInt:
+		kind = 0
+	default:
+		return FormatUndefined
+	}
+	return base + Format(components-1)*stride + kind
+}
+
+func (r *reflector) descriptor(v variable) (DescriptorBinding, error) {
+	d := r.decorations[v.id]
+	binding := DescriptorBinding{
+		Name:    r.names[v.id],
+		Set:     d.value(decorationDescriptorSet),
+		Binding: d.value(decorationBinding),
+		Count:   1,
+	}
+
+	typeID := r.pointee(v)
+	for {
+		t := r.types[typeID]
+		if t.op == opTypeArray && len(t.operands) >= 2 {
+			binding.Count *= r.constants[t.operands[1]]
+			typeID = t.operands[0]
+			continue
+		}
+		if t.op == opTypeRuntimeArray && len(t.operands) >= 1 {
+			binding.Count = 0
+			typeID = t.operands[0]
+			continue
+		}
+		break
+	}
+
+	t := r.types[typeID]
+	switch t.op {
+	case opTypeSampler:
+		binding.Type = DescriptorTypeSampler
+	case opTypeSampledImage:
+		binding.Type = DescriptorTypeCombinedImageSampler
+	case opTypeImage:
+		if len(t.operands) < 6 {
+			return binding, errors.Errorf("spirv: malformed image type for %q", binding.Name)
+		}
+		dim, sampled := t.operands[1], t.operands[5]
+		switch {
+		case dim == dimSubpassData:
+			binding.Type = DescriptorTypeInputAttachment
+		case dim == dimBuffer && sampled == 2:
+			binding.Type = DescriptorTypeStorageTexelBuffer
+		case dim == dimBuffer:
+			binding.Type = DescriptorTypeUniformTexelBuffer
+		case sampled == 2:
+			binding.Type = DescriptorTypeStorageImage
+		default:
+			binding.Type = DescriptorTypeSampledImage
+		}
+	case opTypeStruct:
+		switch {
+		case v.storage == storageStorageBuffer || r.decorations[typeID].has(decorationBufferBlock):
+			binding.Type = DescriptorTypeStorageBuffer
+		default:
+			binding.Type = DescriptorTypeUniformBuffer
+		}
+		if binding.Name == "" {
+			binding.Name = r.names[typeID]
+		}
+	case opTypeAccelStruct:
+		binding.Type = DescriptorTypeAccelerationStructure
+	default:
+		return binding, errors.Errorf("spirv: unsupported descriptor type %d for %q", t.op, binding.Name)
+	}
+
+	return binding, nil
+}
+
+func (r *reflector) pushConstants(v variable) PushConstantBlock {
+	typeID := r.pointee(v)
+	block := PushConstantBlock{
+		Name: r.names[v.id],
+	}
+	if block.Name == "" {
+		block.Name = r.names[typeID]
+	}
+
+	t := r.types[typeID]
+	if t.op != opTypeStruct {
+		return block
+	}
+	for member, memberType := range t.operands {
+		d := r.memberDecorations[typeID][uint32(member)]
+		block.Members = append(block.Members, BlockMember{
+			Name:   r.memberNames[typeID][uint32(member)],
+			Offset: d.value(decorationOffset),
+			Size:   r.size(memberType, d),
+		})
+	}
+	for i, member := range block.Members {
+		if i == 0 || member.Offset < block.Offset {
+			block.Offset = member.Offset
+		}
+		if end := member.Offset + member.Size; end > block.Size {
+			block.Size = end
+		}
+	}
+	block.Size -= block.Offset
+	return block
+}
+
+// size of a type in an explicitly laid out block, member decorations carry
+// the matrix stride.
+func (r *reflector) size(typeID uint32, member decorations) uint32 {
+	t := r.types[typeID]
+	switch t.op {
+	case opTypeBool:
+		return 4
+	case opTypeInt, opTypeFloat:
+		if len(t.operands) > 0 {
+			return t.operands[0] / 8
+		}
+	case opTypeVector:
+		if len(t.operands) >= 2 {
+			return r.size(t.operands[0], nil) * t.operands[1]
+		}
+	case opTypeMatrix:
+		if len(t.operands) >= 2 {
+			if stride := member.value(decorationMatrixStride); stride > 0 {
+				return stride * t.operands[1]
+			}
+			return r.size(t.operands[0], nil) * t.operands[1]
+		}
+	case opTypeArray:
+		if len(t.operands) >= 2 {
+			count := r.constants[t.operands[1]]
+			if stride := r.decorations[typeID].value(decorationArrayStride); stride > 0 {
+				return stride * count
+			}
+			return r.size(t.operands[0], member) * count
+		}
+	case opTypeStruct:
+		if size, ok := r.structSizes[typeID]; ok {
+			return size
+		}
+		var size uint32
+		for m, memberType := range t.operands {
+			d := r.memberDecorations[typeID][uint32(m)]
+			if end := d.value(decorationOffset) + r.size(memberType, d); end > size {
+				size = end
+			}
+		}
+		r.structSizes[typeID] = size
+		return size
+	}
+	return 0
+}
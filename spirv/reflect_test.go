@@ -0,0 +1,517 @@
+package spirv
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Formats as numbered by VkFormat.
+const (
+	formatR32g32Sfloat       Format = 103
+	formatR32g32b32Sfloat    Format = 106
+	formatR32g32b32a32Sint   Format = 108
+	formatR32g32b32a32Sfloat Format = 109
+)
+
+const dim2D = 1
+
+// assembler writes the extra fixtures next to the triangle shaders. Only
+// instructions reflection reads are emitted, there are no function bodies.
+type assembler struct {
+	words []uint32
+	bound uint32
+}
+
+func newAssembler() *assembler {
+	return &assembler{
+		words: []uint32{Magic, 0x00010000, 0, 0, 0},
+	}
+}
+
+func literal(s string) []uint32 {
+	words := make([]uint32, len(s)/4+1)
+	for t := 0; t < len(s); t++ {
+		words[t/4] |= uint32(s[t]) << (uint(t%4) * 8)
+	}
+	return words
+}
+
+func (a *assembler) op(op uint32, operands ...uint32) {
+	a.words = append(a.words, uint32(len(operands)+1)<<16|op)
+	a.words = append(a.words, operands...)
+}
+
+func (a *assembler) id() uint32 {
+	a.bound++
+	return a.bound
+}
+
+// typ declares a type and returns its id.
+func (a *assembler) typ(op uint32, operands ...uint32) uint32 {
+	id := a.id()
+	a.op(op, append([]uint32{id}, operands...)...)
+	return id
+}
+
+func (a *assembler) constant(typeID, value uint32) uint32 {
+	id := a.id()
+	a.op(opConstant, typeID, id, value)
+	return id
+}
+
+// variable declares a variable of a new pointer to typeID.
+func (a *assembler) variable(typeID, storage uint32) uint32 {
+	pointer := a.typ(opTypePointer, storage, typeID)
+	id := a.id()
+	a.op(opVariable, pointer, id, storage)
+	return id
+}
+
+func (a *assembler) entryPoint(model ExecutionModel, name string, interfaces ...uint32) uint32 {
+	fn := a.id()
+	operands := append([]uint32{uint32(model), fn}, literal(name)...)
+	a.op(opEntryPoint, append(operands, interfaces...)...)
+	return fn
+}
+
+func (a *assembler) name(id uint32, name string) {
+	a.op(opName, append([]uint32{id}, literal(name)...)...)
+}
+
+func (a *assembler) memberName(id, member uint32, name string) {
+	a.op(opMemberName, append([]uint32{id, member}, literal(name)...)...)
+}
+
+func (a *assembler) decorate(id, decoration uint32, literals ...uint32) {
+	a.op(opDecorate, append([]uint32{id, decoration}, literals...)...)
+}
+
+func (a *assembler) memberDecorate(id, member, decoration uint32, literals ...uint32) {
+	a.op(opMemberDecorate, append([]uint32{id, member, decoration}, literals...)...)
+}
+
+func (a *assembler) binding(id, set, binding uint32) {
+	a.decorate(id, decorationDescriptorSet, set)
+	a.decorate(id, decorationBinding, binding)
+}
+
+func (a *assembler) module() []uint32 {
+	a.words[3] = a.bound + 1
+	return a.words
+}
+
+// scalars declares the types every fixture needs.
+type scalars struct {
+	float, vec2, vec3, vec4, mat4 uint32
+	uint, int, ivec4              uint32
+}
+
+func (a *assembler) scalars() scalars {
+	s := scalars{}
+	s.float = a.typ(opTypeFloat, 32)
+	s.vec2 = a.typ(opTypeVector, s.float, 2)
+	s.vec3 = a.typ(opTypeVector, s.float, 3)
+	s.vec4 = a.typ(opTypeVector, s.float, 4)
+	s.mat4 = a.typ(opTypeMatrix, s.vec4, 4)
+	s.uint = a.typ(opTypeInt, 32, 0)
+	s.int = a.typ(opTypeInt, 32, 1)
+	s.ivec4 = a.typ(opTypeVector, s.int, 4)
+	return s
+}
+
+// globals declares the uniform block shared by the vertex and fragment
+// fixtures, at set 0 binding 0.
+func (a *assembler) globals(s scalars) {
+	block := a.typ(opTypeStruct, s.mat4, s.vec4)
+	a.name(block, "Globals")
+	a.decorate(block, decorationBlock)
+	a.memberDecorate(block, 0, decorationOffset, 0)
+	a.memberDecorate(block, 0, decorationMatrixStride, 16)
+	a.memberDecorate(block, 1, decorationOffset, 64)
+	a.binding(a.variable(block, storageUniform), 0, 0)
+}
+
+// push declares a push constant block with its first member at offset 16.
+func (a *assembler) push(s scalars) {
+	block := a.typ(opTypeStruct, s.vec4, s.mat4)
+	a.name(block, "Push")
+	a.memberName(block, 0, "tint")
+	a.memberName(block, 1, "model")
+	a.decorate(block, decorationBlock)
+	a.memberDecorate(block, 0, decorationOffset, 16)
+	a.memberDecorate(block, 1, decorationOffset, 32)
+	a.memberDecorate(block, 1, decorationMatrixStride, 16)
+	variable := a.variable(block, storagePushConstant)
+	a.name(variable, "push")
+}
+
+// meshVertex is a vertex shader with several inputs, built-ins on both
+// sides, the shared uniform block and push constants.
+func meshVertex() []uint32 {
+	a := newAssembler()
+	s := a.scalars()
+
+	position := a.variable(s.vec3, storageInput)
+	a.name(position, "in_Position")
+	a.decorate(position, decorationLocation, 0)
+	normal := a.variable(s.vec3, storageInput)
+	a.name(normal, "in_Normal")
+	a.decorate(normal, decorationLocation, 1)
+	bones := a.variable(s.ivec4, storageInput)
+	a.name(bones, "in_Bones")
+	a.decorate(bones, decorationLocation, 2)
+	instance := a.variable(s.mat4, storageInput)
+	a.name(instance, "in_Instance")
+	a.decorate(instance, decorationLocation, 3)
+	vertexIndex := a.variable(s.int, storageInput)
+	a.decorate(vertexIndex, decorationBuiltIn, 42)
+
+	perVertex := a.typ(opTypeStruct, s.vec4, s.float)
+	a.memberDecorate(perVertex, 0, decorationBuiltIn, 0)
+	a.memberDecorate(perVertex, 1, decorationBuiltIn, 1)
+	a.decorate(perVertex, decorationBlock)
+	perVertexOut := a.variable(perVertex, storageOutput)
+
+	a.globals(s)
+	a.push(s)
+	a.entryPoint(ExecutionModelVertex, "main", instance, position, vertexIndex, perVertexOut, normal, bones)
+	return a.module()
+}
+
+// texturedFragment samples an array of textures, reads and writes buffers
+// and shares the uniform block and push constants with meshVertex.
+func texturedFragment() []uint32 {
+	a := newAssembler()
+	s := a.scalars()
+
+	uv := a.variable(s.vec2, storageInput)
+	a.name(uv, "in_UV")
+	a.decorate(uv, decorationLocation, 0)
+	color := a.variable(s.vec4, storageOutput)
+	a.name(color, "out_Color")
+	a.decorate(color, decorationLocation, 0)
+
+	a.globals(s)
+
+	image := a.typ(opTypeImage, s.float, dim2D, 0, 0, 0, 1, 0)
+	sampledImage := a.typ(opTypeSampledImage, image)
+	textureArray := a.typ(opTypeArray, sampledImage, a.constant(s.uint, 4))
+	textures := a.variable(textureArray, storageUniformConstant)
+	a.name(textures, "textures")
+	a.binding(textures, 0, 1)
+
+	particleArray := a.typ(opTypeRuntimeArray, s.vec4)
+	a.decorate(particleArray, decorationArrayStride, 16)
+	particles := a.typ(opTypeStruct, particleArray)
+	a.name(particles, "Particles")
+	a.decorate(particles, decorationBlock)
+	a.memberDecorate(particles, 0, decorationOffset, 0)
+	a.binding(a.variable(particles, storageStorageBuffer), 1, 0)
+
+	storageImage := a.typ(opTypeImage, s.float, dim2D, 0, 0, 0, 2, 4)
+	target := a.variable(storageImage, storageUniformConstant)
+	a.name(target, "target")
+	a.binding(target, 1, 1)
+
+	a.push(s)
+	a.entryPoint(ExecutionModelFragment, "main", uv, color)
+	return a.module()
+}
+
+// particleCompute has a storage buffer at binding 0 of set.
+func particleCompute(set uint32) []uint32 {
+	a := newAssembler()
+	s := a.scalars()
+
+	particleArray := a.typ(opTypeRuntimeArray, s.vec4)
+	a.decorate(particleArray, decorationArrayStride, 16)
+	particles := a.typ(opTypeStruct, particleArray)
+	a.name(particles, "Particles")
+	a.decorate(particles, decorationBlock)
+	a.memberDecorate(particles, 0, decorationOffset, 0)
+	a.binding(a.variable(particles, storageStorageBuffer), set, 0)
+
+	fn := a.entryPoint(ExecutionModelGLCompute, "simulate")
+	a.op(opExecutionMode, fn, executionModeLocalSize, 64, 1, 1)
+	return a.module()
+}
+
+func reflectFile(t *testing.T, name string) *Module {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("..", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReflectBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func mustReflect(t *testing.T, words []uint32) *Module {
+	t.Helper()
+	m, err := Reflect(words)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestReflectEntryPoints(t *testing.T) {
+	tests := []struct {
+		name   string
+		module func(t *testing.T) *Module
+		want   []EntryPoint
+	}{
+		{
+			name:   "tri.vert",
+			module: func(t *testing.T) *Module { return reflectFile(t, "tri.vert.spv") },
+			want: []EntryPoint{
+				{
+					Name:  "main",
+					Model: ExecutionModelVertex,
+					Stage: ShaderStageVertex,
+					Inputs: []InterfaceVariable{
+						{Name: "in_Position", Location: 0, Format: formatR32g32Sfloat, Locations: 1},
+					},
+				},
+			},
+		},
+		{
+			name:   "tri.frag",
+			module: func(t *testing.T) *Module { return reflectFile(t, "tri.frag.spv") },
+			want: []EntryPoint{
+				{
+					Name:  "main",
+					Model: ExecutionModelFragment,
+					Stage: ShaderStageFragment,
+					Outputs: []InterfaceVariable{
+						{Name: "out_Color", Location: 0, Format: formatR32g32b32a32Sfloat, Locations: 1},
+					},
+				},
+			},
+		},
+		{
+			name:   "mesh vertex",
+			module: func(t *testing.T) *Module { return mustReflect(t, meshVertex()) },
+			want: []EntryPoint{
+				{
+					Name:  "main",
+					Model: ExecutionModelVertex,
+					Stage: ShaderStageVertex,
+					Inputs: []InterfaceVariable{
+						{Name: "in_Position", Location: 0, Format: formatR32g32b32Sfloat, Locations: 1},
+						{Name: "in_Normal", Location: 1, Format: formatR32g32b32Sfloat, Locations: 1},
+						{Name: "in_Bones", Location: 2, Format: formatR32g32b32a32Sint, Locations: 1},
+						{Name: "in_Instance", Location: 3, Format: formatR32g32b32a32Sfloat, Locations: 4},
+					},
+				},
+			},
+		},
+		{
+			name:   "particle compute",
+			module: func(t *testing.T) *Module { return mustReflect(t, particleCompute(0)) },
+			want: []EntryPoint{
+				{
+					Name:      "simulate",
+					Model:     ExecutionModelGLCompute,
+					Stage:     ShaderStageCompute,
+					LocalSize: [3]uint32{64, 1, 1},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := test.module(t)
+			if !reflect.DeepEqual(m.EntryPoints, test.want) {
+				t.Errorf("entry points\n%+v\nwant\n%+v", m.EntryPoints, test.want)
+			}
+		})
+	}
+}
+
+func TestReflectDescriptors(t *testing.T) {
+	fragmentStage := ShaderStageFragment
+	tests := []struct {
+		name   string
+		module []uint32
+		want   []DescriptorBinding
+	}{
+		{
+			name:   "textured fragment",
+			module: texturedFragment(),
+			want: []DescriptorBinding{
+				{Name: "Globals", Set: 0, Binding: 0, Type: DescriptorTypeUniformBuffer, Count: 1, Stages: fragmentStage},
+				{Name: "textures", Set: 0, Binding: 1, Type: DescriptorTypeCombinedImageSampler, Count: 4, Stages: fragmentStage},
+				{Name: "Particles", Set: 1, Binding: 0, Type: DescriptorTypeStorageBuffer, Count: 1, Stages: fragmentStage},
+				{Name: "target", Set: 1, Binding: 1, Type: DescriptorTypeStorageImage, Count: 1, Stages: fragmentStage},
+			},
+		},
+		{
+			name:   "particle compute",
+			module: particleCompute(2),
+			want: []DescriptorBinding{
+				{Name: "Particles", Set: 2, Binding: 0, Type: DescriptorTypeStorageBuffer, Count: 1, Stages: ShaderStageCompute},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := mustReflect(t, test.module)
+			if !reflect.DeepEqual(m.Descriptors, test.want) {
+				t.Errorf("descriptors\n%+v\nwant\n%+v", m.Descriptors, test.want)
+			}
+		})
+	}
+}
+
+func TestReflectPushConstants(t *testing.T) {
+	m := mustReflect(t, texturedFragment())
+	want := []PushConstantBlock{
+		{
+			Name:   "push",
+			Stages: ShaderStageFragment,
+			Offset: 16,
+			Size:   80,
+			Members: []BlockMember{
+				{Name: "tint", Offset: 16, Size: 16},
+				{Name: "model", Offset: 32, Size: 64},
+			},
+		},
+	}
+	if !reflect.DeepEqual(m.PushConstants, want) {
+		t.Errorf("push constants\n%+v\nwant\n%+v", m.PushConstants, want)
+	}
+}
+
+func TestMergeLayouts(t *testing.T) {
+	vertex := mustReflect(t, meshVertex())
+	fragment := mustReflect(t, texturedFragment())
+	compute := mustReflect(t, particleCompute(2))
+
+	layout, err := MergeLayouts(vertex, fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graphics := ShaderStageVertex | ShaderStageFragment
+	want := &PipelineLayout{
+		Sets: []DescriptorSetLayout{
+			{
+				Set: 0,
+				Bindings: []DescriptorBinding{
+					{Name: "Globals", Set: 0, Binding: 0, Type: DescriptorTypeUniformBuffer, Count: 1, Stages: graphics},
+					{Name: "textures", Set: 0, Binding: 1, Type: DescriptorTypeCombinedImageSampler, Count: 4, Stages: ShaderStageFragment},
+				},
+			},
+			{
+				Set: 1,
+				Bindings: []DescriptorBinding{
+					{Name: "Particles", Set: 1, Binding: 0, Type: DescriptorTypeStorageBuffer, Count: 1, Stages: ShaderStageFragment},
+					{Name: "target", Set: 1, Binding: 1, Type: DescriptorTypeStorageImage, Count: 1, Stages: ShaderStageFragment},
+				},
+			},
+		},
+		PushConstants: []PushConstantRange{
+			{Stages: graphics, Offset: 16, Size: 80},
+		},
+	}
+	if !reflect.DeepEqual(layout, want) {
+		t.Errorf("graphics layout\n%+v\nwant\n%+v", layout, want)
+	}
+
+	// Sets below the highest one used are left empty.
+	layout, err = MergeLayouts(compute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layout.Sets) != 3 || len(layout.Sets[0].Bindings) != 0 || len(layout.Sets[1].Bindings) != 0 || len(layout.Sets[2].Bindings) != 1 {
+		t.Errorf("compute sets %+v, want bindings only in set 2", layout.Sets)
+	}
+}
+
+func TestMergeLayoutsConflict(t *testing.T) {
+	fragment := mustReflect(t, texturedFragment())
+	compute := mustReflect(t, particleCompute(0))
+
+	_, err := MergeLayouts(fragment, compute)
+	if err == nil {
+		t.Fatal("merged a uniform and a storage buffer at the same binding")
+	}
+	if !strings.Contains(err.Error(), "set 0 binding 0") {
+		t.Errorf("error %q does not name the binding", err)
+	}
+}
+
+func TestReflectMalformedTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		types func(a *assembler, s scalars) uint32
+		err   string
+	}{
+		{
+			name: "array of itself",
+			types: func(a *assembler, s scalars) uint32 {
+				id := a.id()
+				a.op(opTypeArray, id, id, a.constant(s.uint, 2))
+				return id
+			},
+			err: "undeclared type",
+		},
+		{
+			name: "arrays of each other",
+			types: func(a *assembler, s scalars) uint32 {
+				first, second := a.id(), a.id()
+				length := a.constant(s.uint, 2)
+				a.op(opTypeArray, first, second, length)
+				a.op(opTypeArray, second, first, length)
+				return first
+			},
+			err: "undeclared type",
+		},
+		{
+			name: "struct containing itself",
+			types: func(a *assembler, s scalars) uint32 {
+				id := a.id()
+				a.op(opTypeStruct, id, s.vec4, id)
+				return id
+			},
+			err: "undeclared type",
+		},
+		{
+			name: "redeclared element type",
+			types: func(a *assembler, s scalars) uint32 {
+				element := a.typ(opTypeStruct, s.vec4)
+				array := a.typ(opTypeArray, element, a.constant(s.uint, 2))
+				a.op(opTypeStruct, element, array)
+				return array
+			},
+			err: "declared twice",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := newAssembler()
+			s := a.scalars()
+			typeID := test.types(a, s)
+			a.binding(a.variable(typeID, storageUniform), 0, 0)
+			fn := a.entryPoint(ExecutionModelGLCompute, "main")
+			a.op(opExecutionMode, fn, executionModeLocalSize, 1, 1, 1)
+
+			_, err := Reflect(a.module())
+			if err == nil {
+				t.Fatal("reflected without error")
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error %q, want %q", err, test.err)
+			}
+		})
+	}
+}
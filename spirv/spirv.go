@@ -0,0 +1,94 @@
+// Package spirv decodes and validates SPIR-V modules in pure Go.
+package spirv
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	Magic = 0x07230203
+	// HeaderWords is the size of the module header.
+	HeaderWords = 5
+
+	maxMinorVersion = 6
+)
+
+type Header struct {
+	Version   uint32
+	Generator uint32
+	// Bound is one above the highest id used in the module.
+	Bound  uint32
+	Schema uint32
+}
+
+func (h Header) Major() uint32 {
+	return h.Version >> 16 & 0xff
+}
+
+func (h Header) Minor() uint32 {
+	return h.Version >> 8 & 0xff
+}
+
+func (h Header) String() string {
+	return fmt.Sprintf("SPIR-V %d.%d, bound %d", h.Major(), h.Minor(), h.Bound)
+}
+
+// Words turns a module's bytes into words, swapping big-endian modules to
+// host order, and validates the header.
+func Words(data []byte) ([]uint32, error) {
+	if len(data)%4 != 0 {
+		return nil, errors.Errorf("spirv: size %d is not a multiple of 4", len(data))
+	}
+	if len(data) < HeaderWords*4 {
+		return nil, errors.Errorf("spirv: %d bytes is too short for a header", len(data))
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	switch {
+	case binary.LittleEndian.Uint32(data) == Magic:
+	case binary.BigEndian.Uint32(data) == Magic:
+		order = binary.BigEndian
+	default:
+		return nil, errors.Errorf("spirv: bad magic number 0x%08x", binary.LittleEndian.Uint32(data))
+	}
+
+	words := make([]uint32, len(data)/4)
+	for t := range words {
+		words[t] = order.Uint32(data[t*4:])
+	}
+	if _, err := Validate(words); err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+// Validate checks the header of a module already in host order.
+func Validate(words []uint32) (Header, error) {
+	if len(words) < HeaderWords {
+		return Header{}, errors.Errorf("spirv: %d words is too short for a header", len(words))
+	}
+	if words[0] != Magic {
+		return Header{}, errors.Errorf("spirv: bad magic number 0x%08x", words[0])
+	}
+
+	h := Header{
+		Version:   words[1],
+		Generator: words[2],
+		Bound:     words[3],
+		Schema:    words[4],
+	}
+	switch {
+	case h.Version&0xff0000ff != 0 || h.Major() != 1 || h.Minor() > maxMinorVersion:
+		return h, errors.Errorf("spirv: unsupported version 0x%08x", h.Version)
+	case h.Bound == 0:
+		return h, errors.New("spirv: id bound is zero")
+	case h.Schema != 0:
+		return h, errors.Errorf("spirv: unknown schema %d", h.Schema)
+	case len(words) == HeaderWords:
+		return h, errors.New("spirv: module has no instructions")
+	}
+	return h, nil
+}
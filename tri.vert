@@ -1,6 +1,7 @@
 #version 400
 
+layout(location = 0) in vec2 in_Position;
+
 void main() {
-	vec2 pos[3] = vec2[3](vec2(-0.7, 0.7), vec2(0.7, 0.7), vec2(0.0, -0.7));
-	gl_Position = vec4(pos[gl_VertexIndex], 0.0, 1.0);
+	gl_Position = vec4(in_Position, 0.0, 1.0);
 }